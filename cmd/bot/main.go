@@ -3,6 +3,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -11,13 +14,79 @@ import (
 	"didactic-spork/internal/bot"
 	"didactic-spork/internal/config"
 	"didactic-spork/internal/database"
+	"didactic-spork/internal/models"
 	"didactic-spork/pkg/logger"
 )
 
+// Exit codes, so supervisors can tell failures a restart won't fix from
+// transient ones
+const (
+	exitError    = 1 // unclassified failure, e.g. while running
+	exitConfig   = 2 // invalid configuration or bot token; don't restart
+	exitDatabase = 3 // the database couldn't be opened or written
+	exitNetwork  = 4 // Telegram couldn't be reached; restarting may help
+)
+
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	checkOnly := flag.Bool("check-config", false, "validate the configuration and database, then exit without starting the bot")
+	flag.Parse()
+
+	var err error
+	if *checkOnly {
+		err = checkConfig()
+	} else {
+		err = run()
+	}
+	if err != nil {
+		kind, code := classify(err)
+		fmt.Fprintf(os.Stderr, "Error (%s): %v\n", kind, err)
+		os.Exit(code)
+	}
+}
+
+// checkConfig loads and validates the configuration and checks that the
+// databases can be opened, without changing them or contacting Telegram
+func checkConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return models.ErrStartup{Kind: models.StartupConfig, Err: fmt.Errorf("failed to load configuration: %w", err)}
+	}
+
+	opts := database.Options{
+		CacheSize:     cfg.DBCacheSize,
+		BusyTimeoutMs: cfg.DBBusyTimeoutMs,
+	}
+	if err := database.Check(cfg.DatabasePath, opts); err != nil {
+		return models.ErrStartup{Kind: models.StartupDatabase, Err: fmt.Errorf("failed to check database: %w", err)}
+	}
+	if cfg.DatabaseReadPath != "" {
+		readDB, err := database.OpenReadOnly(cfg.DatabaseReadPath, opts)
+		if err != nil {
+			return models.ErrStartup{Kind: models.StartupDatabase, Err: fmt.Errorf("failed to open read database: %w", err)}
+		}
+		readDB.Close()
+	}
+
+	fmt.Println("Configuration OK")
+	return nil
+}
+
+// classify returns the kind of a startup failure and the matching exit code
+func classify(err error) (string, int) {
+	var startup models.ErrStartup
+	if !errors.As(err, &startup) {
+		return "runtime", exitError
+	}
+
+	switch startup.Kind {
+	case models.StartupConfig:
+		return startup.Kind, exitConfig
+	case models.StartupDatabase:
+		return startup.Kind, exitDatabase
+	case models.StartupNetwork:
+		return startup.Kind, exitNetwork
+	default:
+		return startup.Kind, exitError
 	}
 }
 
@@ -25,7 +94,7 @@ func run() error {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return models.ErrStartup{Kind: models.StartupConfig, Err: fmt.Errorf("failed to load configuration: %w", err)}
 	}
 
 	// Initialize logger
@@ -33,14 +102,32 @@ func run() error {
 	log.Info("Starting Telegram Role Bot")
 
 	// Initialize database
-	db, err := database.New(cfg.DatabasePath)
+	db, err := database.New(cfg.DatabasePath, database.Options{
+		JournalMode:   cfg.DBJournalMode,
+		Synchronous:   cfg.DBSynchronous,
+		CacheSize:     cfg.DBCacheSize,
+		BusyTimeoutMs: cfg.DBBusyTimeoutMs,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to initialize database: %w", err)
+		return models.ErrStartup{Kind: models.StartupDatabase, Err: fmt.Errorf("failed to initialize database: %w", err)}
 	}
 	defer db.Close()
 
+	// Role lookups can be read from a replica
+	var readDB *sql.DB
+	if cfg.DatabaseReadPath != "" {
+		readDB, err = database.OpenReadOnly(cfg.DatabaseReadPath, database.Options{
+			CacheSize:     cfg.DBCacheSize,
+			BusyTimeoutMs: cfg.DBBusyTimeoutMs,
+		})
+		if err != nil {
+			return models.ErrStartup{Kind: models.StartupDatabase, Err: fmt.Errorf("failed to open read database: %w", err)}
+		}
+		defer readDB.Close()
+	}
+
 	// Create bot service
-	botService, err := bot.New(cfg, db, log)
+	botService, err := bot.New(cfg, db, readDB, log)
 	if err != nil {
 		return fmt.Errorf("failed to create bot service: %w", err)
 	}
@@ -57,6 +144,18 @@ func run() error {
 		cancel()
 	}()
 
+	// Reload the configuration on SIGHUP
+	go func() {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		for range hupChan {
+			log.Info("Reload signal received")
+			if _, _, err := botService.Reload(); err != nil {
+				log.WithError(err).Error("Failed to reload configuration")
+			}
+		}
+	}()
+
 	// Start bot
 	if err := botService.Start(ctx); err != nil {
 		return fmt.Errorf("bot service error: %w", err)
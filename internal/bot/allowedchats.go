@@ -0,0 +1,28 @@
+package bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// checkAllowedChats warns about ALLOWED_CHATS entries that are likely wrong,
+// since a wrong ID silently makes the bot ignore every message in the chat.
+// Chats the bot can't look up are logged, with a hint for positive IDs,
+// which belong to private chats: groups and supergroups have negative IDs,
+// the latter starting with -100. Private chats the bot can find are fine,
+// such as the admin's. The bot keeps running either way.
+func (s *Service) checkAllowedChats(chats []int64) {
+	for _, chatID := range chats {
+		log := s.logger.WithField("chat_id", chatID)
+		_, err := s.botFor(chatID).GetChat(tgbotapi.ChatInfoConfig{
+			ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+		})
+		if err == nil {
+			continue
+		}
+		if chatID > 0 {
+			log.WithError(err).Warn("Allowed chat not found; group IDs are negative, supergroups start with -100")
+		} else {
+			log.WithError(err).Warn("Allowed chat not found; the bot may not be a member")
+		}
+	}
+}
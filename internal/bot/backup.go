@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"didactic-spork/internal/database"
+	"didactic-spork/internal/scheduler"
+)
+
+// backupFileLayout names backup files by the UTC time they were taken
+const backupFileLayout = "bot-20060102-150405.db"
+
+// backup writes a snapshot of the database to dest
+func (s *Service) backup(dest string) error {
+	return database.Backup(s.db, dest)
+}
+
+// runBackups writes a backup to BACKUP_DIR on every BACKUP_SCHEDULE tick
+// until the context is cancelled
+func (s *Service) runBackups(ctx context.Context) {
+	schedule, err := scheduler.ParseSpec(s.config.BackupSchedule)
+	if err != nil {
+		s.logger.WithError(err).Error("Invalid backup schedule, scheduled backups are disabled")
+		return
+	}
+	s.logger.WithFields(map[string]interface{}{
+		"dir":      s.config.BackupDir,
+		"schedule": s.config.BackupSchedule,
+	}).Info("Scheduled backups enabled")
+
+	for {
+		now := time.Now()
+		timer := time.NewTimer(schedule.Next(now).Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.scheduledBackup()
+		}
+	}
+}
+
+// scheduledBackup writes one backup to BACKUP_DIR. Old backups are kept;
+// pruning them is left to the operator.
+func (s *Service) scheduledBackup() {
+	if err := os.MkdirAll(s.config.BackupDir, 0o750); err != nil {
+		s.logger.WithError(err).Error("Failed to create backup directory")
+		return
+	}
+
+	dest := filepath.Join(s.config.BackupDir, time.Now().UTC().Format(backupFileLayout))
+	start := time.Now()
+	if err := s.backup(dest); err != nil {
+		s.logger.WithError(err).WithField("path", dest).Error("Scheduled backup failed")
+		return
+	}
+	s.logger.WithFields(map[string]interface{}{
+		"path":     dest,
+		"duration": time.Since(start).Round(time.Millisecond).String(),
+	}).Info("Database backed up")
+}
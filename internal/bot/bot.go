@@ -4,110 +4,570 @@ package bot
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"math"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"didactic-spork/internal/config"
 	"didactic-spork/internal/handlers"
 	"didactic-spork/internal/middleware"
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/scheduler"
 	"didactic-spork/internal/store"
 	"didactic-spork/pkg/logger"
+	"didactic-spork/pkg/utils"
 )
 
+// maxMessageLength keeps outgoing messages under Telegram's 4096 character limit
+const maxMessageLength = 4000
+
 // Service represents the main bot service
 type Service struct {
-	bot      *tgbotapi.BotAPI
-	store    store.Store
-	security *middleware.Security
-	handlers *handlers.Commands
-	config   *config.Config
-	logger   *logger.Logger
-}
-
-// New creates a new bot service
-func New(cfg *config.Config, db *sql.DB, log *logger.Logger) (*Service, error) {
-	// Initialize Telegram bot
-	bot, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
-	if err != nil {
-		if strings.Contains(err.Error(), "Not Found") {
-			return nil, fmt.Errorf("invalid TELEGRAM_APITOKEN")
+	// shards holds one bot per token; the first is the TELEGRAM_APITOKEN bot
+	shards    []*shard
+	store     store.Store
+	db        *sql.DB
+	security  *middleware.Security
+	throttle  *middleware.ChatThrottle
+	handlers  *handlers.Commands
+	scheduler *scheduler.Scheduler
+	config    *config.Config
+	logger    *logger.Logger
+
+	// leftChats records when the bot last left an unauthorized chat, so queued
+	// messages from the same chat don't trigger repeated leave attempts
+	leftChats sync.Map
+	// noRights records until when sends to a chat are skipped because the
+	// bot isn't allowed to post there
+	noRights sync.Map
+	// rateNotices limits how often a rate-limited user is told to slow down,
+	// so the notices don't add to the flood
+	rateNotices *middleware.RateLimiter
+	// reloadMu keeps configuration reloads from running at the same time
+	reloadMu sync.Mutex
+	// updatesHandled counts the updates handled since the bot started
+	updatesHandled atomic.Int64
+	// panics counts the panics recovered while handling updates
+	panics atomic.Int64
+	// lastSeen records when each user's last-seen time was last written, so
+	// busy users don't cause a write per message
+	lastSeen sync.Map
+}
+
+// New creates a new bot service. readDB is a read-only copy of db for role
+// lookups, or nil to read from db.
+func New(cfg *config.Config, db, readDB *sql.DB, log *logger.Logger) (*Service, error) {
+	// Initialize Telegram bots, one per token
+	var shards []*shard
+	for i, token := range append([]string{cfg.TelegramToken}, cfg.ShardTokens...) {
+		bot, err := tgbotapi.NewBotAPI(token)
+		if err != nil {
+			// Telegram rejects unknown tokens, which no restart will fix
+			if strings.Contains(err.Error(), "Not Found") {
+				if i == 0 {
+					return nil, models.ErrStartup{Kind: models.StartupConfig, Err: fmt.Errorf("invalid TELEGRAM_APITOKEN")}
+				}
+				return nil, models.ErrStartup{Kind: models.StartupConfig, Err: fmt.Errorf("invalid token %d in SHARD_TOKENS", i)}
+			}
+			return nil, models.ErrStartup{Kind: models.StartupNetwork, Err: fmt.Errorf("failed to create bot API: %w", err)}
 		}
-		return nil, fmt.Errorf("failed to create bot API: %w", err)
+		bot.Debug = cfg.LogLevel == "debug"
+		limiter := middleware.NewSendLimiter(cfg.SendRatePerSec, time.Duration(cfg.GroupSendIntervalMs)*time.Millisecond)
+		shards = append(shards, &shard{index: i, bot: bot, sender: bot, limiter: limiter})
 	}
+	bot := shards[0].bot
 
-	bot.Debug = cfg.LogLevel == "debug"
-	log.WithField("username", bot.Self.UserName).Info("Bot authorized successfully")
+	if !models.IsSupportedLocale(cfg.Locale) {
+		log.WithField("locale", cfg.Locale).Warn("Unsupported locale, falling back to English")
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.WithField("timezone", cfg.Timezone).Warn("Unknown timezone, falling back to UTC")
+		loc = time.UTC
+	}
+	utils.SetTimeLocation(loc)
+	for _, sh := range shards {
+		log.WithFields(map[string]interface{}{
+			"username": sh.bot.Self.UserName,
+			"shard":    sh.index,
+		}).Info("Bot authorized successfully")
+	}
 
 	// Initialize dependencies
-	roleStore := store.New(db)
+	roleStore := store.New(db, store.Options{
+		MaxRoles:      cfg.MaxRoles,
+		ReservedNames: cfg.ReservedRoleNames,
+		BannedWords:   cfg.BannedWords,
+		NamePattern:   cfg.RoleNamePattern,
+		RejectBots:    cfg.BlockBotUsernames,
+
+		MembersCacheTTL:  time.Duration(cfg.MembersCacheSec) * time.Second,
+		MembersCacheSize: cfg.MembersCacheSize,
+		ReadDB:           readDB,
+	})
 	security := middleware.NewSecurity(cfg)
-	commandHandlers := handlers.NewCommands(roleStore, security, log)
+	throttle := middleware.NewChatThrottle(time.Duration(cfg.PingThrottleMs) * time.Millisecond)
+	commandHandlers := handlers.NewCommands(roleStore, security, throttle, db, cfg, log)
+
+	service := &Service{
+		shards:      shards,
+		store:       roleStore,
+		db:          db,
+		rateNotices: middleware.NewRateLimiter(1, time.Minute),
+		security:    security,
+		throttle:    throttle,
+		handlers:    commandHandlers,
+		config:      cfg,
+		logger:      log,
+	}
+	service.scheduler = scheduler.New(roleStore, service.sendScheduledPing, log)
+	commandHandlers.SetReloader(service.Reload)
+	commandHandlers.SetBackuper(service.backup)
+	commandHandlers.SetPinner(service.pinMessage)
+	commandHandlers.SetMemberLister(service.chatMembers)
+	commandHandlers.SetUpdateCounter(service.updatesHandled.Load)
+	service.checkAllowedChats(cfg.AllowedChats)
 
 	// Start health check server
-	go startHealthServer(cfg.HealthPort, db, log)
+	health := NewHealthChecker(db, roleStore, bot.Self.UserName, service.panics.Load)
+	if cfg.HealthCheckTelegram {
+		health.CheckTelegram(bot)
+	}
+	go startHealthServer(cfg.HealthPort, health, log)
 
-	return &Service{
-		bot:      bot,
-		store:    roleStore,
-		security: security,
-		handlers: commandHandlers,
-		config:   cfg,
-		logger:   log,
-	}, nil
+	return service, nil
 }
 
 // Start starts the bot service
 func (s *Service) Start(ctx context.Context) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = s.config.UpdateTimeout
+	persistRateLimits := s.config.RateLimitStore == config.RateLimitStoreDatabase
+	if persistRateLimits {
+		restored, err := s.security.RestoreRateLimits(ctx, s.store)
+		if err != nil {
+			return fmt.Errorf("failed to restore rate limits: %w", err)
+		}
+		s.logger.WithField("events", restored).Info("Restored rate limits")
+	}
+
+	if err := s.security.LoadAdmins(ctx, s.store); err != nil {
+		return fmt.Errorf("failed to load admins: %w", err)
+	}
+	if err := s.handlers.LoadAliases(ctx); err != nil {
+		return fmt.Errorf("failed to load command aliases: %w", err)
+	}
+
+	// Resume after the last handled updates so Telegram doesn't redeliver them
+	for _, sh := range s.shards {
+		lastUpdateID, err := s.store.GetLastUpdateID(ctx, sh.index)
+		if err != nil {
+			return fmt.Errorf("failed to get last update id: %w", err)
+		}
+		sh.resumeAfter = lastUpdateID
+		sh.lastUpdateID.Store(int64(lastUpdateID))
+		sh.savedUpdateID = int64(lastUpdateID)
+	}
+
+	var wg sync.WaitGroup
+	updates := make(chan shardUpdate)
+	for _, sh := range s.shards {
+		u := tgbotapi.NewUpdate(sh.resumeAfter + 1)
+		u.Timeout = s.config.UpdateTimeout
+		u.AllowedUpdates = []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeChatMember, tgbotapi.UpdateTypeMyChatMember, tgbotapi.UpdateTypeCallbackQuery}
+
+		wg.Add(1)
+		go func(sh *shard) {
+			defer wg.Done()
+			s.pollUpdates(ctx, sh, u, updates)
+		}(sh)
+	}
+	s.logger.WithFields(map[string]interface{}{
+		"workers": s.config.WorkerCount,
+		"shards":  len(s.shards),
+	}).Info("Bot started, listening for updates")
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.scheduler.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watchDBPool(ctx, s.db, s.logger)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.sweepExpiredMemberships(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.persistUpdateIDs(ctx)
+	}()
+
+	if s.config.ChatCleanupHours > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.sweepDepartedChats(ctx)
+		}()
+	}
+
+	if s.config.InactiveDays > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.sweepInactiveMembers(ctx)
+		}()
+	}
+
+	if s.config.BackupSchedule != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runBackups(ctx)
+		}()
+	}
+
+	if persistRateLimits {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.security.SaveRateLimits(ctx, s.store, s.logger)
+		}()
+	}
+
+	for i := 0; i < s.config.WorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker(ctx, updates)
+		}()
+	}
+
+	<-ctx.Done()
+	s.logger.Info("Shutdown requested, waiting for in-flight updates")
+	wg.Wait()
+
+	// Save the updates handled since the last periodic save
+	s.saveUpdateIDs(context.WithoutCancel(ctx))
+	return nil
+}
+
+// Delays between attempts to fetch updates after Telegram can't be reached.
+// The delay doubles after every failure up to the maximum and resets once a
+// fetch succeeds.
+const (
+	pollBackoffMin = time.Second
+	pollBackoffMax = time.Minute
+)
+
+// pollUpdates long-polls Telegram for a shard's updates and passes them on to
+// the workers until the context is cancelled. Failed fetches are retried with
+// exponential backoff, so an outage doesn't turn into a flood of requests.
+func (s *Service) pollUpdates(ctx context.Context, sh *shard, u tgbotapi.UpdateConfig, updates chan<- shardUpdate) {
+	backoff := pollBackoffMin
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		received, err := sh.bot.GetUpdates(u)
+		if err != nil {
+			s.logger.WithError(err).WithFields(map[string]interface{}{
+				"shard":    sh.index,
+				"retry_in": backoff.String(),
+			}).Warn("Failed to get updates")
 
-	updates := s.bot.GetUpdatesChan(u)
-	s.logger.Info("Bot started, listening for updates")
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, pollBackoffMax)
+			continue
+		}
+		backoff = pollBackoffMin
 
+		for _, update := range received {
+			if update.UpdateID < u.Offset {
+				continue
+			}
+			u.Offset = update.UpdateID + 1
+			select {
+			case updates <- shardUpdate{shard: sh, update: update}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// worker handles updates until the context is cancelled or the channel closes.
+// An update that has already been picked up is finished even during shutdown.
+func (s *Service) worker(ctx context.Context, updates <-chan shardUpdate) {
+	handleCtx := context.WithoutCancel(ctx)
 	for {
 		select {
 		case <-ctx.Done():
-			s.logger.Info("Shutdown requested, stopping bot")
-			return nil
-		case update := <-updates:
-			if err := s.handleUpdate(update); err != nil {
-				s.logger.WithError(err).Error("Failed to handle update")
+			return
+		case received, ok := <-updates:
+			if !ok {
+				return
 			}
+			s.handleUpdateSafely(handleCtx, received.shard, received.update)
 		}
 	}
 }
 
+// handleUpdateSafely handles an update and recovers from a panic in any
+// handler, so one malformed update can't take down the bot. The update was
+// already marked as handled, so it isn't redelivered after a panic.
+func (s *Service) handleUpdateSafely(ctx context.Context, sh *shard, update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.panics.Add(1)
+			raw, _ := json.Marshal(update)
+			s.logger.WithFields(map[string]interface{}{
+				"panic":     fmt.Sprint(r),
+				"update_id": update.UpdateID,
+				"chat_id":   updateChatID(update),
+				"shard":     sh.index,
+				"update":    string(raw),
+				"stack":     string(debug.Stack()),
+			}).Error("Recovered from panic while handling update")
+		}
+	}()
+
+	if err := s.handleUpdate(ctx, sh, update); err != nil {
+		s.logger.WithError(err).Error("Failed to handle update")
+	}
+}
+
 // handleUpdate processes incoming Telegram updates
-func (s *Service) handleUpdate(update tgbotapi.Update) error {
+func (s *Service) handleUpdate(ctx context.Context, sh *shard, update tgbotapi.Update) error {
+	// Skip updates that were already handled, e.g. redelivered after a crash
+	if !s.markUpdate(sh, update.UpdateID) {
+		s.logger.WithField("update_id", update.UpdateID).Debug("Skipping already handled update")
+		return nil
+	}
+
+	// Every bot sees every group message, but only the chat's shard answers
+	if chatID := updateChatID(update); chatID != 0 && ShardFor(chatID, len(s.shards)) != sh.index {
+		return nil
+	}
+	s.updatesHandled.Add(1)
+
+	// Handle membership changes
+	if update.MyChatMember != nil {
+		return s.handleMyChatMember(ctx, update.MyChatMember)
+	}
+	if update.ChatMember != nil {
+		return s.handleChatMember(ctx, update.ChatMember)
+	}
+
+	// Handle taps on inline keyboard buttons
+	if update.CallbackQuery != nil {
+		return s.handleCallback(ctx, update.CallbackQuery)
+	}
+
 	// Security validation
 	if err := s.security.ValidateMessage(update); err != nil {
 		s.logger.WithError(err).Warn("Message validation failed")
+		var notAllowed models.ErrChatNotAllowed
+		if errors.As(err, &notAllowed) && s.config.AutoLeaveUnauthorized {
+			s.leaveUnauthorizedChat(update.Message.Chat)
+		}
+		var limited models.ErrRateLimited
+		if errors.As(err, &limited) && update.Message.IsCommand() {
+			s.sendRateLimited(update.Message, limited.RetryAfter)
+		}
+		if update.Message.IsCommand() {
+			s.handlers.LogAccess(update.Message, accessOutcome(err), err)
+		}
 		return err
 	}
 
 	if update.Message == nil {
 		return nil
 	}
+	s.recordSeen(ctx, update.Message)
 
 	// Log message for debugging
 	s.logMessage(update.Message)
 
 	// Handle commands
 	if update.Message.IsCommand() {
-		return s.handlers.Handle(s.bot, update)
+		return s.handlers.Handle(ctx, s.sendWithRetry, update)
 	}
 
 	// Handle role mentions
-	if strings.HasPrefix(update.Message.Text, "@") {
-		return s.handleRoleMention(update)
+	if strings.Contains(update.Message.Text, "@") {
+		return s.handleRoleMention(ctx, update)
 	}
 
 	return nil
 }
 
+// accessOutcome returns the access log outcome of a command that failed
+// security validation
+func accessOutcome(err error) string {
+	var limited models.ErrRateLimited
+	var notAllowed models.ErrChatNotAllowed
+	switch {
+	case errors.As(err, &limited):
+		return handlers.AccessRateLimited
+	case errors.As(err, &notAllowed):
+		return handlers.AccessChatNotAllowed
+	default:
+		return handlers.AccessInvalid
+	}
+}
+
+// markUpdate records an update as handled and reports whether it is new.
+// Within a run Telegram doesn't deliver an update twice, so only updates
+// handled before a restart need to be skipped. The highest ID is kept in
+// memory and written by saveUpdateIDs; workers handle updates concurrently,
+// so it only ever moves forward.
+func (s *Service) markUpdate(sh *shard, updateID int) bool {
+	if updateID <= sh.resumeAfter {
+		return false
+	}
+
+	for {
+		last := sh.lastUpdateID.Load()
+		if int64(updateID) <= last || sh.lastUpdateID.CompareAndSwap(last, int64(updateID)) {
+			return true
+		}
+	}
+}
+
+// updateIDSaveInterval is how often the last handled update IDs are written.
+// After a crash, at most this much of the updates is handled again.
+const updateIDSaveInterval = 5 * time.Second
+
+// persistUpdateIDs writes the last handled update IDs every
+// updateIDSaveInterval until the context is cancelled
+func (s *Service) persistUpdateIDs(ctx context.Context) {
+	ticker := time.NewTicker(updateIDSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.saveUpdateIDs(ctx)
+		}
+	}
+}
+
+// saveUpdateIDs writes the last handled update ID of each shard that handled
+// updates since the previous save
+func (s *Service) saveUpdateIDs(ctx context.Context) {
+	for _, sh := range s.shards {
+		last := sh.lastUpdateID.Load()
+		if last <= sh.savedUpdateID {
+			continue
+		}
+		if err := s.store.SetLastUpdateID(ctx, sh.index, int(last)); err != nil {
+			s.logger.WithError(err).WithField("shard", sh.index).Warn("Failed to persist last update id")
+			continue
+		}
+		sh.savedUpdateID = last
+	}
+}
+
+// handleCallback handles a tap on an inline keyboard button. Buttons on
+// inline-mode messages have no chat and are ignored.
+func (s *Service) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	if query.Message == nil {
+		return nil
+	}
+
+	// Always answer, so the button stops showing a loading indicator
+	defer func() {
+		if _, err := s.botFor(query.Message.Chat.ID).Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+			s.logger.WithError(err).Debug("Failed to answer callback query")
+		}
+	}()
+
+	if err := s.security.ValidateCallback(query); err != nil {
+		s.logger.WithError(err).Warn("Callback validation failed")
+		return err
+	}
+
+	return s.handlers.HandleCallback(ctx, s.sendWithRetry, query)
+}
+
+// sendRateLimited tells a user who sent a command too fast when they can try
+// again. Only commands get a reply, and at most one a minute, since plain
+// messages are rate limited too.
+func (s *Service) sendRateLimited(message *tgbotapi.Message, retryAfter time.Duration) {
+	if !s.rateNotices.Allow(message.From.ID) {
+		return
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	text := models.Msg(models.MsgRateLimited, s.config.Locale, seconds)
+	if _, err := s.sendWithRetry(message.Chat.ID, newReply(message.Chat.ID, s.replyID(message), text)); err != nil {
+		s.logger.WithError(err).Warn("Failed to send rate limit notice")
+	}
+}
+
+// leaveUnauthorizedChat sends a short notice and leaves a group that isn't
+// allowed, with every shard's bot. Private chats and channels are never left.
+func (s *Service) leaveUnauthorizedChat(chat *tgbotapi.Chat) {
+	if !chat.IsGroup() && !chat.IsSuperGroup() {
+		return
+	}
+	const leaveCooldown = time.Minute
+	if leftAt, ok := s.leftChats.Load(chat.ID); ok && time.Since(leftAt.(time.Time)) < leaveCooldown {
+		return
+	}
+	s.leftChats.Store(chat.ID, time.Now())
+
+	log := s.logger.WithFields(map[string]interface{}{
+		"chat_id":    chat.ID,
+		"chat_title": chat.Title,
+	})
+
+	if _, err := s.sendWithRetry(chat.ID, newMessage(chat.ID, models.Msg(models.MsgLeavingUnauthorized, s.config.Locale))); err != nil {
+		log.WithError(err).Warn("Failed to send leave notice")
+	}
+
+	failed := false
+	for _, sh := range s.shards {
+		if _, err := sh.bot.Request(tgbotapi.LeaveChatConfig{ChatID: chat.ID}); err != nil {
+			log.WithError(err).WithField("shard", sh.index).Error("Failed to leave unauthorized chat")
+			failed = true
+		}
+	}
+	if failed {
+		s.leftChats.Delete(chat.ID)
+		return
+	}
+
+	log.Warn("Left unauthorized chat")
+}
+
 // logMessage logs incoming messages for debugging
 func (s *Service) logMessage(message *tgbotapi.Message) {
 	s.logger.WithFields(map[string]interface{}{
@@ -119,49 +579,203 @@ func (s *Service) logMessage(message *tgbotapi.Message) {
 	}).Debug("Received message")
 }
 
-// handleRoleMention processes role mentions like @rolename
-func (s *Service) handleRoleMention(update tgbotapi.Update) error {
-	role := strings.TrimPrefix(update.Message.Text, "@")
-	role = strings.TrimSpace(role)
-	role = strings.ToLower(role) // Normalize to lowercase
+// handleRoleMention pings every role @mentioned in a message in a single
+// combined ping. Mentions of regular users are ignored, so mentioning someone
+// doesn't trigger a ping, while role mentions work anywhere in the text.
+func (s *Service) handleRoleMention(ctx context.Context, update tgbotapi.Update) error {
+	var roles []string
+	for _, name := range mentions(update.Message) {
+		if !utils.Contains(s.config.EveryoneKeywords, name) {
+			roles = append(roles, name)
+			continue
+		}
+		// @everyone is reserved for admins given how many people it notifies
+		if s.security.IsAdmin(update.Message.From.UserName) {
+			return s.pingEveryone(ctx, update.Message, name)
+		}
+	}
+	if len(roles) == 0 {
+		return nil
+	}
 
-	users, err := s.store.GetUsersInRole(role)
+	text, err := s.handlers.PingRoles(ctx, update.Message.Chat.ID, roles, "")
 	if err != nil {
 		s.logger.WithError(err).Error("Failed to get users in role")
 		return err
 	}
+	if text == "" {
+		return nil
+	}
 
-	if len(users) > 0 {
-		msgText := fmt.Sprintf("Pinging role @%s: ", role)
-		for _, user := range users {
-			msgText += "@" + user + " "
-		}
+	return s.sendPing(ctx, update.Message.Chat.ID, s.replyID(update.Message), text)
+}
 
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, msgText)
-		_, err := s.bot.Send(msg)
+// pingEveryone pings every user the bot knows about in response to an
+// @everyone style keyword in message
+func (s *Service) pingEveryone(ctx context.Context, message *tgbotapi.Message, keyword string) error {
+	chatID := message.Chat.ID
+	text, err := s.handlers.PingEveryone(ctx, chatID, keyword)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get all users")
 		return err
 	}
+	if text == "" {
+		return nil
+	}
+
+	return s.sendPing(ctx, chatID, s.replyID(message), text)
+}
 
+// sendPing sends a ping through the per-chat throttle, as a reply to the
+// message with ID replyTo unless it is zero
+func (s *Service) sendPing(ctx context.Context, chatID int64, replyTo int, text string) error {
+	if err := s.throttle.Wait(ctx, chatID); err != nil {
+		return err
+	}
+	return s.sendText(chatID, replyTo, text)
+}
+
+// sendText sends text to a chat, split into several messages if it exceeds
+// Telegram's message length limit. Only the first message replies to replyTo.
+func (s *Service) sendText(chatID int64, replyTo int, text string) error {
+	for _, chunk := range utils.SplitMessage(text, maxMessageLength) {
+		if _, err := s.sendWithRetry(chatID, newReply(chatID, replyTo, chunk)); err != nil {
+			return err
+		}
+		replyTo = 0
+	}
 	return nil
 }
 
-// startHealthServer starts the health check HTTP server
-func startHealthServer(port string, db *sql.DB, log *logger.Logger) {
-	mux := http.NewServeMux()
+// newMessage creates a message whose text is formatted as MarkdownV2
+func newMessage(chatID int64, text string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	return msg
+}
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if err := db.Ping(); err != nil {
-			log.WithError(err).Error("Health check failed")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprint(w, "UNHEALTHY")
-			return
+// newReply creates a MarkdownV2 message that replies to the message with ID
+// replyTo, or a standalone one if replyTo is zero. The reply is still sent
+// if the original was deleted in the meantime.
+func newReply(chatID int64, replyTo int, text string) tgbotapi.MessageConfig {
+	msg := newMessage(chatID, text)
+	msg.ReplyToMessageID = replyTo
+	msg.AllowSendingWithoutReply = true
+	return msg
+}
+
+// replyID returns the ID of the message a response to message should reply
+// to, or zero when REPLY_TO_COMMANDS is off
+func (s *Service) replyID(message *tgbotapi.Message) int {
+	if !s.config.ReplyToCommands {
+		return 0
+	}
+	return message.MessageID
+}
+
+// mentions returns the lowercased names of all @mentions in a message.
+// Telegram only marks mentions of names made of Latin letters, digits, and
+// underscores, so mentions of roles such as @команда or @🚀launch are found
+// in the text and follow the marked ones.
+func mentions(message *tgbotapi.Message) []string {
+	var names []string
+	for _, entity := range message.Entities {
+		if !entity.IsMention() {
+			continue
+		}
+		name := utils.EntityText(message.Text, entity.Offset, entity.Length)
+		name = strings.ToLower(strings.TrimPrefix(name, "@"))
+		if name != "" {
+			names = append(names, name)
 		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "HEALTHY")
+	}
+
+	for _, word := range strings.Fields(message.Text) {
+		name, ok := strings.CutPrefix(word, "@")
+		name = strings.TrimRight(name, mentionTrailers)
+		if ok && name != "" && !isASCII(name) {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+// mentionTrailers is the punctuation that can follow a mention without being
+// part of the name, as in "ping @команда, please"
+const mentionTrailers = `.,;:!?)]}"'…»`
+
+// isASCII reports whether s only contains ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// handleChatMember cleans up or reports role memberships of users who left a chat
+func (s *Service) handleChatMember(ctx context.Context, member *tgbotapi.ChatMemberUpdated) error {
+	if !s.security.IsChatAllowed(member.Chat.ID) {
+		return nil
+	}
+
+	newMember := member.NewChatMember
+	if !newMember.HasLeft() && !newMember.WasKicked() {
+		return nil
+	}
+	if newMember.User == nil || newMember.User.UserName == "" {
+		return nil
+	}
+
+	username := newMember.User.UserName
+	log := s.logger.WithFields(map[string]interface{}{
+		"chat_id":  member.Chat.ID,
+		"username": username,
 	})
 
-	log.WithField("port", port).Info("Starting health check server")
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		log.WithError(err).Error("Health check server failed")
+	var text string
+	if s.config.PruneDepartedUsers {
+		actor := models.Actor{Username: s.botFor(member.Chat.ID).Self.UserName, ChatID: member.Chat.ID}
+		removed, err := s.store.RemoveUserFromAllRoles(ctx, actor, username)
+		if err != nil {
+			log.WithError(err).Error("Failed to prune departed user")
+			return err
+		}
+		if removed == 0 {
+			return nil
+		}
+		log.WithField("removed", removed).Info("Pruned departed user from roles")
+		text = models.Msg(models.MsgDepartedPruned, s.config.Locale, username, removed)
+	} else {
+		roles, err := s.store.GetRolesForUser(ctx, username)
+		if err != nil {
+			log.WithError(err).Error("Failed to get roles for departed user")
+			return err
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		text = models.Msg(models.MsgDepartedNotice, s.config.Locale, s.security.Config().AdminUsername, username, strings.Join(roles, ", "))
+	}
+
+	_, err := s.sendWithRetry(member.Chat.ID, newMessage(member.Chat.ID, text))
+	return err
+}
+
+// sendScheduledPing pings the members of a scheduled role in its chat
+func (s *Service) sendScheduledPing(ctx context.Context, ping models.ScheduledPing) error {
+	if !s.security.IsChatAllowed(ping.ChatID) {
+		return nil
+	}
+
+	text, err := s.handlers.PingRoles(ctx, ping.ChatID, []string{ping.Role}, ping.Message)
+	if err != nil {
+		return err
 	}
+	if text == "" {
+		return nil
+	}
+
+	return s.sendPing(ctx, ping.ChatID, 0, text)
 }
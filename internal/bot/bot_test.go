@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+)
+
+// messageWithMentions builds a group message whose @words are mention
+// entities, as Telegram sends them for Latin usernames
+func messageWithMentions(text string) *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 1, UserName: "carol"},
+		Chat:      &tgbotapi.Chat{ID: -100, Type: "supergroup"},
+		Text:      text,
+	}
+	// Entity offsets and lengths count UTF-16 code units
+	offset := 0
+	for _, word := range strings.SplitAfter(text, " ") {
+		name := strings.TrimRight(word, " ,.")
+		if strings.HasPrefix(name, "@") && isASCII(name) {
+			message.Entities = append(message.Entities, tgbotapi.MessageEntity{Type: "mention", Offset: offset, Length: len(name)})
+		}
+		offset += len(utf16.Encode([]rune(word)))
+	}
+	return message
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"@Alice can you look at this", []string{"alice"}},
+		{"thanks @alice, now ping @Devs.", []string{"alice", "devs"}},
+		{"héllo @devs", []string{"devs"}},
+		{"email me at bob@example.com", nil},
+		{"ping @команда, please", []string{"команда"}},
+		{"@Ёлка! и @🚀launch", []string{"ёлка", "🚀launch"}},
+	}
+	for _, tt := range tests {
+		got := mentions(messageWithMentions(tt.text))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("mentions(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHandleRoleMentionIgnoresUserMentions(t *testing.T) {
+	s, sender, st := newTestService(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: "admin", ChatID: -100}
+	st.CreateRole(ctx, admin, "devs")
+	st.AddUserToRole(ctx, admin, "devs", "bob")
+
+	// A user mentioned at the start of a message isn't a role ping
+	if err := s.handleRoleMention(ctx, tgbotapi.Update{Message: messageWithMentions("@alice are you around?")}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sender.messages(); len(sent) != 0 {
+		t.Fatalf("sent %q for a user mention", sent[0].Text)
+	}
+
+	// A role mentioned mid-sentence next to a user is
+	if err := s.handleRoleMention(ctx, tgbotapi.Update{Message: messageWithMentions("@alice says @devs should deploy")}); err != nil {
+		t.Fatal(err)
+	}
+	sent := sender.messages()
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, "@bob") || strings.Contains(sent[0].Text, "@alice") {
+		t.Errorf("sent %v, want one ping of devs' members", sent)
+	}
+}
+
+func TestHandleRoleMentionUnicode(t *testing.T) {
+	s, sender, st := newTestService(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: "admin", ChatID: -100}
+	st.CreateRole(ctx, admin, "ёлка")
+	st.AddUserToRole(ctx, admin, "ёлка", "bob")
+
+	// Telegram sends no entity for non-Latin mentions, and case is folded
+	if err := s.handleRoleMention(ctx, tgbotapi.Update{Message: messageWithMentions("time to decorate @Ёлка!")}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sender.messages(); len(sent) != 1 || !strings.Contains(sent[0].Text, "@bob") {
+		t.Errorf("sent %v, want one ping of ёлка's members", sent)
+	}
+}
+
+func TestMarkUpdateKeepsHighestID(t *testing.T) {
+	s, _, st := newTestService(t)
+	ctx := context.Background()
+	sh := s.shards[0]
+	sh.resumeAfter = 10
+
+	for _, tt := range []struct {
+		id   int
+		want bool
+	}{{9, false}, {10, false}, {12, true}, {11, true}} {
+		if got := s.markUpdate(sh, tt.id); got != tt.want {
+			t.Errorf("markUpdate(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+	if last := sh.lastUpdateID.Load(); last != 12 {
+		t.Errorf("last update ID = %d, want 12", last)
+	}
+
+	// Nothing is written until the IDs are saved
+	if id, _ := st.GetLastUpdateID(ctx, sh.index); id != 0 {
+		t.Errorf("saved update ID = %d before saving, want 0", id)
+	}
+	s.saveUpdateIDs(ctx)
+	if id, _ := st.GetLastUpdateID(ctx, sh.index); id != 12 {
+		t.Errorf("saved update ID = %d, want 12", id)
+	}
+}
+
+// panickingSender panics on the first send and then records like
+// recordingSender, standing in for a handler bug
+type panickingSender struct {
+	recordingSender
+	panicked bool
+}
+
+func (p *panickingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if !p.panicked {
+		p.panicked = true
+		panic("handler bug")
+	}
+	return p.recordingSender.Send(c)
+}
+
+func TestHandleUpdateSafelySurvivesPanic(t *testing.T) {
+	s, _, _ := newTestService(t)
+	sender := &panickingSender{}
+	sh := s.shards[0]
+	sh.sender = sender
+
+	command := func(id int, text string) tgbotapi.Update {
+		return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{
+			MessageID: id,
+			From:      &tgbotapi.User{ID: 1, UserName: "carol"},
+			Chat:      &tgbotapi.Chat{ID: -100, Type: "supergroup"},
+			Text:      text,
+			Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/ping")}},
+		}}
+	}
+	s.handleUpdateSafely(context.Background(), sh, command(1, "/ping"))
+	s.handleUpdateSafely(context.Background(), sh, command(2, "/ping"))
+
+	if n := s.panics.Load(); n != 1 {
+		t.Errorf("recovered %d panics, want 1", n)
+	}
+	if sent := sender.messages(); len(sent) != 1 || sent[0].Text != "pong" {
+		t.Errorf("sent %v after the panic, want one pong", sent)
+	}
+}
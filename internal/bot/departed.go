@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// departedChatSweepInterval is how often the data of chats the bot was
+// removed from is checked for cleanup
+const departedChatSweepInterval = time.Hour
+
+// handleMyChatMember records the bot being removed from a chat, or blocked
+// in a private chat, which pauses the chat's scheduled pings. Adding the bot
+// back resumes them, as long as the chat's data wasn't cleaned up yet.
+func (s *Service) handleMyChatMember(ctx context.Context, member *tgbotapi.ChatMemberUpdated) error {
+	departed := member.NewChatMember.HasLeft() || member.NewChatMember.WasKicked()
+	if departed == (member.OldChatMember.HasLeft() || member.OldChatMember.WasKicked()) {
+		// Only permission changes, e.g. the bot was made an admin
+		return nil
+	}
+
+	log := s.logger.WithFields(map[string]interface{}{
+		"chat_id": member.Chat.ID,
+		"status":  member.NewChatMember.Status,
+	})
+	if err := s.store.SetChatDeparted(ctx, member.Chat.ID, departed, time.Unix(int64(member.Date), 0)); err != nil {
+		log.WithError(err).Error("Failed to record bot membership change")
+		return err
+	}
+
+	if departed {
+		log.Info("Bot was removed from chat, pausing its scheduled pings")
+	} else {
+		log.Info("Bot was added to chat")
+	}
+	return nil
+}
+
+// sweepDepartedChats deletes the data of chats the bot was removed from more
+// than CHAT_CLEANUP_HOURS ago, every departedChatSweepInterval until the
+// context is cancelled
+func (s *Service) sweepDepartedChats(ctx context.Context) {
+	ticker := time.NewTicker(departedChatSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.cleanupDepartedChats(ctx)
+		}
+	}
+}
+
+// cleanupDepartedChats deletes the data of the chats whose grace period ended
+func (s *Service) cleanupDepartedChats(ctx context.Context) {
+	grace := time.Duration(s.config.ChatCleanupHours) * time.Hour
+	chats, err := s.store.GetChatsDepartedBefore(ctx, time.Now().Add(-grace))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get departed chats")
+		return
+	}
+
+	for _, chatID := range chats {
+		if err := s.store.DeleteChatData(ctx, chatID); err != nil {
+			s.logger.WithError(err).WithField("chat_id", chatID).Error("Failed to delete data of departed chat")
+			continue
+		}
+		s.logger.WithField("chat_id", chatID).Info("Deleted data of departed chat")
+	}
+}
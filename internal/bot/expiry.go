@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"didactic-spork/internal/models"
+)
+
+// membershipSweepInterval is how often expired role memberships are removed
+const membershipSweepInterval = time.Minute
+
+// sweepExpiredMemberships removes expired role memberships every
+// membershipSweepInterval until the context is cancelled
+func (s *Service) sweepExpiredMemberships(ctx context.Context) {
+	ticker := time.NewTicker(membershipSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.removeExpiredMemberships(ctx)
+		}
+	}
+}
+
+// removeExpiredMemberships removes the memberships that expired and tells
+// each chat a user was added in that their membership ended
+func (s *Service) removeExpiredMemberships(ctx context.Context) {
+	expired, err := s.store.RemoveExpiredMemberships(ctx, s.shards[0].bot.Self.UserName, time.Now())
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to remove expired memberships")
+		return
+	}
+
+	for _, membership := range expired {
+		log := s.logger.WithFields(map[string]interface{}{
+			"role":       membership.Role,
+			"username":   membership.User,
+			"chat_id":    membership.ChatID,
+			"expired_at": membership.ExpiresAt,
+		})
+		log.Info("Removed expired role membership")
+
+		if membership.ChatID == 0 || !s.security.IsChatAllowed(membership.ChatID) {
+			continue
+		}
+		text := models.Msg(models.MsgMembershipExpired, s.config.Locale, membership.User, membership.Role)
+		if _, err := s.sendWithRetry(membership.ChatID, newMessage(membership.ChatID, text)); err != nil {
+			log.WithError(err).Warn("Failed to announce expired membership")
+		}
+	}
+}
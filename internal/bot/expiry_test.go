@@ -0,0 +1,28 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"didactic-spork/internal/models"
+)
+
+func TestRemoveExpiredMemberships(t *testing.T) {
+	s, sender, st := newTestService(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: "admin", ChatID: -100}
+	st.CreateRole(ctx, admin, "oncall")
+	st.AddUserToRoleWithExpiry(ctx, admin, "oncall", "alice", time.Now().Add(-time.Minute))
+	st.AddUserToRoleWithExpiry(ctx, admin, "oncall", "bob", time.Now().Add(time.Hour))
+
+	s.removeExpiredMemberships(ctx)
+
+	if users, _ := st.GetUsersInRole(ctx, "oncall"); len(users) != 1 || users[0] != "bob" {
+		t.Errorf("members = %v, want [bob]", users)
+	}
+	sent := sender.messages()
+	if len(sent) != 1 || sent[0].ChatID != -100 || sent[0].Text != `alice's membership in role 'oncall' expired\.` {
+		t.Errorf("sent %v, want one notice to chat -100 that alice's membership expired", sent)
+	}
+}
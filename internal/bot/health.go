@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/store"
+	"didactic-spork/internal/version"
+	"didactic-spork/pkg/logger"
+)
+
+// Health status values
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+)
+
+// HealthStatus is the detailed health report served as JSON
+type HealthStatus struct {
+	Status      string `json:"status"`
+	Database    string `json:"database"`
+	Telegram    string `json:"telegram,omitempty"`
+	Uptime      string `json:"uptime"`
+	BotUsername string `json:"bot_username"`
+	Roles       int    `json:"roles"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+	DBPool      DBPool `json:"db_pool"`
+	// Panics is the number of panics recovered while handling updates
+	Panics int64 `json:"panics"`
+}
+
+// DBPool reports on the database connection pool
+type DBPool struct {
+	MaxOpen      int    `json:"max_open"`
+	Open         int    `json:"open"`
+	InUse        int    `json:"in_use"`
+	Idle         int    `json:"idle"`
+	WaitCount    int64  `json:"wait_count"`
+	WaitDuration string `json:"wait_duration"`
+}
+
+// newDBPool converts sql.DBStats to a DBPool
+func newDBPool(stats sql.DBStats) DBPool {
+	return DBPool{
+		MaxOpen:      stats.MaxOpenConnections,
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration.String(),
+	}
+}
+
+// HealthChecker reports on the health of the bot and its dependencies
+type HealthChecker struct {
+	db          *sql.DB
+	store       store.Store
+	botUsername string
+	startedAt   time.Time
+	panics      func() int64
+
+	// telegram is the bot whose connection is checked, or nil to skip the
+	// check. The result is cached for telegramCheckTTL.
+	telegram        *tgbotapi.BotAPI
+	telegramMu      sync.Mutex
+	telegramChecked time.Time
+	telegramErr     error
+}
+
+// telegramCheckTTL is how long the result of a Telegram check is reused, so
+// frequent health probes don't run into Telegram's rate limits
+const telegramCheckTTL = 30 * time.Second
+
+// NewHealthChecker creates a new health checker
+func NewHealthChecker(db *sql.DB, store store.Store, botUsername string, panics func() int64) *HealthChecker {
+	return &HealthChecker{
+		db:          db,
+		store:       store,
+		botUsername: botUsername,
+		startedAt:   time.Now(),
+		panics:      panics,
+	}
+}
+
+// CheckTelegram makes the health check also confirm that the bot can reach the
+// Telegram API
+func (h *HealthChecker) CheckTelegram(bot *tgbotapi.BotAPI) {
+	h.telegram = bot
+}
+
+// Check returns an error if the bot is not healthy
+func (h *HealthChecker) Check(ctx context.Context) error {
+	if err := h.checkDatabase(ctx); err != nil {
+		return err
+	}
+	return h.checkTelegram()
+}
+
+// checkDatabase returns an error if the database can't be reached
+func (h *HealthChecker) checkDatabase(ctx context.Context) error {
+	if err := h.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	return nil
+}
+
+// checkTelegram returns an error if the Telegram API couldn't be reached
+// with the bot token on the last check. It calls getMe at most once per
+// telegramCheckTTL, and always succeeds when the check is disabled.
+func (h *HealthChecker) checkTelegram() error {
+	if h.telegram == nil {
+		return nil
+	}
+
+	h.telegramMu.Lock()
+	defer h.telegramMu.Unlock()
+	if time.Since(h.telegramChecked) >= telegramCheckTTL {
+		_, err := h.telegram.GetMe()
+		h.telegramChecked = time.Now()
+		h.telegramErr = nil
+		if err != nil {
+			h.telegramErr = fmt.Errorf("telegram unreachable: %w", err)
+		}
+	}
+	return h.telegramErr
+}
+
+// Status returns a detailed health report. The report is filled in as far as
+// possible even when an error is returned.
+func (h *HealthChecker) Status(ctx context.Context) (HealthStatus, error) {
+	status := HealthStatus{
+		Status:      StatusHealthy,
+		Database:    StatusHealthy,
+		Uptime:      time.Since(h.startedAt).Round(time.Second).String(),
+		BotUsername: h.botUsername,
+		Version:     version.Version,
+		Commit:      version.Commit,
+		DBPool:      newDBPool(h.db.Stats()),
+		Panics:      h.panics(),
+	}
+
+	// The database is still reported on when Telegram can't be reached
+	telegramErr := h.checkTelegram()
+	if h.telegram != nil {
+		status.Telegram = StatusHealthy
+		if telegramErr != nil {
+			status.Status = StatusUnhealthy
+			status.Telegram = StatusUnhealthy
+		}
+	}
+
+	if err := h.checkDatabase(ctx); err != nil {
+		status.Status = StatusUnhealthy
+		status.Database = StatusUnhealthy
+		return status, err
+	}
+
+	roles, err := h.store.GetAllRoles(ctx, false)
+	if err != nil {
+		status.Status = StatusUnhealthy
+		return status, err
+	}
+	status.Roles = len(roles)
+
+	return status, telegramErr
+}
+
+// dbPoolCheckInterval is how often watchDBPool checks the connection pool
+const dbPoolCheckInterval = time.Minute
+
+// watchDBPool warns whenever queries had to wait for a free connection since
+// the last check, which means the pool size is a bottleneck. It runs until
+// the context is cancelled.
+func watchDBPool(ctx context.Context, db *sql.DB, log *logger.Logger) {
+	ticker := time.NewTicker(dbPoolCheckInterval)
+	defer ticker.Stop()
+
+	last := db.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := db.Stats()
+			if waits := stats.WaitCount - last.WaitCount; waits > 0 {
+				log.WithFields(map[string]interface{}{
+					"waits":          waits,
+					"wait_duration":  (stats.WaitDuration - last.WaitDuration).String(),
+					"max_open":       stats.MaxOpenConnections,
+					"in_use":         stats.InUse,
+					"check_interval": dbPoolCheckInterval.String(),
+				}).Warn("Queries waited for a database connection; the pool may be too small")
+			}
+			last = stats
+		}
+	}
+}
+
+// startHealthServer starts the health check HTTP server
+func startHealthServer(port string, health *HealthChecker, log *logger.Logger) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := health.Check(r.Context()); err != nil {
+			log.WithError(err).Error("Health check failed")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "UNHEALTHY")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "HEALTHY")
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status, err := health.Status(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			log.WithError(err).Error("Health check failed")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.WithError(err).Error("Failed to write health status")
+		}
+	})
+
+	log.WithField("port", port).Info("Starting health check server")
+	if err := http.ListenAndServe(":"+port, mux); err != nil {
+		log.WithError(err).Error("Health check server failed")
+	}
+}
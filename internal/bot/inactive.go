@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/config"
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// lastSeenInterval is how often a user's last-seen time is written while
+// they keep posting; inactivity is counted in days, so hours don't matter
+const lastSeenInterval = time.Hour
+
+// inactiveSweepInterval is how often role members who stopped posting are
+// looked for
+const inactiveSweepInterval = time.Hour
+
+// recordSeen records that a user posted in a group, writing it at most once
+// per lastSeenInterval
+func (s *Service) recordSeen(ctx context.Context, message *tgbotapi.Message) {
+	from := message.From
+	if from == nil || from.IsBot || from.UserName == "" || message.Chat.IsPrivate() {
+		return
+	}
+
+	user := utils.SanitizeUsername(from.UserName)
+	now := time.Now()
+	if last, ok := s.lastSeen.Load(user); ok && now.Sub(last.(time.Time)) < lastSeenInterval {
+		return
+	}
+	s.lastSeen.Store(user, now)
+
+	if err := s.store.SetLastSeen(ctx, user, now); err != nil {
+		s.logger.WithError(err).WithField("username", user).Warn("Failed to record last seen")
+	}
+}
+
+// sweepInactiveMembers handles the role members who stopped posting every
+// inactiveSweepInterval until the context is cancelled
+func (s *Service) sweepInactiveMembers(ctx context.Context) {
+	ticker := time.NewTicker(inactiveSweepInterval)
+	defer ticker.Stop()
+
+	since := time.Now().Add(-inactiveSweepInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.handleInactiveMembers(ctx, since, now)
+			since = now
+		}
+	}
+}
+
+// handleInactiveMembers warns about or removes the role members who haven't
+// posted in a group for INACTIVE_DAYS, and tells each chat they were added
+// in. Only members who became inactive since the last sweep are warned
+// about, so each is warned once; every inactive member is removed.
+func (s *Service) handleInactiveMembers(ctx context.Context, since, now time.Time) {
+	threshold := time.Duration(s.config.InactiveDays) * 24 * time.Hour
+	remove := s.config.InactiveAction == config.InactiveActionRemove
+
+	seenAfter := since.Add(-threshold)
+	if remove {
+		seenAfter = time.Time{}
+	}
+	inactive, err := s.store.GetInactiveMemberships(ctx, seenAfter, now.Add(-threshold))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get inactive role members")
+		return
+	}
+
+	if remove {
+		actor := s.shards[0].bot.Self.UserName
+		inactive = slices.DeleteFunc(inactive, func(membership models.Membership) bool {
+			log := s.logger.WithFields(map[string]interface{}{
+				"role":     membership.Role,
+				"username": membership.User,
+				"chat_id":  membership.ChatID,
+			})
+			err := s.store.RemoveUserFromRole(ctx, models.Actor{Username: actor, ChatID: membership.ChatID}, membership.Role, membership.User)
+			if err != nil {
+				log.WithError(err).Error("Failed to remove inactive role member")
+				return true
+			}
+			log.Info("Removed inactive role member")
+			return false
+		})
+	}
+
+	// Memberships come ordered by chat and user, so each chat lists its
+	// users once with all their roles
+	var chats []int64
+	lines := make(map[int64][]string)
+	for i, membership := range inactive {
+		if i > 0 && inactive[i-1].ChatID == membership.ChatID && inactive[i-1].User == membership.User {
+			last := len(lines[membership.ChatID]) - 1
+			lines[membership.ChatID][last] = strings.TrimSuffix(lines[membership.ChatID][last], ")") + ", " + membership.Role + ")"
+			continue
+		}
+		if _, ok := lines[membership.ChatID]; !ok {
+			chats = append(chats, membership.ChatID)
+		}
+		user := membership.User
+		if !remove {
+			// Mention the members so they can speak up before an admin acts
+			user = "@" + user
+		}
+		lines[membership.ChatID] = append(lines[membership.ChatID], user+" ("+membership.Role+")")
+	}
+
+	key := models.MsgInactiveWarning
+	if remove {
+		key = models.MsgInactiveRemoved
+	}
+	for _, chatID := range chats {
+		if chatID == 0 || !s.security.IsChatAllowed(chatID) {
+			continue
+		}
+		text := models.Msg(key, s.config.Locale, s.config.InactiveDays, strings.Join(lines[chatID], "; "))
+		if _, err := s.sendWithRetry(chatID, newMessage(chatID, text)); err != nil {
+			s.logger.WithError(err).WithField("chat_id", chatID).Warn("Failed to announce inactive role members")
+		}
+	}
+}
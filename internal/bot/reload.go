@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"didactic-spork/internal/config"
+)
+
+// Reload re-reads the configuration and applies the settings that can change
+// while the bot runs: ALLOWED_CHATS, CHAT_COMMANDS, ADMIN_USERNAME, and
+// RATE_LIMIT_PER_MIN. Changes to the bot tokens or the database path need a
+// restart, so they are logged and ignored. It returns the names of the
+// applied settings that changed and of the changed settings that need a
+// restart. An invalid configuration is rejected and the running settings
+// are kept.
+func (s *Service) Reload() (changed, needRestart []string, err error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := config.Reload()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	current := s.security.Config()
+	if cfg.TelegramToken != current.TelegramToken {
+		needRestart = append(needRestart, "TELEGRAM_APITOKEN")
+	}
+	if !slices.Equal(cfg.ShardTokens, current.ShardTokens) {
+		needRestart = append(needRestart, "SHARD_TOKENS")
+	}
+	if cfg.DatabasePath != current.DatabasePath {
+		needRestart = append(needRestart, "DATABASE_PATH")
+	}
+	if len(needRestart) > 0 {
+		s.logger.WithField("settings", needRestart).Warn("Changed settings need a restart and were not applied")
+	}
+
+	// Copy the running configuration so the settings that need a restart
+	// keep their values
+	applied := *current
+	if !slices.Equal(cfg.AllowedChats, current.AllowedChats) {
+		applied.AllowedChats = cfg.AllowedChats
+		changed = append(changed, "ALLOWED_CHATS")
+		go s.checkAllowedChats(cfg.AllowedChats)
+	}
+	if !maps.EqualFunc(cfg.ChatCommands, current.ChatCommands, slices.Equal[[]string]) {
+		applied.ChatCommands = cfg.ChatCommands
+		changed = append(changed, "CHAT_COMMANDS")
+	}
+	if cfg.AdminUsername != current.AdminUsername {
+		applied.AdminUsername = cfg.AdminUsername
+		changed = append(changed, "ADMIN_USERNAME")
+	}
+	if cfg.RateLimitPerMin != current.RateLimitPerMin {
+		applied.RateLimitPerMin = cfg.RateLimitPerMin
+		changed = append(changed, "RATE_LIMIT_PER_MIN")
+	}
+
+	s.security.Reload(&applied)
+	s.logger.WithField("changed", changed).Info("Configuration reloaded")
+	return changed, needRestart, nil
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Sender sends messages to Telegram. *tgbotapi.BotAPI satisfies it; messages
+// go through this interface so sending can be exercised without a live bot.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// noRightsCooldown is how long sends to a chat are skipped after the bot
+// turned out to lack the rights to post there
+const noRightsCooldown = 10 * time.Minute
+
+// sendWithRetry sends c to a chat, retrying up to MaxRetries times when
+// Telegram asks to slow down, and returns the sent message. Every attempt
+// waits for the shard's send limiter first. If the bot lost
+// the rights to post in the chat, this is logged once and further sends to
+// the chat are skipped for a while; skipped sends return a zero message.
+func (s *Service) sendWithRetry(chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if until, ok := s.noRights.Load(chatID); ok {
+		if time.Now().Before(until.(time.Time)) {
+			return tgbotapi.Message{}, nil
+		}
+		s.noRights.Delete(chatID)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := s.limiterFor(chatID).Wait(context.Background(), chatID); err != nil {
+			return tgbotapi.Message{}, err
+		}
+		sent, err := s.senderFor(chatID).Send(c)
+		if err == nil {
+			return sent, nil
+		}
+
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) {
+			return tgbotapi.Message{}, err
+		}
+
+		switch {
+		case isMissingRights(apiErr):
+			s.noRights.Store(chatID, time.Now().Add(noRightsCooldown))
+			s.logger.WithFields(map[string]interface{}{
+				"chat_id":  chatID,
+				"error":    apiErr.Message,
+				"cooldown": noRightsCooldown.String(),
+			}).Warn("Bot can't post in chat, pausing sends")
+			return tgbotapi.Message{}, nil
+		case apiErr.RetryAfter > 0 && attempt < s.config.MaxRetries:
+			time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+		default:
+			return tgbotapi.Message{}, err
+		}
+	}
+}
+
+// isMissingRights reports whether Telegram rejected a message because the bot
+// isn't allowed to post in the chat, e.g. after being demoted or restricted
+func isMissingRights(err *tgbotapi.Error) bool {
+	message := strings.ToLower(err.Message)
+	return strings.Contains(message, "not enough rights") || strings.Contains(message, "have no rights")
+}
+
+// pinMessage pins a message without notifying the chat's members, who were
+// just pinged by it. It doesn't go through sendWithRetry: lacking the right
+// to pin must not pause every other send to the chat.
+func (s *Service) pinMessage(chatID int64, messageID int) error {
+	if err := s.limiterFor(chatID).Wait(context.Background(), chatID); err != nil {
+		return err
+	}
+	_, err := s.botFor(chatID).Request(tgbotapi.PinChatMessageConfig{
+		ChatID:              chatID,
+		MessageID:           messageID,
+		DisableNotification: true,
+	})
+	return err
+}
+
+// chatMembers returns the members of a chat the Bot API lets the bot see,
+// which is only the chat's administrators
+func (s *Service) chatMembers(chatID int64) ([]tgbotapi.User, error) {
+	admins, err := s.botFor(chatID).GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]tgbotapi.User, 0, len(admins))
+	for _, admin := range admins {
+		if admin.User != nil {
+			users = append(users, *admin.User)
+		}
+	}
+	return users, nil
+}
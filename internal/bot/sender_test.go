@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/config"
+	"didactic-spork/internal/handlers"
+	"didactic-spork/internal/middleware"
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/store/storetest"
+	"didactic-spork/pkg/logger"
+)
+
+// recordingSender is a Sender that records the messages sent through it.
+// Each send fails with the next error in errs while there are any.
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []tgbotapi.MessageConfig
+	errs []error
+}
+
+func (r *recordingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return tgbotapi.Message{}, err
+	}
+	if msg, ok := c.(tgbotapi.MessageConfig); ok {
+		r.sent = append(r.sent, msg)
+	}
+	return tgbotapi.Message{MessageID: len(r.sent)}, nil
+}
+
+// messages returns the messages sent so far
+func (r *recordingSender) messages() []tgbotapi.MessageConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]tgbotapi.MessageConfig(nil), r.sent...)
+}
+
+// newTestService creates a single-shard service that sends through a
+// recordingSender and stores data in memory
+func newTestService(t *testing.T) (*Service, *recordingSender, *storetest.MemoryStore) {
+	t.Helper()
+	cfg := &config.Config{
+		AdminUsername:   "admin",
+		Locale:          "en",
+		RateLimitPerMin: 1000,
+		ReplyToCommands: true,
+	}
+	sender := &recordingSender{}
+	st := storetest.NewMemoryStore()
+	security := middleware.NewSecurity(cfg)
+	throttle := middleware.NewChatThrottle(0)
+	log := logger.New("error", false)
+
+	return &Service{
+		shards: []*shard{{
+			bot:     &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "rolesbot"}},
+			sender:  sender,
+			limiter: middleware.NewSendLimiter(0, 0),
+		}},
+		store:    st,
+		security: security,
+		throttle: throttle,
+		handlers: handlers.NewCommands(st, security, throttle, nil, cfg, log),
+		config:   cfg,
+		logger:   log,
+	}, sender, st
+}
+
+func TestHandleRoleMentionSendsPing(t *testing.T) {
+	s, sender, st := newTestService(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: "admin", ChatID: -100}
+	st.CreateRole(ctx, admin, "devs")
+	st.AddUserToRole(ctx, admin, "devs", "alice")
+	st.AddUserToRole(ctx, admin, "devs", "bob")
+
+	text := "hey @devs, the build is red"
+	update := tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 42,
+		From:      &tgbotapi.User{ID: 1, UserName: "carol"},
+		Chat:      &tgbotapi.Chat{ID: -100, Type: "supergroup"},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "mention", Offset: strings.Index(text, "@"), Length: len("@devs")}},
+	}}
+	if err := s.handleRoleMention(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sender.messages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	msg := sent[0]
+	if msg.ChatID != -100 || msg.ReplyToMessageID != 42 || msg.ParseMode != tgbotapi.ModeMarkdownV2 {
+		t.Errorf("sent to chat %d replying to %d with parse mode %q", msg.ChatID, msg.ReplyToMessageID, msg.ParseMode)
+	}
+	for _, want := range []string{"@alice", "@bob"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("ping %q doesn't mention %s", msg.Text, want)
+		}
+	}
+}
+
+func TestSendTextSplitsLongMessages(t *testing.T) {
+	s, sender, _ := newTestService(t)
+
+	text := strings.Repeat("word ", maxMessageLength/2)
+	if err := s.sendText(-100, 7, text); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sender.messages()
+	if len(sent) < 2 {
+		t.Fatalf("sent %d messages, want the text split", len(sent))
+	}
+	for i, msg := range sent {
+		if len(msg.Text) > maxMessageLength {
+			t.Errorf("message %d is %d characters long", i, len(msg.Text))
+		}
+		if want := map[bool]int{true: 7, false: 0}[i == 0]; msg.ReplyToMessageID != want {
+			t.Errorf("message %d replies to %d, want %d", i, msg.ReplyToMessageID, want)
+		}
+	}
+}
+
+func TestSendWithRetryPausesChatWithoutRights(t *testing.T) {
+	s, sender, _ := newTestService(t)
+	sender.errs = []error{&tgbotapi.Error{Code: 400, Message: "Bad Request: not enough rights to send text messages to the chat"}}
+
+	if _, err := s.sendWithRetry(-100, newMessage(-100, "first")); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if _, err := s.sendWithRetry(-100, newMessage(-100, "second")); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+	if sent := sender.messages(); len(sent) != 0 {
+		t.Errorf("sent %d messages to a chat without rights, want 0", len(sent))
+	}
+
+	// Other chats are unaffected
+	if _, err := s.sendWithRetry(-200, newMessage(-200, "other")); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sender.messages(); len(sent) != 1 || sent[0].ChatID != -200 {
+		t.Errorf("sent %v, want one message to chat -200", sent)
+	}
+}
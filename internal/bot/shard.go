@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/middleware"
+)
+
+// shard is one bot token with its own update loop. Every bot is a member of
+// every group, but each group is served by exactly one of them.
+type shard struct {
+	index int
+	bot   *tgbotapi.BotAPI
+	// sender sends the messages of this shard, normally through bot
+	sender Sender
+	// limiter paces the messages of this shard; Telegram's limits apply
+	// to each bot separately
+	limiter *middleware.SendLimiter
+
+	// resumeAfter is the ID of the last update handled before the bot started
+	resumeAfter int
+	// lastUpdateID is the highest update ID handled so far, and savedUpdateID
+	// the one last written to the database
+	lastUpdateID  atomic.Int64
+	savedUpdateID int64
+}
+
+// shardUpdate is an update together with the shard that received it
+type shardUpdate struct {
+	shard  *shard
+	update tgbotapi.Update
+}
+
+// ShardFor returns the index of the shard that serves a chat. Groups are
+// spread across shards by a hash of the chat ID, so a chat always maps to the
+// same shard for a given number of shards. Private chats have positive IDs
+// and always use the first shard, since users start a conversation with only
+// one of the bots.
+func ShardFor(chatID int64, shards int) int {
+	if shards <= 1 || chatID > 0 {
+		return 0
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(chatID))
+	h := fnv.New32a()
+	h.Write(buf[:])
+	return int(h.Sum32() % uint32(shards))
+}
+
+// botFor returns the bot that serves a chat
+func (s *Service) botFor(chatID int64) *tgbotapi.BotAPI {
+	return s.shards[ShardFor(chatID, len(s.shards))].bot
+}
+
+// senderFor returns the sender of the shard that serves a chat
+func (s *Service) senderFor(chatID int64) Sender {
+	return s.shards[ShardFor(chatID, len(s.shards))].sender
+}
+
+// limiterFor returns the send limiter of the shard that serves a chat
+func (s *Service) limiterFor(chatID int64) *middleware.SendLimiter {
+	return s.shards[ShardFor(chatID, len(s.shards))].limiter
+}
+
+// updateChatID returns the ID of the chat an update belongs to, or 0
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.Chat.ID
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	default:
+		return 0
+	}
+}
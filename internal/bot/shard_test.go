@@ -0,0 +1,34 @@
+package bot
+
+import "testing"
+
+func TestShardFor(t *testing.T) {
+	const shards = 4
+	used := make(map[int]bool)
+	for i := int64(1); i <= 200; i++ {
+		chatID := -1000000000000 - i*7919
+		shard := ShardFor(chatID, shards)
+		if shard < 0 || shard >= shards {
+			t.Fatalf("ShardFor(%d, %d) = %d, out of range", chatID, shards, shard)
+		}
+		for j := 0; j < 3; j++ {
+			if again := ShardFor(chatID, shards); again != shard {
+				t.Fatalf("ShardFor(%d, %d) returned %d and then %d", chatID, shards, shard, again)
+			}
+		}
+		used[shard] = true
+	}
+	if len(used) != shards {
+		t.Errorf("200 groups only used shards %v", used)
+	}
+
+	// Private chats and a single bot always use the first shard
+	for _, tt := range []struct {
+		chatID int64
+		shards int
+	}{{42, shards}, {1 << 40, shards}, {-100123, 1}, {-100123, 0}} {
+		if got := ShardFor(tt.chatID, tt.shards); got != 0 {
+			t.Errorf("ShardFor(%d, %d) = %d, want 0", tt.chatID, tt.shards, got)
+		}
+	}
+}
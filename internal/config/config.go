@@ -2,12 +2,43 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
+
+	"didactic-spork/pkg/utils"
+)
+
+// Rate limit stores
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStoreDatabase = "database"
+)
+
+// Where admin command responses are sent
+const (
+	AdminRepliesGroup   = "group"
+	AdminRepliesPrivate = "private"
+	AdminRepliesBoth    = "both"
+)
+
+// How role pings mention members
+const (
+	PingStyleAll     = "all"
+	PingStyleSummary = "summary"
+)
+
+// What happens to role members who stopped posting
+const (
+	InactiveActionWarn   = "warn"
+	InactiveActionRemove = "remove"
 )
 
 // Config holds all configuration for the bot
@@ -22,8 +53,102 @@ type Config struct {
 	AllowedChats    []int64
 	RateLimitPerMin int
 	HealthPort      string
+	WorkerCount     int
+	// PingThrottleMs is the minimum delay between ping messages in a chat
+	PingThrottleMs int
+	// PingStyle is "all" to mention every member of a pinged role, or
+	// "summary" to mention up to PingSummaryLimit and count the rest
+	PingStyle        string
+	PingSummaryLimit int
+	// SendRatePerSec caps the messages each bot sends per second across all
+	// chats, and GroupSendIntervalMs is the minimum delay between any two
+	// messages in a group; zero disables either limit
+	SendRatePerSec      int
+	GroupSendIntervalMs int
+	// MembersCacheSec is how long the members of a pinged role are kept in
+	// memory, for up to MembersCacheSize roles; zero disables the cache
+	MembersCacheSec  int
+	MembersCacheSize int
+	// DatabaseReadPath is a read-only copy of the database, e.g. a replica,
+	// that role lookups for pings are read from; empty reads DatabasePath
+	DatabaseReadPath string
+	// PruneDepartedUsers removes users from all roles when they leave a chat
+	PruneDepartedUsers bool
+	// AutoLeaveUnauthorized makes the bot leave groups that aren't in AllowedChats
+	AutoLeaveUnauthorized bool
+	// RateLimitStore is where rate limits are kept: "memory" or "database",
+	// which keeps limits across restarts
+	RateLimitStore string
+	// AdminReplies is where responses to admin commands go: "group",
+	// "private" to the admin who ran the command, or "both"
+	AdminReplies string
+	// MaxRoles caps how many roles can exist across all chats; zero means
+	// unlimited
+	MaxRoles int
+	// ReservedRoleNames are role names that can't be created, such as "everyone"
+	ReservedRoleNames []string
+	// RoleNamePattern is a naming convention new role names must match in
+	// full, ignoring case, such as "team-.+"; empty allows any name
+	RoleNamePattern string
+	// BannedWords are lowercase substrings that role names and custom ping
+	// messages may not contain, from BANNED_WORDS and BANNED_WORDS_FILE
+	BannedWords []string
+	// ChatCommands restricts chats to the listed commands; chats that aren't
+	// listed allow every command
+	ChatCommands map[int64][]string
+	// EveryoneKeywords are mentions, such as @everyone, that ping all known users
+	EveryoneKeywords []string
+	// Locale selects the language of bot responses, e.g. "en" or "es"
+	Locale string
+	// Timezone is the IANA zone timestamps are shown in, e.g. "Europe/Madrid"
+	Timezone string
+	// FeedbackChatID is the chat /feedback is forwarded to; zero disables it
+	FeedbackChatID int64
+	// ShardTokens are extra bot tokens; groups are split across
+	// TelegramToken and these to spread the load
+	ShardTokens []string
+	// DBJournalMode, DBSynchronous, and DBCacheSize set the SQLite pragmas
+	// of the same names
+	DBJournalMode string
+	DBSynchronous string
+	DBCacheSize   int
+	// DBBusyTimeoutMs is how long SQLite waits for a lock before failing
+	// with "database is locked"
+	DBBusyTimeoutMs int
+	// BackupDir is where scheduled database backups are written
+	BackupDir string
+	// BackupSchedule is a cron spec for backups to BackupDir; empty disables them
+	BackupSchedule string
+	// HealthCheckTelegram makes the health check also confirm that the
+	// Telegram API is reachable with the bot token
+	HealthCheckTelegram bool
+	// ChatCleanupHours is how long after the bot is removed from a chat the
+	// chat's scheduled pings and ping template are deleted; zero keeps them
+	ChatCleanupHours int
+	// ReplyToCommands sends responses to commands and role mentions as
+	// replies to the triggering message
+	ReplyToCommands bool
+	// BlockBotUsernames keeps bots out of roles: usernames ending in "bot"
+	// can't be added and are left out of pings
+	BlockBotUsernames bool
+	// InactiveDays is how many days without posting make a role member
+	// inactive; zero disables the check. InactiveAction is "warn" to tell
+	// the chat about them or "remove" to take them out of their roles.
+	InactiveDays   int
+	InactiveAction string
+
+	// problems are settings that couldn't be parsed, reported by Validate
+	// along with the rest
+	problems []error
 }
 
+// journalModes and synchronousModes are the accepted values of
+// DB_JOURNAL_MODE and DB_SYNCHRONOUS
+var (
+	journalModes     = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	synchronousModes = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if exists
@@ -31,39 +156,232 @@ func Load() (*Config, error) {
 		fmt.Printf("Warning: Error loading .env file: %v\n", err)
 	}
 
+	return fromEnv()
+}
+
+// Reload loads the configuration again while the bot runs. Values in the
+// .env file replace those read before, so edits to the file take effect.
+func Reload() (*Config, error) {
+	if err := godotenv.Overload(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env file: %w", err)
+	}
+
+	return fromEnv()
+}
+
+// fromEnv builds and validates the configuration from environment variables
+func fromEnv() (*Config, error) {
+	var problems []error
 	config := &Config{
-		TelegramToken:   os.Getenv("TELEGRAM_APITOKEN"),
 		AdminUsername:   os.Getenv("ADMIN_USERNAME"),
 		DatabasePath:    getEnvOrDefault("DATABASE_PATH", "bot.db"),
 		LogLevel:        getEnvOrDefault("LOG_LEVEL", "info"),
 		Env:             getEnvOrDefault("ENV", "development"),
-		MaxRetries:      getEnvIntOrDefault("MAX_RETRIES", 3),
-		UpdateTimeout:   getEnvIntOrDefault("UPDATE_TIMEOUT", 60),
-		RateLimitPerMin: getEnvIntOrDefault("RATE_LIMIT_PER_MIN", 30),
+		MaxRetries:      getEnvIntOrDefault("MAX_RETRIES", 3, &problems),
+		UpdateTimeout:   getEnvIntOrDefault("UPDATE_TIMEOUT", 60, &problems),
+		RateLimitPerMin: getEnvIntOrDefault("RATE_LIMIT_PER_MIN", 30, &problems),
 		HealthPort:      getEnvOrDefault("HEALTH_PORT", "8080"),
+		WorkerCount:     getEnvIntOrDefault("WORKER_COUNT", 4, &problems),
+		PingThrottleMs:  getEnvIntOrDefault("PING_THROTTLE_MS", 2000, &problems),
+		SendRatePerSec:  getEnvIntOrDefault("SEND_RATE_PER_SEC", 30, &problems),
+		MaxRoles:        getEnvIntOrDefault("MAX_ROLES", 0, &problems),
+		RateLimitStore:  strings.ToLower(getEnvOrDefault("RATE_LIMIT_STORE", RateLimitStoreMemory)),
+		AdminReplies:    strings.ToLower(getEnvOrDefault("ADMIN_REPLIES", AdminRepliesGroup)),
+		PingStyle:       strings.ToLower(getEnvOrDefault("PING_STYLE", PingStyleAll)),
+		InactiveAction:  strings.ToLower(getEnvOrDefault("INACTIVE_ACTION", InactiveActionWarn)),
+		Locale:          strings.ToLower(getEnvOrDefault("LOCALE", "en")),
+		Timezone:        getEnvOrDefault("TIMEZONE", "UTC"),
+		DBJournalMode:   strings.ToUpper(getEnvOrDefault("DB_JOURNAL_MODE", "WAL")),
+		DBSynchronous:   strings.ToUpper(getEnvOrDefault("DB_SYNCHRONOUS", "NORMAL")),
+		DBCacheSize:     getEnvIntOrDefault("DB_CACHE_SIZE", 1000, &problems),
+		DBBusyTimeoutMs: getEnvIntOrDefault("DB_BUSY_TIMEOUT_MS", 5000, &problems),
+		BackupDir:       os.Getenv("BACKUP_DIR"),
+		BackupSchedule:  strings.TrimSpace(os.Getenv("BACKUP_SCHEDULE")),
+
+		PruneDepartedUsers:    getEnvBoolOrDefault("PRUNE_DEPARTED_USERS", false, &problems),
+		AutoLeaveUnauthorized: getEnvBoolOrDefault("AUTO_LEAVE_UNAUTHORIZED", false, &problems),
+		HealthCheckTelegram:   getEnvBoolOrDefault("HEALTH_CHECK_TELEGRAM", false, &problems),
+		ReplyToCommands:       getEnvBoolOrDefault("REPLY_TO_COMMANDS", true, &problems),
+		BlockBotUsernames:     getEnvBoolOrDefault("BLOCK_BOT_USERNAMES", true, &problems),
+		ChatCleanupHours:      getEnvIntOrDefault("CHAT_CLEANUP_HOURS", 0, &problems),
+		PingSummaryLimit:      getEnvIntOrDefault("PING_SUMMARY_LIMIT", 20, &problems),
+		GroupSendIntervalMs:   getEnvIntOrDefault("GROUP_SEND_INTERVAL_MS", 1000, &problems),
+		MembersCacheSec:       getEnvIntOrDefault("MEMBERS_CACHE_SEC", 30, &problems),
+		MembersCacheSize:      getEnvIntOrDefault("MEMBERS_CACHE_SIZE", 500, &problems),
+		DatabaseReadPath:      os.Getenv("DATABASE_READ_PATH"),
+		InactiveDays:          getEnvIntOrDefault("INACTIVE_DAYS", 0, &problems),
+	}
+
+	// Tokens may come from files, e.g. Docker or Kubernetes secrets
+	config.TelegramToken = getSecret("TELEGRAM_APITOKEN", &problems)
+	shardTokens := getSecret("SHARD_TOKENS", &problems)
+
+	// Tokens are case-sensitive, unlike the other lists
+	for _, token := range strings.Split(shardTokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			config.ShardTokens = append(config.ShardTokens, token)
+		}
+	}
+
+	config.ReservedRoleNames = getEnvListOrDefault("RESERVED_ROLE_NAMES", "everyone,all,here,admin")
+	config.EveryoneKeywords = getEnvListOrDefault("EVERYONE_KEYWORDS", "everyone,here")
+
+	config.BannedWords = getEnvListOrDefault("BANNED_WORDS", "")
+	if path := os.Getenv("BANNED_WORDS_FILE"); path != "" {
+		words, err := readWordList(path)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("BANNED_WORDS_FILE could not be read: %w", err))
+		}
+		config.BannedWords = utils.Unique(append(config.BannedWords, words...))
+	}
+
+	config.RoleNamePattern = strings.TrimSpace(os.Getenv("ROLE_NAME_PATTERN"))
+	if _, err := regexp.Compile(config.RoleNamePattern); err != nil {
+		problems = append(problems, fmt.Errorf("ROLE_NAME_PATTERN must be a regular expression, got %q: %w", config.RoleNamePattern, err))
 	}
 
 	// Parse allowed chats
 	if allowedChatsStr := os.Getenv("ALLOWED_CHATS"); allowedChatsStr != "" {
 		chats := strings.Split(allowedChatsStr, ",")
 		for _, chat := range chats {
-			if chatID, err := strconv.ParseInt(strings.TrimSpace(chat), 10, 64); err == nil {
-				config.AllowedChats = append(config.AllowedChats, chatID)
+			if chat = strings.TrimSpace(chat); chat == "" {
+				continue
 			}
+			chatID, err := strconv.ParseInt(chat, 10, 64)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("ALLOWED_CHATS entries must be chat IDs, got %q", chat))
+				continue
+			}
+			config.AllowedChats = append(config.AllowedChats, chatID)
 		}
 	}
 
-	// Validate required fields
-	if config.TelegramToken == "" {
-		return nil, fmt.Errorf("TELEGRAM_APITOKEN is required")
+	if feedbackChat := os.Getenv("FEEDBACK_CHAT_ID"); feedbackChat != "" {
+		chatID, err := strconv.ParseInt(strings.TrimSpace(feedbackChat), 10, 64)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("FEEDBACK_CHAT_ID must be a chat ID, got %q", feedbackChat))
+		}
+		config.FeedbackChatID = chatID
 	}
-	if config.AdminUsername == "" {
-		return nil, fmt.Errorf("ADMIN_USERNAME is required")
+
+	config.ChatCommands = parseChatCommands(os.Getenv("CHAT_COMMANDS"), &problems)
+
+	if config.WorkerCount < 1 {
+		config.WorkerCount = 1
+	}
+
+	config.problems = problems
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
+// logLevels are the accepted values of LOG_LEVEL
+var logLevels = []string{"trace", "debug", "info", "warn", "warning", "error", "fatal", "panic"}
+
+// Validate checks the configuration and returns an error listing every problem
+// found, so they can all be fixed at once
+func (c *Config) Validate() error {
+	problems := slices.Clone(c.problems)
+
+	if c.TelegramToken == "" {
+		problems = append(problems, fmt.Errorf("TELEGRAM_APITOKEN or TELEGRAM_APITOKEN_FILE is required"))
+	}
+	if c.AdminUsername == "" {
+		problems = append(problems, fmt.Errorf("ADMIN_USERNAME is required"))
+	}
+	if port, err := strconv.Atoi(c.HealthPort); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Errorf("HEALTH_PORT must be a port number between 1 and 65535, got %q", c.HealthPort))
+	}
+	if c.UpdateTimeout <= 0 {
+		problems = append(problems, fmt.Errorf("UPDATE_TIMEOUT must be positive, got %d", c.UpdateTimeout))
+	}
+	if c.RateLimitPerMin <= 0 {
+		problems = append(problems, fmt.Errorf("RATE_LIMIT_PER_MIN must be positive, got %d", c.RateLimitPerMin))
+	}
+	if c.RateLimitStore != RateLimitStoreMemory && c.RateLimitStore != RateLimitStoreDatabase {
+		problems = append(problems, fmt.Errorf("RATE_LIMIT_STORE must be %q or %q, got %q", RateLimitStoreMemory, RateLimitStoreDatabase, c.RateLimitStore))
+	}
+	if c.AdminReplies != AdminRepliesGroup && c.AdminReplies != AdminRepliesPrivate && c.AdminReplies != AdminRepliesBoth {
+		problems = append(problems, fmt.Errorf("ADMIN_REPLIES must be %q, %q, or %q, got %q", AdminRepliesGroup, AdminRepliesPrivate, AdminRepliesBoth, c.AdminReplies))
+	}
+	if c.PingStyle != PingStyleAll && c.PingStyle != PingStyleSummary {
+		problems = append(problems, fmt.Errorf("PING_STYLE must be %q or %q, got %q", PingStyleAll, PingStyleSummary, c.PingStyle))
+	}
+	if c.PingStyle == PingStyleSummary && c.PingSummaryLimit < 1 {
+		problems = append(problems, fmt.Errorf("PING_SUMMARY_LIMIT must be positive, got %d", c.PingSummaryLimit))
+	}
+	if !utils.Contains(journalModes, c.DBJournalMode) {
+		problems = append(problems, fmt.Errorf("DB_JOURNAL_MODE must be one of %s, got %q", strings.Join(journalModes, ", "), c.DBJournalMode))
+	}
+	if !utils.Contains(synchronousModes, c.DBSynchronous) {
+		problems = append(problems, fmt.Errorf("DB_SYNCHRONOUS must be one of %s, got %q", strings.Join(synchronousModes, ", "), c.DBSynchronous))
+	}
+	if c.SendRatePerSec < 0 {
+		problems = append(problems, fmt.Errorf("SEND_RATE_PER_SEC must not be negative, got %d", c.SendRatePerSec))
+	}
+	if c.GroupSendIntervalMs < 0 {
+		problems = append(problems, fmt.Errorf("GROUP_SEND_INTERVAL_MS must not be negative, got %d", c.GroupSendIntervalMs))
+	}
+	if c.MembersCacheSec < 0 {
+		problems = append(problems, fmt.Errorf("MEMBERS_CACHE_SEC must not be negative, got %d", c.MembersCacheSec))
+	}
+	if c.MembersCacheSize < 0 {
+		problems = append(problems, fmt.Errorf("MEMBERS_CACHE_SIZE must not be negative, got %d", c.MembersCacheSize))
+	}
+	if c.ChatCleanupHours < 0 {
+		problems = append(problems, fmt.Errorf("CHAT_CLEANUP_HOURS must not be negative, got %d", c.ChatCleanupHours))
+	}
+	if c.InactiveDays < 0 {
+		problems = append(problems, fmt.Errorf("INACTIVE_DAYS must not be negative, got %d", c.InactiveDays))
+	}
+	if c.InactiveAction != InactiveActionWarn && c.InactiveAction != InactiveActionRemove {
+		problems = append(problems, fmt.Errorf("INACTIVE_ACTION must be %q or %q, got %q", InactiveActionWarn, InactiveActionRemove, c.InactiveAction))
+	}
+	if c.DBBusyTimeoutMs < 0 {
+		problems = append(problems, fmt.Errorf("DB_BUSY_TIMEOUT_MS must not be negative, got %d", c.DBBusyTimeoutMs))
+	}
+	if c.BackupSchedule != "" {
+		if c.BackupDir == "" {
+			problems = append(problems, fmt.Errorf("BACKUP_SCHEDULE requires BACKUP_DIR"))
+		}
+		if _, err := cron.ParseStandard(c.BackupSchedule); err != nil {
+			problems = append(problems, fmt.Errorf("BACKUP_SCHEDULE must be a cron spec, got %q: %w", c.BackupSchedule, err))
+		}
+	}
+	if !isLogLevel(c.LogLevel) {
+		problems = append(problems, fmt.Errorf("LOG_LEVEL must be one of %s, got %q", strings.Join(logLevels, ", "), c.LogLevel))
+	}
+	seen := map[string]bool{c.TelegramToken: true}
+	for i, token := range c.ShardTokens {
+		if seen[token] {
+			problems = append(problems, fmt.Errorf("SHARD_TOKENS entry %d repeats a token already in use", i+1))
+		}
+		seen[token] = true
+	}
+	for _, chatID := range c.AllowedChats {
+		if chatID == 0 {
+			problems = append(problems, fmt.Errorf("ALLOWED_CHATS contains 0, which is not a valid chat ID"))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+func isLogLevel(level string) bool {
+	for _, known := range logLevels {
+		if strings.EqualFold(level, known) {
+			return true
+		}
+	}
+	return false
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -71,11 +389,109 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getEnvIntOrDefault(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// parseChatCommands parses per-chat command lists of the form
+// "chatID:cmd1,cmd2;chatID:cmd3". Malformed entries are added to problems.
+func parseChatCommands(value string, problems *[]error) map[int64][]string {
+	chatCommands := make(map[int64][]string)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		chat, commands, ok := strings.Cut(entry, ":")
+		chatID, err := strconv.ParseInt(strings.TrimSpace(chat), 10, 64)
+		if !ok || err != nil {
+			*problems = append(*problems, fmt.Errorf("CHAT_COMMANDS entry %q must look like chatID:command1,command2", entry))
+			continue
+		}
+
+		for _, command := range strings.Split(commands, ",") {
+			command = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(command)), "/")
+			if command != "" {
+				chatCommands[chatID] = append(chatCommands[chatID], command)
+			}
 		}
 	}
-	return defaultValue
+	return chatCommands
+}
+
+// getEnvListOrDefault parses a comma-separated list of lowercase names
+func getEnvListOrDefault(key, defaultValue string) []string {
+	var list []string
+	for _, name := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// readWordList reads a file with one entry per line, lowercased. Blank lines
+// and lines starting with # are skipped.
+func readWordList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, nil
+}
+
+// getSecret returns the value of a sensitive environment variable. When it
+// is unset, the value is read from the file named by the same variable with
+// a _FILE suffix, which is how orchestrators usually hand out secrets. A
+// file that can't be read is added to problems.
+func getSecret(key string, problems *[]error) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("%s_FILE could not be read: %w", key, err))
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getEnvIntOrDefault returns an integer setting, or defaultValue when it is
+// unset. A value that isn't an integer is added to problems.
+func getEnvIntOrDefault(key string, defaultValue int, problems *[]error) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("%s must be an integer, got %q", key, value))
+		return defaultValue
+	}
+	return intValue
+}
+
+// getEnvBoolOrDefault returns a boolean setting, or defaultValue when it is
+// unset. A value that isn't a boolean is added to problems.
+func getEnvBoolOrDefault(key string, defaultValue bool, problems *[]error) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("%s must be true or false, got %q", key, value))
+		return defaultValue
+	}
+	return boolValue
 }
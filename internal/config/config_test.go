@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setEnv sets the required settings and then the given ones for the test
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Setenv("TELEGRAM_APITOKEN", "123:abc")
+	t.Setenv("ADMIN_USERNAME", "admin")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	setEnv(t, map[string]string{
+		"ALLOWED_CHATS": "-100, 42,",
+		"WORKER_COUNT":  "8",
+	})
+
+	config, err := fromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.AllowedChats) != 2 || config.AllowedChats[0] != -100 || config.AllowedChats[1] != 42 {
+		t.Errorf("AllowedChats = %v, want [-100 42]", config.AllowedChats)
+	}
+	if config.WorkerCount != 8 {
+		t.Errorf("WorkerCount = %d, want 8", config.WorkerCount)
+	}
+}
+
+func TestFromEnvTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("456:def\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, map[string]string{
+		"TELEGRAM_APITOKEN":      "",
+		"TELEGRAM_APITOKEN_FILE": path,
+	})
+
+	config, err := fromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TelegramToken != "456:def" {
+		t.Errorf("TelegramToken = %q from the file, want %q", config.TelegramToken, "456:def")
+	}
+
+	// The variable itself wins over the file
+	t.Setenv("TELEGRAM_APITOKEN", "123:abc")
+	if config, err = fromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if config.TelegramToken != "123:abc" {
+		t.Errorf("TelegramToken = %q with both set, want %q", config.TelegramToken, "123:abc")
+	}
+}
+
+func TestFromEnvReportsEveryProblem(t *testing.T) {
+	setEnv(t, map[string]string{
+		"ALLOWED_CHATS":        "-100,general",
+		"WORKER_COUNT":         "four",
+		"PRUNE_DEPARTED_USERS": "sometimes",
+		"LOG_LEVEL":            "loud",
+		"ROLE_NAME_PATTERN":    "team-(",
+		"FEEDBACK_CHAT_ID":     "@feedback",
+		"CHAT_COMMANDS":        "-100:ping;ops",
+		"BANNED_WORDS_FILE":    filepath.Join(t.TempDir(), "missing.txt"),
+		"SHARD_TOKENS_FILE":    filepath.Join(t.TempDir(), "missing.txt"),
+	})
+
+	_, err := fromEnv()
+	if err == nil {
+		t.Fatal("invalid configuration was accepted")
+	}
+	for _, want := range []string{
+		`ALLOWED_CHATS entries must be chat IDs, got "general"`,
+		`WORKER_COUNT must be an integer, got "four"`,
+		`PRUNE_DEPARTED_USERS must be true or false, got "sometimes"`,
+		`LOG_LEVEL must be one of`,
+		`ROLE_NAME_PATTERN must be a regular expression, got "team-("`,
+		`FEEDBACK_CHAT_ID must be a chat ID, got "@feedback"`,
+		`CHAT_COMMANDS entry "ops" must look like chatID:command1,command2`,
+		`BANNED_WORDS_FILE could not be read`,
+		`SHARD_TOKENS_FILE could not be read`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %q", err, want)
+		}
+	}
+}
@@ -3,15 +3,31 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// Options holds the SQLite settings applied to every connection
+type Options struct {
+	JournalMode   string
+	Synchronous   string
+	CacheSize     int
+	BusyTimeoutMs int
+}
+
 // New initializes the database and creates tables if they don't exist
-func New(dataSourceName string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dataSourceName+"?_journal_mode=WAL&_synchronous=NORMAL&_cache_size=1000&_foreign_keys=ON")
+func New(dataSourceName string, opts Options) (*sql.DB, error) {
+	// Transactions take the write lock when they begin, so they wait for the
+	// busy timeout instead of failing when a read turns into a write
+	dsn := fmt.Sprintf("%s?_journal_mode=%s&_synchronous=%s&_cache_size=%d&_busy_timeout=%d&_txlock=immediate&_foreign_keys=ON",
+		dataSourceName, opts.JournalMode, opts.Synchronous, opts.CacheSize, opts.BusyTimeoutMs)
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -21,8 +37,13 @@ func New(dataSourceName string) (*sql.DB, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(time.Hour)
 
-	// Test connection
+	// Test connection. Setting the journal mode writes to the file, so a
+	// read-only one can already fail here.
 	if err := db.Ping(); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+			return nil, fmt.Errorf("database is not writable (check DATABASE_PATH and its permissions): %w", err)
+		}
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -31,15 +52,117 @@ func New(dataSourceName string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	// Add columns missing from tables created by older versions
+	if err := migrateColumns(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
+	// Usernames are case-insensitive; merge users recorded with different casing
+	if err := mergeCaseDuplicateUsers(db); err != nil {
+		return nil, fmt.Errorf("failed to merge duplicate users: %w", err)
+	}
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name_nocase ON users(name COLLATE NOCASE)"); err != nil {
+		return nil, fmt.Errorf("failed to create case-insensitive username index: %w", err)
+	}
+
+	// Enforce case-insensitive role name uniqueness regardless of which code
+	// path inserts the role, once roles recorded with different casing are merged
+	if err := mergeCaseDuplicateRoles(db); err != nil {
+		return nil, fmt.Errorf("failed to merge duplicate roles: %w", err)
+	}
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name_nocase ON roles(name COLLATE NOCASE)"); err != nil {
+		return nil, fmt.Errorf("failed to create case-insensitive role index: %w", err)
+	}
+
+	// Fail now rather than on the first command if writes aren't possible
+	if err := checkWritable(db); err != nil {
+		return nil, fmt.Errorf("database is not writable (check DATABASE_PATH and its permissions): %w", err)
+	}
+
 	return db, nil
 }
 
+// OpenReadOnly opens an existing database for reads only, e.g. a replica of
+// the database opened with New. Tables are neither created nor migrated, so
+// the schema must already be there.
+func OpenReadOnly(dataSourceName string, opts Options) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?mode=ro&_query_only=true&_cache_size=%d&_busy_timeout=%d",
+		dataSourceName, opts.CacheSize, opts.BusyTimeoutMs)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(time.Hour)
+
+	// Opening is lazy; make sure the file is there and has the tables
+	if _, err := db.Exec("SELECT 1 FROM role_users LIMIT 1"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Check confirms that New would succeed on a database without changing it:
+// an existing file must open and accept writes, which are rolled back, and a
+// missing one needs its directory to exist, since New creates it.
+func Check(dataSourceName string, opts Options) error {
+	if _, err := os.Stat(dataSourceName); errors.Is(err, fs.ErrNotExist) {
+		dir := filepath.Dir(dataSourceName)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("directory %s does not exist", dir)
+		}
+		return nil
+	}
+
+	dsn := fmt.Sprintf("file:%s?mode=rw&_busy_timeout=%d", dataSourceName, opts.BusyTimeoutMs)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("CREATE TABLE check_writable (id INTEGER)"); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+	return nil
+}
+
+// checkWritable makes a trivial write in a transaction and rolls it back.
+// Opening and creating tables can succeed on a read-only file when the tables
+// already exist.
+func checkWritable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO bot_state (key, value) VALUES ('write_check', 0)")
+	return err
+}
+
 // createTables creates the necessary database tables
 func createTables(db *sql.DB) error {
 	createTableSQL := `
 	CREATE TABLE IF NOT EXISTS roles (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL UNIQUE,
+		category TEXT,
+		archived INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT NOT NULL DEFAULT '',
+		oncall_index INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -47,22 +170,330 @@ func createTables(db *sql.DB) error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL UNIQUE,
 		telegram_id INTEGER UNIQUE,
+		first_name TEXT NOT NULL DEFAULT '',
+		last_name TEXT NOT NULL DEFAULT '',
+		dnd_start INTEGER,
+		dnd_end INTEGER,
+		dnd_timezone TEXT NOT NULL DEFAULT '',
+		last_seen_at INTEGER, -- Unix milliseconds; NULL until the user posts
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE TABLE IF NOT EXISTS role_users (
 		role_id INTEGER,
 		user_id INTEGER,
+		chat_id INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER, -- Unix milliseconds; NULL never expires
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
 		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
 		PRIMARY KEY(role_id, user_id)
 	);
+	CREATE TABLE IF NOT EXISTS muted_roles (
+		role_id INTEGER,
+		user_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+		PRIMARY KEY(role_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		role TEXT NOT NULL,
+		target_user TEXT NOT NULL DEFAULT '',
+		chat_id INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS scheduled_pings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		cron_spec TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS ping_templates (
+		chat_id INTEGER PRIMARY KEY,
+		template TEXT NOT NULL,
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS command_aliases (
+		alias TEXT PRIMARY KEY,
+		command TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS admins (
+		username TEXT PRIMARY KEY COLLATE NOCASE,
+		added_by TEXT NOT NULL DEFAULT '',
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS departed_chats (
+		chat_id INTEGER PRIMARY KEY,
+		left_at INTEGER NOT NULL -- Unix milliseconds
+	);
+	CREATE TABLE IF NOT EXISTS bot_state (
+		key TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS rate_events (
+		user_id INTEGER NOT NULL,
+		occurred_at INTEGER NOT NULL -- Unix milliseconds
+	);
+	CREATE TABLE IF NOT EXISTS command_log (
+		command TEXT NOT NULL,
+		chat_id INTEGER NOT NULL,
+		used_at INTEGER NOT NULL -- Unix milliseconds
+	);
 	CREATE INDEX IF NOT EXISTS idx_roles_name ON roles(name);
 	CREATE INDEX IF NOT EXISTS idx_users_name ON users(name);
 	CREATE INDEX IF NOT EXISTS idx_users_telegram_id ON users(telegram_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_role ON audit_log(role, created_at);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_pings_chat ON scheduled_pings(chat_id);
+	CREATE INDEX IF NOT EXISTS idx_rate_events_occurred_at ON rate_events(occurred_at);
+	CREATE INDEX IF NOT EXISTS idx_command_log_used_at ON command_log(used_at);
 	`
 
 	_, err := db.Exec(createTableSQL)
 	return err
 }
+
+// mergeCaseDuplicateUsers merges users whose names differ only by case, such
+// as "JohnDoe" and "johndoe", which older versions could record as separate
+// users. The lowercase user is kept, or the oldest one if there is none; the
+// others' role memberships, mutes, and Telegram ID move to it. Finally all
+// usernames are lowercased, as they are everywhere else.
+func mergeCaseDuplicateUsers(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT u.id, (
+			SELECT k.id FROM users k
+			WHERE LOWER(k.name) = LOWER(u.name)
+			ORDER BY k.name = LOWER(k.name) DESC, k.id
+			LIMIT 1
+		)
+		FROM users u
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate users: %w", err)
+	}
+	duplicates := make(map[int64]int64) // duplicate user ID -> kept user ID
+	for rows.Next() {
+		var id, keep int64
+		if err := rows.Scan(&id, &keep); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read duplicate users: %w", err)
+		}
+		if id != keep {
+			duplicates[id] = keep
+		}
+	}
+	rows.Close()
+
+	for id, keep := range duplicates {
+		var telegramID sql.NullInt64
+		if err := tx.QueryRow("SELECT telegram_id FROM users WHERE id = ?", id).Scan(&telegramID); err != nil {
+			return fmt.Errorf("failed to read user %d: %w", id, err)
+		}
+
+		statements := []string{
+			`INSERT OR IGNORE INTO role_users (role_id, user_id, chat_id, expires_at, created_at)
+				SELECT role_id, ?2, chat_id, expires_at, created_at FROM role_users WHERE user_id = ?1`,
+			`DELETE FROM role_users WHERE user_id = ?1`,
+			`INSERT OR IGNORE INTO muted_roles (role_id, user_id, created_at)
+				SELECT role_id, ?2, created_at FROM muted_roles WHERE user_id = ?1`,
+			`DELETE FROM muted_roles WHERE user_id = ?1`,
+			`DELETE FROM users WHERE id = ?1`,
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt, id, keep); err != nil {
+				return fmt.Errorf("failed to merge user %d into %d: %w", id, keep, err)
+			}
+		}
+
+		// Telegram IDs are unique, so this waits until the duplicate is gone
+		if telegramID.Valid {
+			_, err := tx.Exec("UPDATE users SET telegram_id = ? WHERE id = ? AND telegram_id IS NULL", telegramID.Int64, keep)
+			if err != nil {
+				return fmt.Errorf("failed to move telegram id of user %d: %w", id, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE users SET name = LOWER(name) WHERE name != LOWER(name)"); err != nil {
+		return fmt.Errorf("failed to lowercase usernames: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE roles SET created_by = LOWER(created_by) WHERE created_by != LOWER(created_by)"); err != nil {
+		return fmt.Errorf("failed to lowercase role owners: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// mergeCaseDuplicateRoles merges roles whose names differ only by case, such
+// as "Devs" and "devs", which older versions could create as separate roles.
+// The lowercase role is kept, or the oldest one if there is none; the others'
+// members and mutes move to it, as do scheduled pings and audit entries that
+// name them. The kept role takes a duplicate's category if it has none.
+// Names are otherwise left as they are; /normalizeroles lowercases them.
+func mergeCaseDuplicateRoles(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT r.id, (
+			SELECT k.id FROM roles k
+			WHERE LOWER(k.name) = LOWER(r.name)
+			ORDER BY k.name = LOWER(k.name) DESC, k.id
+			LIMIT 1
+		)
+		FROM roles r
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate roles: %w", err)
+	}
+	duplicates := make(map[int64]int64) // duplicate role ID -> kept role ID
+	for rows.Next() {
+		var id, keep int64
+		if err := rows.Scan(&id, &keep); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read duplicate roles: %w", err)
+		}
+		if id != keep {
+			duplicates[id] = keep
+		}
+	}
+	rows.Close()
+
+	for id, keep := range duplicates {
+		statements := []string{
+			`INSERT OR IGNORE INTO role_users (role_id, user_id, chat_id, expires_at, created_at)
+				SELECT ?2, user_id, chat_id, expires_at, created_at FROM role_users WHERE role_id = ?1`,
+			`DELETE FROM role_users WHERE role_id = ?1`,
+			`INSERT OR IGNORE INTO muted_roles (role_id, user_id, created_at)
+				SELECT ?2, user_id, created_at FROM muted_roles WHERE role_id = ?1`,
+			`DELETE FROM muted_roles WHERE role_id = ?1`,
+			`UPDATE roles SET category = (SELECT category FROM roles WHERE id = ?1)
+				WHERE id = ?2 AND category IS NULL`,
+			`UPDATE scheduled_pings SET role = (SELECT name FROM roles WHERE id = ?2)
+				WHERE role = (SELECT name FROM roles WHERE id = ?1)`,
+			`UPDATE audit_log SET role = (SELECT name FROM roles WHERE id = ?2)
+				WHERE role = (SELECT name FROM roles WHERE id = ?1)`,
+			`DELETE FROM roles WHERE id = ?1`,
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt, id, keep); err != nil {
+				return fmt.Errorf("failed to merge role %d into %d: %w", id, keep, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// columnMigrations lists columns added after their table was first released.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so these are
+// added with ALTER TABLE when missing, followed by fill if set.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+	fill       string
+}{
+	{"roles", "category", "TEXT", ""},
+	{"roles", "archived", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"roles", "created_by", "TEXT NOT NULL DEFAULT ''", ""},
+	{"roles", "oncall_index", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"users", "first_name", "TEXT NOT NULL DEFAULT ''", ""},
+	{"users", "last_name", "TEXT NOT NULL DEFAULT ''", ""},
+	{"users", "dnd_start", "INTEGER", ""},
+	{"users", "dnd_end", "INTEGER", ""},
+	{"users", "dnd_timezone", "TEXT NOT NULL DEFAULT ''", ""},
+	{"role_users", "chat_id", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"role_users", "expires_at", "INTEGER", ""},
+	// Users known before last-seen tracking count as seen when it started,
+	// so they aren't all inactive at once
+	{"users", "last_seen_at", "INTEGER", "UPDATE users SET last_seen_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000"},
+}
+
+// migrateColumns adds any missing columns from columnMigrations
+func migrateColumns(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+		if m.fill != "" {
+			if _, err := db.Exec(m.fill); err != nil {
+				return fmt.Errorf("failed to fill column %s.%s: %w", m.table, m.column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// columnExists reports whether a table has the given column
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			ctype      string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to read table info: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// Backup writes a consistent snapshot of the database to dest, which must not
+// exist yet. The WAL is checkpointed first so the main file is current, and
+// VACUUM INTO copies the database in a single read transaction, so writes made
+// during the backup are either fully in it or not at all.
+func Backup(db *sql.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup file %s already exists", dest)
+	}
+
+	// A busy checkpoint isn't an error; the snapshot still reads the WAL
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", dest); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testOptions = Options{
+	JournalMode:   "WAL",
+	Synchronous:   "NORMAL",
+	CacheSize:     -2000,
+	BusyTimeoutMs: 1000,
+}
+
+// seedLegacy creates a database in the state an older version left it, with
+// the tables but none of the case-insensitive indexes, and runs the
+// statements against it
+func seedLegacy(t *testing.T, statements ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return path
+}
+
+// open opens the database at path with New and closes it when the test ends
+func open(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := New(path, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// column returns the single-column rows of a query
+func column(t *testing.T, db *sql.DB, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestNewMergesCaseDuplicateRoles(t *testing.T) {
+	path := seedLegacy(t,
+		`INSERT INTO roles (id, name, category) VALUES (1, 'Devs', 'eng'), (2, 'devs', NULL), (3, 'OPS', NULL), (4, 'Ops', NULL)`,
+		`INSERT INTO users (id, name) VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')`,
+		`INSERT INTO role_users (role_id, user_id) VALUES (1, 1), (1, 2), (2, 2), (3, 3), (4, 3)`,
+		`INSERT INTO muted_roles (role_id, user_id) VALUES (1, 1)`,
+		`INSERT INTO scheduled_pings (chat_id, role, cron_spec, message, created_by) VALUES (-100, 'Devs', '0 9 * * *', '', 'admin')`,
+	)
+	db := open(t, path)
+
+	if got := column(t, db, "SELECT name FROM roles ORDER BY name"); len(got) != 2 || got[0] != "OPS" || got[1] != "devs" {
+		t.Errorf("roles = %v, want [OPS devs]", got)
+	}
+	members := column(t, db, `
+		SELECT u.name FROM role_users ru JOIN users u ON u.id = ru.user_id
+		WHERE ru.role_id = 2 ORDER BY u.name`)
+	if len(members) != 2 || members[0] != "alice" || members[1] != "bob" {
+		t.Errorf("devs members = %v, want [alice bob]", members)
+	}
+	if got := column(t, db, "SELECT user_id FROM muted_roles WHERE role_id = 2"); len(got) != 1 {
+		t.Errorf("devs mutes = %v, want alice's", got)
+	}
+	if got := column(t, db, "SELECT category FROM roles WHERE id = 2"); len(got) != 1 || got[0] != "eng" {
+		t.Errorf("devs category = %v, want [eng]", got)
+	}
+	if got := column(t, db, "SELECT role FROM scheduled_pings"); len(got) != 1 || got[0] != "devs" {
+		t.Errorf("scheduled ping roles = %v, want [devs]", got)
+	}
+	if got := column(t, db, "SELECT COUNT(*) FROM role_users WHERE role_id NOT IN (SELECT id FROM roles)"); got[0] != "0" {
+		t.Errorf("%s memberships of merged roles remain", got[0])
+	}
+
+	if _, err := db.Exec("INSERT INTO roles (name) VALUES ('DEVS')"); err == nil {
+		t.Error("created a role differing from an existing one only by case")
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db := open(t, path)
+	if err := checkWritable(db); err != nil {
+		t.Errorf("writable database: %v", err)
+	}
+
+	readOnly, err := OpenReadOnly(path, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	if err := checkWritable(readOnly); err == nil {
+		t.Error("read-only connection passed the write check")
+	}
+}
+
+func TestNewFailsOnReadOnlyFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only files")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.db")
+	db, err := New(path, Options{JournalMode: "DELETE", Synchronous: "NORMAL", BusyTimeoutMs: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err := os.Chmod(path, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	db, err = New(path, testOptions)
+	if err == nil {
+		db.Close()
+		t.Fatal("opened a read-only database file")
+	}
+	if !strings.Contains(err.Error(), "database is not writable") {
+		t.Errorf("err = %v, want it to say the database is not writable", err)
+	}
+}
+
+func TestNewMergesCaseDuplicateUsers(t *testing.T) {
+	path := seedLegacy(t,
+		`INSERT INTO users (id, name, telegram_id) VALUES (1, 'JohnDoe', 111), (2, 'johndoe', NULL), (3, 'Alice', NULL)`,
+		`INSERT INTO roles (id, name, created_by) VALUES (1, 'devs', 'JohnDoe'), (2, 'ops', 'Alice')`,
+		`INSERT INTO role_users (role_id, user_id) VALUES (1, 1), (1, 2), (2, 1)`,
+		`INSERT INTO muted_roles (role_id, user_id) VALUES (2, 1)`,
+	)
+	db := open(t, path)
+
+	if got := column(t, db, "SELECT name FROM users ORDER BY name"); len(got) != 2 || got[0] != "alice" || got[1] != "johndoe" {
+		t.Errorf("users = %v, want [alice johndoe]", got)
+	}
+	if got := column(t, db, "SELECT telegram_id FROM users WHERE name = 'johndoe'"); len(got) != 1 || got[0] != "111" {
+		t.Errorf("johndoe's telegram id = %v, want [111]", got)
+	}
+	roles := column(t, db, `
+		SELECT r.name FROM role_users ru JOIN roles r ON r.id = ru.role_id
+		WHERE ru.user_id = 2 ORDER BY r.name`)
+	if len(roles) != 2 || roles[0] != "devs" || roles[1] != "ops" {
+		t.Errorf("johndoe's roles = %v, want [devs ops]", roles)
+	}
+	if got := column(t, db, "SELECT role_id FROM muted_roles WHERE user_id = 2"); len(got) != 1 || got[0] != "2" {
+		t.Errorf("johndoe's mutes = %v, want ops", got)
+	}
+	if got := column(t, db, "SELECT created_by FROM roles ORDER BY id"); len(got) != 2 || got[0] != "johndoe" || got[1] != "alice" {
+		t.Errorf("role owners = %v, want [johndoe alice]", got)
+	}
+
+	if _, err := db.Exec("INSERT INTO users (name) VALUES ('JOHNDOE')"); err == nil {
+		t.Error("created a user differing from an existing one only by case")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.db")
+	db := open(t, path)
+
+	// Keep the writes in the WAL until the backup checkpoints them
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA wal_autocheckpoint = 0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO roles (name) VALUES ('devs'), ('ops')`,
+		`INSERT INTO users (name) VALUES ('alice'), ('bob'), ('carol')`,
+		`INSERT INTO role_users (role_id, user_id) VALUES (1, 1), (1, 2), (2, 3)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path + "-wal"); err != nil || info.Size() == 0 {
+		t.Fatalf("writes aren't in the WAL (%v), so the test proves nothing", err)
+	}
+
+	dest := filepath.Join(dir, "backup.db")
+	if err := Backup(db, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(db, dest); err == nil {
+		t.Error("backup overwrote an existing file")
+	}
+
+	backup := open(t, dest)
+	for _, table := range []string{"roles", "users", "role_users"} {
+		query := "SELECT COUNT(*) FROM " + table
+		if got, want := column(t, backup, query), column(t, db, query); got[0] != want[0] {
+			t.Errorf("backup has %s rows in %s, want %s", got[0], table, want[0])
+		}
+	}
+}
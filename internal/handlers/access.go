@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// Outcomes of a command attempt recorded in the access log
+const (
+	AccessAllowed        = "allowed"
+	AccessDisabled       = "disabled"
+	AccessUnauthorized   = "unauthorized"
+	AccessRateLimited    = "rate_limited"
+	AccessChatNotAllowed = "chat_not_allowed"
+	AccessInvalid        = "invalid"
+)
+
+// LogAccess writes the access log entry of a command attempt. Every entry has
+// the same fields so they can be relied on by log tooling: error is empty
+// unless handling the command or sending the reply failed. Arguments are
+// sanitized and truncated, and aliases and /role subcommands are logged as
+// the command they run.
+func (c *Commands) LogAccess(message *tgbotapi.Message, outcome string, err error) {
+	command, args := c.resolveCommand(message)
+	var errText string
+	if err != nil {
+		errText = err.Error()
+	}
+
+	c.access.WithFields(map[string]interface{}{
+		"user_id":       message.From.ID,
+		"username":      message.From.UserName,
+		"chat_id":       message.Chat.ID,
+		"command":       command,
+		"args":          utils.SanitizeInput(args),
+		"admin_command": models.AdminCommands[command],
+		"outcome":       outcome,
+		"error":         errText,
+	}).Info("Command")
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// adminArg returns the username given to /promote or /demote, or "" if the
+// arguments aren't a single username
+func adminArg(args string) string {
+	user, rest, err := utils.NextArg(args)
+	if err != nil || rest != "" {
+		return ""
+	}
+	return utils.SanitizeUsername(user)
+}
+
+func (c *Commands) handlePromote(ctx context.Context, actor models.Actor, args string) string {
+	user := adminArg(args)
+	if user == "" {
+		return c.msg(models.MsgUsagePromote)
+	}
+	if c.security.IsConfigAdmin(user) {
+		return c.msg(models.MsgAlreadyAdmin, user)
+	}
+
+	added, err := c.store.AddAdmin(ctx, actor, user)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if !added {
+		return c.msg(models.MsgAlreadyAdmin, user)
+	}
+
+	c.reloadAdmins(ctx)
+	c.logger.WithFields(map[string]interface{}{
+		"actor": actor.Username,
+		"user":  user,
+	}).Info("Admin promoted")
+	return c.msg(models.MsgAdminPromoted, user)
+}
+
+func (c *Commands) handleDemote(ctx context.Context, actor models.Actor, args string) string {
+	user := adminArg(args)
+	if user == "" {
+		return c.msg(models.MsgUsageDemote)
+	}
+	if c.security.IsConfigAdmin(user) {
+		return c.msg(models.MsgConfigAdminDemote, user)
+	}
+
+	removed, err := c.store.RemoveAdmin(ctx, actor, user)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if !removed {
+		return c.msg(models.MsgNotPromotedAdmin, user)
+	}
+
+	c.reloadAdmins(ctx)
+	c.logger.WithFields(map[string]interface{}{
+		"actor": actor.Username,
+		"user":  user,
+	}).Info("Admin demoted")
+	return c.msg(models.MsgAdminDemoted, user)
+}
+
+// handleListAdmins lists the admin from the configuration first, then the
+// promoted admins
+func (c *Commands) handleListAdmins(ctx context.Context) string {
+	admins, err := c.store.ListAdmins(ctx)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	names := []string{"@" + c.security.Config().AdminUsername}
+	for _, admin := range admins {
+		names = append(names, "@"+admin)
+	}
+	return c.msg(models.MsgAdmins, strings.Join(names, ", "))
+}
+
+// unauthorizedMessage tells a user they can't run an admin command and whom
+// to ask: the admin from the configuration first, then promoted admins, up
+// to maxListedAdmins
+func (c *Commands) unauthorizedMessage() string {
+	admins := c.security.Admins()
+	more := len(admins) > maxListedAdmins
+	if more {
+		admins = admins[:maxListedAdmins]
+	}
+
+	names := make([]string, len(admins))
+	for i, admin := range admins {
+		names[i] = "@" + admin
+	}
+	list := strings.Join(names, ", ")
+	if more {
+		list += ", …"
+	}
+	return c.msg(models.MsgUnauthorized, list)
+}
+
+// reloadAdmins refreshes the cached admins after a change. If that fails,
+// the change still applies from the next restart.
+func (c *Commands) reloadAdmins(ctx context.Context) {
+	if err := c.security.LoadAdmins(ctx, c.store); err != nil {
+		c.logger.WithError(err).Error("Failed to reload admins")
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// LoadAliases replaces the cached command aliases with those in the store.
+// It runs at startup and after every /addalias or /removealias.
+func (c *Commands) LoadAliases(ctx context.Context) error {
+	aliases, err := c.store.GetCommandAliases(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.aliasMu.Lock()
+	c.aliases = aliases
+	c.aliasMu.Unlock()
+	return nil
+}
+
+// resolveAlias returns the command an alias runs. Built-in commands and
+// unknown names are returned as they are, so an alias saved before a command
+// of the same name was added never shadows it.
+func (c *Commands) resolveAlias(name string) string {
+	if models.IsCommand(name) {
+		return name
+	}
+
+	c.aliasMu.RLock()
+	defer c.aliasMu.RUnlock()
+	if command, ok := c.aliases[name]; ok {
+		return command
+	}
+	return name
+}
+
+func (c *Commands) handleAddAlias(ctx context.Context, actor models.Actor, args string) string {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return c.msg(models.MsgUsageAddAlias)
+	}
+
+	if err := c.store.SetCommandAlias(ctx, actor, fields[0], fields[1]); err != nil {
+		return c.errorMessage(err)
+	}
+	c.reloadAliases(ctx)
+
+	alias := strings.TrimPrefix(strings.ToLower(fields[0]), "/")
+	command := strings.TrimPrefix(strings.ToLower(fields[1]), "/")
+	c.logger.WithFields(map[string]interface{}{
+		"actor":   actor.Username,
+		"alias":   alias,
+		"command": command,
+	}).Info("Command alias set")
+	return c.msg(models.MsgAliasAdded, alias, command)
+}
+
+func (c *Commands) handleRemoveAlias(ctx context.Context, args string) string {
+	alias := strings.TrimPrefix(strings.ToLower(utils.SanitizeInput(args)), "/")
+	if alias == "" || strings.ContainsAny(alias, " \t\n") {
+		return c.msg(models.MsgUsageRemoveAlias)
+	}
+
+	removed, err := c.store.RemoveCommandAlias(ctx, alias)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if !removed {
+		return c.msg(models.MsgAliasNotFound, alias)
+	}
+	c.reloadAliases(ctx)
+	return c.msg(models.MsgAliasRemoved, alias)
+}
+
+func (c *Commands) handleListAliases() string {
+	c.aliasMu.RLock()
+	lines := make([]string, 0, len(c.aliases))
+	for alias, command := range c.aliases {
+		lines = append(lines, "/"+alias+" → /"+command)
+	}
+	c.aliasMu.RUnlock()
+
+	if len(lines) == 0 {
+		return c.msg(models.MsgNoAliases)
+	}
+	sort.Strings(lines)
+	return c.msg(models.MsgAliases, strings.Join(lines, "\n"))
+}
+
+// reloadAliases refreshes the cached aliases after a change. If that fails,
+// the change still applies from the next restart.
+func (c *Commands) reloadAliases(ctx context.Context) {
+	if err := c.LoadAliases(ctx); err != nil {
+		c.logger.WithError(err).Error("Failed to reload command aliases")
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// checkArgs returns the usage reply for a command given too few or too many
+// arguments, or "" if the count is within the bounds in models.CommandHelps.
+// Arguments with an unclosed quote are left to the command, which says so.
+func (c *Commands) checkArgs(command, args string) string {
+	help, ok := models.CommandHelps[command]
+	if !ok || (help.MinArgs == 0 && help.MaxArgs == models.AnyArgs) {
+		return ""
+	}
+
+	parts, err := utils.SplitArgs(args)
+	if err != nil {
+		return ""
+	}
+	if len(parts) < help.MinArgs || (help.MaxArgs != models.AnyArgs && len(parts) > help.MaxArgs) {
+		return c.msg(models.MsgUsage, help.Usage)
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"didactic-spork/internal/models"
+)
+
+func TestCheckArgs(t *testing.T) {
+	c, _ := newTestCommands(t)
+
+	// words returns n arguments
+	words := func(n int) string {
+		return strings.TrimSpace(strings.Repeat("x ", n))
+	}
+	for command, help := range models.CommandHelps {
+		usage := c.msg(models.MsgUsage, help.Usage)
+		if help.MinArgs > 0 {
+			if got := c.checkArgs(command, words(help.MinArgs-1)); got != usage {
+				t.Errorf("/%s with %d args = %q, want the usage", command, help.MinArgs-1, got)
+			}
+		}
+		if help.MaxArgs != models.AnyArgs {
+			if got := c.checkArgs(command, words(help.MaxArgs+1)); got != usage {
+				t.Errorf("/%s with %d args = %q, want the usage", command, help.MaxArgs+1, got)
+			}
+		}
+		if got := c.checkArgs(command, words(help.MinArgs)); got != "" {
+			t.Errorf("/%s with %d args = %q, want it accepted", command, help.MinArgs, got)
+		}
+		// The command itself reports the unclosed quote
+		if got := c.checkArgs(command, `"qa team`); got != "" {
+			t.Errorf("/%s with an unclosed quote = %q, want it passed through", command, got)
+		}
+	}
+}
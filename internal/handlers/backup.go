@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+)
+
+// BackupFunc writes a consistent snapshot of the database to dest
+type BackupFunc func(dest string) error
+
+// SetBackuper sets how /backup snapshots the database
+func (c *Commands) SetBackuper(backup BackupFunc) {
+	c.backup = backup
+}
+
+// handleBackup snapshots the database and sends the file to the admin's
+// private chat. The database holds every member of every role, so it is
+// never posted in a group.
+func (c *Commands) handleBackup(send SendFunc, message *tgbotapi.Message) string {
+	if c.backup == nil {
+		return c.msg(models.MsgInternalError)
+	}
+
+	dir, err := os.MkdirTemp("", "bot-backup-")
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to create backup directory")
+		return c.msg(models.MsgBackupFailed)
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, time.Now().UTC().Format("bot-20060102-150405.db"))
+	if err := c.backup(dest); err != nil {
+		c.logger.WithError(err).WithField("actor", message.From.UserName).Error("Failed to back up database")
+		return c.msg(models.MsgBackupFailed)
+	}
+
+	document := tgbotapi.NewDocument(message.From.ID, tgbotapi.FilePath(dest))
+	if _, err := send(document.ChatID, document); err != nil {
+		c.logger.WithError(err).WithField("user_id", message.From.ID).Warn("Failed to send backup")
+		return c.msg(models.MsgBackupNotSent)
+	}
+	return c.msg(models.MsgBackupSent)
+}
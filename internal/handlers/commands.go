@@ -2,179 +2,1570 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"didactic-spork/internal/config"
 	"didactic-spork/internal/middleware"
 	"didactic-spork/internal/models"
+	"didactic-spork/internal/scheduler"
 	"didactic-spork/internal/store"
+	"didactic-spork/internal/version"
 	"didactic-spork/pkg/logger"
+	"didactic-spork/pkg/utils"
 )
 
 // Commands handles bot commands
 type Commands struct {
-	store    store.Store
-	security *middleware.Security
-	logger   *logger.Logger
+	store     store.Store
+	security  *middleware.Security
+	throttle  *middleware.ChatThrottle
+	undo      *UndoStack
+	everyone  *middleware.RateLimiter
+	feedback  *middleware.RateLimiter
+	db        DBStatter
+	config    *config.Config
+	locale    string
+	startedAt time.Time
+	logger    *logger.Logger
+	reload    ReloadFunc
+	backup    BackupFunc
+	pin       PinFunc
+	members   MemberListFunc
+	// updates returns the number of updates handled since the bot started
+	updates func() int64
+	// access writes one structured entry per command attempt
+	access *logger.Logger
+	// aliasMu guards aliases, which maps command aliases to the commands
+	// they run
+	aliasMu sync.RWMutex
+	aliases map[string]string
 }
 
+// everyoneCooldown is how often @everyone can be used in a chat, given how
+// many people it notifies
+const everyoneCooldown = 10 * time.Minute
+
+// Output formats of /listmembers
+const (
+	listFormatPlain    = "plain"
+	listFormatMentions = "mentions"
+	listFormatCount    = "count"
+)
+
+var listFormats = []string{listFormatPlain, listFormatMentions, listFormatCount}
+
+// removeRoleConfirmation is the trailing argument that confirms /removerole
+const removeRoleConfirmation = "confirm"
+
+// pingTemplateReset is the argument of /setpingtemplate that goes back to
+// the default ping wording
+const pingTemplateReset = "reset"
+
+// maxListedAdmins caps how many admins the reply to an unauthorized command
+// names, so a long promoted list doesn't flood the chat
+const maxListedAdmins = 3
+
+// feedbackCooldown is how often a user can send /feedback
+const feedbackCooldown = 5 * time.Minute
+
+// DBStatter reports database connection pool statistics. *sql.DB satisfies
+// it; taking an interface lets Commands be built without a database.
+type DBStatter interface {
+	Stats() sql.DBStats
+}
+
+// SendFunc delivers a message to a chat and returns the sent message
+type SendFunc func(chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error)
+
+// ReloadFunc re-reads the configuration and applies what can change at
+// runtime. It returns the names of the applied settings that changed and of
+// the changed settings that need a restart.
+type ReloadFunc func() (changed, needRestart []string, err error)
+
 // NewCommands creates a new command handler
-func NewCommands(store store.Store, security *middleware.Security, logger *logger.Logger) *Commands {
+func NewCommands(store store.Store, security *middleware.Security, throttle *middleware.ChatThrottle, db DBStatter, cfg *config.Config, log *logger.Logger) *Commands {
 	return &Commands{
-		store:    store,
-		security: security,
-		logger:   logger,
+		store:     store,
+		security:  security,
+		throttle:  throttle,
+		undo:      NewUndoStack(undoDepth, undoWindow),
+		everyone:  middleware.NewRateLimiter(1, everyoneCooldown),
+		feedback:  middleware.NewRateLimiter(1, feedbackCooldown),
+		db:        db,
+		config:    cfg,
+		locale:    cfg.Locale,
+		startedAt: time.Now(),
+		logger:    log,
+		access:    logger.NewAccess(),
 	}
 }
 
-// Handle processes a bot command
-func (c *Commands) Handle(bot *tgbotapi.BotAPI, update tgbotapi.Update) error {
+// SetReloader sets how /reloadconfig reloads the configuration
+func (c *Commands) SetReloader(reload ReloadFunc) {
+	c.reload = reload
+}
+
+// SetUpdateCounter sets how /status gets the number of updates handled
+func (c *Commands) SetUpdateCounter(updates func() int64) {
+	c.updates = updates
+}
+
+// msg returns a response message in the configured locale
+func (c *Commands) msg(key string, args ...interface{}) string {
+	return models.Msg(key, c.locale, args...)
+}
+
+// Handle processes a bot command and records the attempt in the access log
+func (c *Commands) Handle(ctx context.Context, send SendFunc, update tgbotapi.Update) (err error) {
+	outcome := AccessAllowed
+	defer func() {
+		c.LogAccess(update.Message, outcome, err)
+	}()
+
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
-	command := update.Message.Command()
-	args := update.Message.CommandArguments()
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	if c.config.ReplyToCommands {
+		msg.ReplyToMessageID = update.Message.MessageID
+		msg.AllowSendingWithoutReply = true
+	}
+	command, args := c.resolveCommand(update.Message)
+	actor := models.Actor{Username: update.Message.From.UserName, ChatID: update.Message.Chat.ID}
+
+	// Check the chat's command list
+	if !c.security.IsCommandAllowed(actor.ChatID, command) {
+		outcome = AccessDisabled
+		msg.Text = c.msg(models.MsgCommandDisabled)
+		_, err = send(msg.ChatID, msg)
+		return err
+	}
 
 	// Check admin permissions
-	if models.AdminCommands[command] && !c.security.IsAdmin(update.Message.From.UserName) {
-		msg.Text = models.MsgUnauthorized
-		_, err := bot.Send(msg)
+	if models.AdminCommands[command] && !c.isAuthorized(ctx, command, args, update.Message.From.UserName) {
+		outcome = AccessUnauthorized
+		msg.Text = c.unauthorizedMessage()
+		_, err = send(msg.ChatID, msg)
+		return err
+	}
+
+	// Check the number of arguments
+	if usage := c.checkArgs(command, args); usage != "" {
+		outcome = AccessInvalid
+		msg.Text = usage
+		_, err = send(msg.ChatID, msg)
 		return err
 	}
 
+	c.recordUsage(ctx, command, actor.ChatID)
+
 	// Route command
+	var pin bool
 	switch command {
 	case models.CmdPing:
-		msg.Text = c.handlePing(args)
+		admin := c.security.IsAdmin(actor.Username)
+		msg.Text, pin = c.handlePing(ctx, actor.ChatID, args, admin)
+	case models.CmdPingOncall:
+		msg.Text = c.handlePingOncall(ctx, args)
 	case models.CmdCreateRole:
-		msg.Text = c.handleCreateRole(args)
+		msg.Text = c.handleCreateRole(ctx, actor, args)
 	case models.CmdRemoveRole:
-		msg.Text = c.handleRemoveRole(args)
+		msg.Text = c.handleRemoveRole(ctx, actor, args)
+	case models.CmdArchiveRole:
+		msg.Text = c.handleArchiveRole(ctx, actor, args, true)
+	case models.CmdRestoreRole:
+		msg.Text = c.handleArchiveRole(ctx, actor, args, false)
+	case models.CmdTransferRole:
+		msg.Text = c.handleTransferRole(ctx, actor, update.Message, args)
 	case models.CmdAddToRole:
-		msg.Text = c.handleAddToRole(args)
+		msg.Text = c.handleAddToRole(ctx, actor, update.Message, args)
 	case models.CmdRemoveFromRole:
-		msg.Text = c.handleRemoveFromRole(args)
+		msg.Text = c.handleRemoveFromRole(ctx, actor, update.Message, args)
 	case models.CmdListRoles:
-		msg.Text = c.handleListRoles()
+		msg.Text = c.handleListRoles(ctx, args)
+	case models.CmdRoles:
+		text, keyboard := c.handleRoles(ctx)
+		msg.Text = text
+		if keyboard != nil {
+			msg.ReplyMarkup = keyboard
+		}
 	case models.CmdListMembers:
-		msg.Text = c.handleListMembers(args)
+		text, keyboard := c.handleListMembers(ctx, args)
+		msg.Text = text
+		if keyboard != nil {
+			msg.ReplyMarkup = keyboard
+		}
+	case models.CmdMute:
+		msg.Text = c.handleMute(ctx, actor, args)
+	case models.CmdUnmute:
+		msg.Text = c.handleUnmute(ctx, actor, args)
+	case models.CmdDND:
+		msg.Text = c.handleDND(ctx, actor, args)
+	case models.CmdSetCategory:
+		msg.Text = c.handleSetCategory(ctx, actor, args)
+	case models.CmdUndo:
+		msg.Text = c.handleUndo(ctx, actor)
+	case models.CmdAuditLog:
+		msg.Text = c.handleAuditLog(ctx, args)
+	case models.CmdSchedule:
+		msg.Text = c.handleSchedule(ctx, actor, args)
+	case models.CmdUnschedule:
+		msg.Text = c.handleUnschedule(ctx, actor, args)
+	case models.CmdSchedules:
+		msg.Text = c.handleListSchedules(ctx, actor.ChatID)
+	case models.CmdWhoAmI:
+		msg.Text = c.handleWhoAmI(update.Message)
+	case models.CmdFeedback:
+		msg.Text = c.handleFeedback(send, update.Message)
+	case models.CmdBotInfo:
+		msg.Text = c.handleBotInfo()
+	case models.CmdAllMembers:
+		msg.Text = c.handleAllMembers(ctx, args)
+	case models.CmdPrune:
+		msg.Text = c.handlePrune(ctx, actor)
+	case models.CmdReloadConfig:
+		msg.Text = c.handleReloadConfig(actor)
+	case models.CmdNormalizeRoles:
+		msg.Text = c.handleNormalizeRoles(ctx, actor)
+	case models.CmdSetPingTemplate:
+		msg.Text = c.handleSetPingTemplate(ctx, actor, args)
+	case models.CmdBackup:
+		msg.Text = c.handleBackup(send, update.Message)
+	case models.CmdPromote:
+		msg.Text = c.handlePromote(ctx, actor, args)
+	case models.CmdDemote:
+		msg.Text = c.handleDemote(ctx, actor, args)
+	case models.CmdListAdmins:
+		msg.Text = c.handleListAdmins(ctx)
+	case models.CmdAddAlias:
+		msg.Text = c.handleAddAlias(ctx, actor, args)
+	case models.CmdRemoveAlias:
+		msg.Text = c.handleRemoveAlias(ctx, args)
+	case models.CmdAliases:
+		msg.Text = c.handleListAliases()
+	case models.CmdImportMembers:
+		msg.Text = c.handleImportMembers(ctx, actor, args)
+	case models.CmdUsage:
+		msg.Text = c.handleUsage(ctx, args)
+	case models.CmdRole:
+		msg.Text = c.handleRole()
 	case models.CmdHelp:
-		msg.Text = models.HelpMessage
+		msg.Text = c.handleHelp(args)
 	case models.CmdStatus:
-		msg.Text = models.MsgBotHealthy
+		msg.Text = c.handleStatus(ctx)
+	case models.CmdVersion:
+		msg.Text = c.msg(models.MsgVersion, version.String())
 	default:
-		msg.Text = models.MsgUnknownCommand
+		msg.Text = c.msg(models.MsgUnknownCommand)
 	}
 
-	_, err := bot.Send(msg)
-	return err
+	// Role pings are paced per chat so groups don't get flooded
+	if (command == models.CmdPing || command == models.CmdPingOncall) && args != "" {
+		if err := c.throttle.Wait(ctx, msg.ChatID); err != nil {
+			return err
+		}
+	}
+
+	if models.AdminCommands[command] && c.sendPrivately(send, update.Message, msg.Text) {
+		return nil
+	}
+	sent, err := send(msg.ChatID, msg)
+	if err != nil || !pin {
+		return err
+	}
+	return c.pinPing(send, msg.ChatID, sent.MessageID)
 }
 
-func (c *Commands) handlePing(args string) string {
-	if args == "" {
-		return models.MsgPong
+// sendPrivately sends the response to an admin command to the admin's private
+// chat, as configured by ADMIN_REPLIES. It reports whether the group reply
+// should be skipped. If the private message fails, e.g. because the admin
+// never started the bot, the response goes to the group instead.
+func (c *Commands) sendPrivately(send SendFunc, message *tgbotapi.Message, text string) bool {
+	if c.config.AdminReplies == config.AdminRepliesGroup || message.Chat.IsPrivate() {
+		return false
 	}
 
-	// Normalize role name to lowercase
-	roleName := strings.ToLower(strings.TrimSpace(args))
+	private := tgbotapi.NewMessage(message.From.ID, text)
+	private.ParseMode = tgbotapi.ModeMarkdownV2
+	if _, err := send(private.ChatID, private); err != nil {
+		c.logger.WithError(err).WithField("user_id", message.From.ID).Debug("Failed to send private reply, replying in the group")
+		return false
+	}
+	return c.config.AdminReplies == config.AdminRepliesPrivate
+}
 
-	users, err := c.store.GetUsersInRole(roleName)
+// isAuthorized reports whether a user may run an admin command. Besides the
+// admin, the owner of a role may run role-scoped commands on that role.
+func (c *Commands) isAuthorized(ctx context.Context, command, args, username string) bool {
+	if c.security.IsAdmin(username) {
+		return true
+	}
+	if !models.OwnerCommands[command] {
+		return false
+	}
+
+	role, _, _ := utils.NextArg(args)
+	if role == "" {
+		return false
+	}
+
+	owner, err := c.store.IsRoleOwner(ctx, role, username)
 	if err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+		c.logger.WithError(err).Warn("Failed to check role owner")
+		return false
+	}
+	return owner
+}
+
+// handlePing builds the response to /ping and reports whether it should be
+// pinned once sent. Only admins can ask for the ping to be pinned.
+func (c *Commands) handlePing(ctx context.Context, chatID int64, args string, admin bool) (string, bool) {
+	// The first word is the role, optionally followed by --limit N, --names
+	// and --pin, and anything after that is an optional message
+	fields, message := leadingFields(args, 1)
+	if len(fields) == 0 {
+		return c.msg(models.MsgPong), false
 	}
+	roleName := strings.ToLower(fields[0])
 
-	if len(users) == 0 {
-		return fmt.Sprintf("No users found in role '%s'", roleName)
+	var opts pingOptions
+	pin := false
+	for {
+		flag, rest := leadingFields(message, 1)
+		if len(flag) == 0 {
+			break
+		}
+		if flag[0] == "--names" {
+			opts.names, message = true, rest
+			continue
+		}
+		if flag[0] == "--pin" {
+			if !admin {
+				return c.msg(models.MsgPinAdminOnly), false
+			}
+			pin, message = true, rest
+			continue
+		}
+		if flag[0] != "--limit" {
+			break
+		}
+		value, rest := leadingFields(rest, 1)
+		if len(value) == 0 {
+			return c.msg(models.MsgUsagePingLimit), false
+		}
+		n, err := strconv.Atoi(value[0])
+		if err != nil || n < 1 {
+			return c.msg(models.MsgUsagePingLimit), false
+		}
+		opts.limit, message = n, rest
+	}
+	if err := c.checkBanned(message); err != nil {
+		return c.errorMessage(err), false
+	}
+
+	archived, err := c.store.IsRoleArchived(ctx, roleName)
+	if err != nil {
+		return c.errorMessage(err), false
+	}
+	if archived {
+		return c.msg(models.MsgRoleArchived, roleName), false
+	}
+
+	text, err := c.pingRoles(ctx, chatID, []string{roleName}, utils.SanitizeMessage(message), opts)
+	if err != nil {
+		return c.errorMessage(err), false
+	}
+
+	if text == "" {
+		return c.msg(models.MsgNoUsersInRole, roleName), false
+	}
+
+	return text, pin
+}
+
+func (c *Commands) handlePingOncall(ctx context.Context, args string) string {
+	fields, message := leadingFields(args, 1)
+	if len(fields) == 0 {
+		return c.msg(models.MsgProvideRoleName)
+	}
+	roleName := strings.ToLower(fields[0])
+	if err := c.checkBanned(message); err != nil {
+		return c.errorMessage(err)
+	}
+
+	archived, err := c.store.IsRoleArchived(ctx, roleName)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if archived {
+		return c.msg(models.MsgRoleArchived, roleName)
+	}
+
+	user, err := c.store.NextOncall(ctx, roleName)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if user == "" {
+		return c.msg(models.MsgNoUsersInRole, roleName)
+	}
+
+	text := c.msg(models.MsgPingOncall, roleName, user)
+	if message = utils.SanitizeMessage(message); message != "" {
+		text += "\n\n" + utils.EscapeMarkdownV2(message)
+	}
+	return text
+}
+
+// PingRoles builds a single ping text for a chat mentioning the members of
+// all given roles, each user once. Archived roles are skipped. Members who
+// muted a role are listed without being mentioned unless another role
+// mentions them. An empty string is returned when there is nobody to mention.
+func (c *Commands) PingRoles(ctx context.Context, chatID int64, roles []string, message string) (string, error) {
+	return c.pingRoles(ctx, chatID, roles, message, pingOptions{})
+}
+
+// pingOptions tune how /ping mentions users
+type pingOptions struct {
+	// limit is the maximum number of users mentioned, in name order; zero
+	// mentions everyone
+	limit int
+	// names mentions users by display name instead of @username where known
+	names bool
+}
+
+// pingRoles is PingRoles with options
+func (c *Commands) pingRoles(ctx context.Context, chatID int64, roles []string, message string, opts pingOptions) (string, error) {
+	var expanded, mentioned, muted []string
+	for _, role := range utils.Unique(roles) {
+		archived, err := c.store.IsRoleArchived(ctx, role)
+		if err != nil {
+			return "", err
+		}
+		if archived {
+			continue
+		}
+
+		users, err := c.store.GetUsersInRole(ctx, role)
+		if err != nil {
+			return "", err
+		}
+		if len(users) == 0 {
+			continue
+		}
+
+		mutedInRole, err := c.store.GetMutedUsersInRole(ctx, role)
+		if err != nil {
+			return "", err
+		}
+
+		expanded = append(expanded, role)
+		for _, user := range users {
+			if c.isBlockedBot(user) {
+				continue
+			}
+			if utils.Contains(mutedInRole, user) {
+				muted = append(muted, user)
+			} else {
+				mentioned = append(mentioned, user)
+			}
+		}
+	}
+
+	if len(mentioned) == 0 {
+		return "", nil
+	}
+
+	mentioned = utils.Unique(mentioned)
+	var onlyMuted []string
+	for _, user := range utils.Unique(muted) {
+		if !utils.Contains(mentioned, user) {
+			onlyMuted = append(onlyMuted, user)
+		}
+	}
+
+	// Leave out users in their do-not-disturb hours
+	windows, err := c.store.GetDND(ctx, mentioned)
+	if err != nil {
+		return "", err
+	}
+	quiet := 0
+	if len(windows) > 0 {
+		now := time.Now()
+		var awake []string
+		for _, user := range mentioned {
+			if dnd, ok := windows[user]; ok && dnd.Active(now, utils.TimeLocation()) {
+				quiet++
+				continue
+			}
+			awake = append(awake, user)
+		}
+		mentioned = awake
+	}
+
+	total := 0
+	if opts.limit > 0 && opts.limit < len(mentioned) {
+		total = len(mentioned)
+		mentioned = mentioned[:opts.limit]
+	}
+
+	// In the summary style, large roles only get the first members mentioned
+	// and a count of the rest, unless --limit asked for a number
+	more := 0
+	if limit := c.config.PingSummaryLimit; opts.limit == 0 && c.config.PingStyle == config.PingStyleSummary && len(mentioned) > limit {
+		more = len(mentioned) - limit
+		mentioned = mentioned[:limit]
+	}
+
+	mentions := make([]string, len(mentioned))
+	for i, user := range mentioned {
+		mentions[i] = usernameMention(user)
+	}
+	if opts.names {
+		users, err := c.store.GetUsers(ctx, mentioned)
+		if err != nil {
+			return "", err
+		}
+		for _, user := range users {
+			if i := indexOf(mentioned, user.Name); i >= 0 {
+				mentions[i] = nameMention(user)
+			}
+		}
 	}
 
-	msgText := fmt.Sprintf(models.PrefixPing, roleName)
-	for _, user := range users {
-		msgText += "@" + user + " "
+	template, err := c.store.GetPingTemplate(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	return c.FormatPing(template, expanded, mentions, onlyMuted, total, more, quiet, message), nil
+}
+
+// FormatPing builds the MarkdownV2 text that mentions users of the pinged
+// roles, followed by the muted members as plain text and an optional message.
+// mentions are MarkdownV2 mentions of the users. A non-zero total notes that
+// they are only the first of total members, a non-zero more notes how many
+// members the summary style left out, and a non-zero quiet notes how many
+// members were skipped for their do-not-disturb hours. A non-empty template
+// replaces the default first line, see renderPingTemplate.
+func (c *Commands) FormatPing(template string, roles, mentions, muted []string, total, more, quiet int, message string) string {
+	var msgText string
+	switch {
+	case template != "":
+		msgText, message = renderPingTemplate(template, roles, mentions, message)
+	case len(roles) == 1:
+		msgText = c.msg(models.MsgPingRole, roles[0]) + strings.Join(mentions, " ")
+	default:
+		msgText = c.msg(models.MsgPingRoles, "'"+strings.Join(roles, "', '")+"'") + strings.Join(mentions, " ")
+	}
+	if total > 0 {
+		msgText += "\n" + c.msg(models.MsgPingLimited, len(mentions), total)
+	}
+	if more > 0 {
+		msgText += "\n" + c.msg(models.MsgPingSummary, more, strings.Join(roles, ", "))
+	}
+	if quiet > 0 {
+		msgText += "\n" + c.msg(models.MsgPingQuiet, quiet)
+	}
+	if len(muted) > 0 {
+		msgText += "\n" + c.msg(models.MsgMutedMembers, strings.Join(muted, ", "))
+	}
+	if message != "" {
+		msgText += "\n\n" + utils.EscapeMarkdownV2(message)
 	}
 	return msgText
 }
 
-func (c *Commands) handleCreateRole(args string) string {
+// pingPlaceholder matches the placeholders of a ping template
+var pingPlaceholder = regexp.MustCompile(`\{(role|mentions|message|count)\}`)
+
+// renderPingTemplate fills in a chat's ping template as MarkdownV2. The
+// template text is escaped, {role} becomes the pinged roles, {mentions} the
+// mentions, {count} the number of users mentioned, and {message} the
+// message. The message is returned as rest when the template has no place
+// for it, so it still follows the ping.
+func renderPingTemplate(template string, roles, mentions []string, message string) (text, rest string) {
+	rest = message
+	var sb strings.Builder
+	last := 0
+	for _, match := range pingPlaceholder.FindAllStringIndex(template, -1) {
+		sb.WriteString(utils.EscapeMarkdownV2(template[last:match[0]]))
+		last = match[1]
+
+		switch template[match[0]:match[1]] {
+		case models.PlaceholderRole:
+			sb.WriteString(utils.EscapeMarkdownV2(strings.Join(roles, ", ")))
+		case models.PlaceholderMentions:
+			sb.WriteString(strings.Join(mentions, " "))
+		case models.PlaceholderCount:
+			sb.WriteString(strconv.Itoa(len(mentions)))
+		case models.PlaceholderMessage:
+			sb.WriteString(utils.EscapeMarkdownV2(message))
+			rest = ""
+		}
+	}
+	sb.WriteString(utils.EscapeMarkdownV2(template[last:]))
+	return sb.String(), rest
+}
+
+// PingEveryone builds a ping mentioning every user in any active role, for
+// @everyone style keywords. Telegram doesn't let bots list all chat members,
+// so users who aren't in any role are not reached. Only one such ping per
+// chat is allowed within everyoneCooldown; later ones get a notice instead.
+func (c *Commands) PingEveryone(ctx context.Context, chatID int64, keyword string) (string, error) {
+	if !c.everyone.Allow(chatID) {
+		return c.msg(models.MsgEveryoneCooldown, keyword, int(everyoneCooldown.Minutes())), nil
+	}
+
+	users, err := c.store.GetAllUsersInChat(ctx)
+	if err != nil {
+		return "", err
+	}
+	users = slices.DeleteFunc(users, c.isBlockedBot)
+	if len(users) == 0 {
+		return "", nil
+	}
+
+	mentions := make([]string, len(users))
+	for i, user := range users {
+		mentions[i] = usernameMention(user)
+	}
+	return c.msg(models.MsgPingEveryone) + strings.Join(mentions, " "), nil
+}
+
+// isBlockedBot reports whether a role member is left out of pings because
+// their username looks like a bot's. Bots added before BLOCK_BOT_USERNAMES
+// was set are still in their roles, and mentioning them is useless.
+func (c *Commands) isBlockedBot(user string) bool {
+	return c.config.BlockBotUsernames && utils.LooksLikeBot(user)
+}
+
+// usernameMention mentions a user by @username, as MarkdownV2 text
+func usernameMention(user string) string {
+	return "@" + utils.EscapeMarkdownV2(user)
+}
+
+// nameMention mentions a user by display name, as a MarkdownV2 text mention.
+// Users without a known Telegram ID or name are mentioned by @username.
+func nameMention(user models.User) string {
+	name := user.DisplayName()
+	if user.TelegramID == 0 || name == "" {
+		return usernameMention(user.Name)
+	}
+	return fmt.Sprintf("[%s](tg://user?id=%d)", utils.EscapeMarkdownV2(name), user.TelegramID)
+}
+
+func indexOf(list []string, item string) int {
+	for i, v := range list {
+		if v == item {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Commands) handleMute(ctx context.Context, actor models.Actor, args string) string {
 	if args == "" {
-		return models.MsgProvideRoleName
+		return c.msg(models.MsgProvideRoleName)
+	}
+	if actor.Username == "" {
+		return c.msg(models.MsgNeedUsername)
+	}
+
+	roleName := strings.ToLower(roleArg(args))
+	if err := c.store.MuteRole(ctx, roleName, actor.Username); err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgRoleMuted, roleName)
+}
+
+// handleDND shows, sets, or clears the caller's do-not-disturb window
+func (c *Commands) handleDND(ctx context.Context, actor models.Actor, args string) string {
+	if actor.Username == "" {
+		return c.msg(models.MsgNeedUsername)
+	}
+
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		windows, err := c.store.GetDND(ctx, []string{actor.Username})
+		if err != nil {
+			return c.errorMessage(err)
+		}
+		dnd, ok := windows[utils.SanitizeUsername(actor.Username)]
+		if !ok {
+			return c.msg(models.MsgDNDOff)
+		}
+		return c.dndSet(dnd)
+	case len(fields) == 1 && strings.EqualFold(fields[0], "off"):
+		if err := c.store.SetDND(ctx, actor.Username, nil); err != nil {
+			return c.errorMessage(err)
+		}
+		return c.msg(models.MsgDNDOff)
+	case len(fields) > 2:
+		return c.msg(models.MsgUsageDND)
 	}
 
-	if err := c.store.CreateRole(args); err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+	dnd, err := models.ParseDNDWindow(fields[0])
+	if err != nil {
+		return c.msg(models.MsgUsageDND)
+	}
+	if len(fields) == 2 {
+		if _, err := time.LoadLocation(fields[1]); err != nil {
+			return c.msg(models.MsgUnknownTimezone, fields[1])
+		}
+		dnd.Timezone = fields[1]
 	}
 
-	return fmt.Sprintf(models.PrefixSuccess, fmt.Sprintf("Role '%s' created successfully", args))
+	if err := c.store.SetDND(ctx, actor.Username, &dnd); err != nil {
+		return c.errorMessage(err)
+	}
+	return c.dndSet(dnd)
 }
 
-func (c *Commands) handleRemoveRole(args string) string {
+// dndSet describes a do-not-disturb window
+func (c *Commands) dndSet(dnd models.DND) string {
+	zone := dnd.Timezone
+	if zone == "" {
+		zone = utils.TimeLocation().String()
+	}
+	return c.msg(models.MsgDNDSet, dnd.Window(), zone)
+}
+
+func (c *Commands) handleUnmute(ctx context.Context, actor models.Actor, args string) string {
 	if args == "" {
-		return models.MsgProvideRoleName
+		return c.msg(models.MsgProvideRoleName)
+	}
+	if actor.Username == "" {
+		return c.msg(models.MsgNeedUsername)
 	}
 
-	if err := c.store.RemoveRole(args); err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+	roleName := strings.ToLower(roleArg(args))
+	if err := c.store.UnmuteRole(ctx, roleName, actor.Username); err != nil {
+		return c.errorMessage(err)
 	}
 
-	return fmt.Sprintf(models.PrefixSuccess, fmt.Sprintf("Role '%s' removed successfully", args))
+	return c.msg(models.MsgRoleUnmuted, roleName)
 }
 
-func (c *Commands) handleAddToRole(args string) string {
-	parts := strings.Split(args, " ")
-	if len(parts) != 2 {
-		return models.MsgUsageAddToRole
+func (c *Commands) handleHelp(args string) string {
+	if args == "" {
+		return c.msg(models.MsgHelp)
+	}
+
+	name := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(args)), "/")
+	help, ok := models.CommandHelps[name]
+	if !ok {
+		return c.msg(models.MsgNoHelpForCommand, name)
 	}
 
-	role, user := parts[0], parts[1]
-	if err := c.store.AddUserToRole(role, user); err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+	access := c.msg(models.MsgAccessEveryone)
+	switch {
+	case models.OwnerCommands[name]:
+		access = c.msg(models.MsgAccessOwners)
+	case models.AdminCommands[name]:
+		access = c.msg(models.MsgAccessAdmins)
 	}
 
-	return fmt.Sprintf(models.PrefixSuccess, fmt.Sprintf("User %s added to role '%s'", user, role))
+	return c.msg(models.MsgHelpDetail, help.Usage, models.Markdown(c.msg(models.HelpDescription(name))), help.Example, models.Markdown(access))
 }
 
-func (c *Commands) handleRemoveFromRole(args string) string {
-	parts := strings.Split(args, " ")
-	if len(parts) != 2 {
-		return models.MsgUsageRemoveFromRole
+func (c *Commands) handleCreateRole(ctx context.Context, actor models.Actor, args string) string {
+	if args == "" {
+		return c.msg(models.MsgProvideRoleName)
 	}
 
-	role, user := parts[0], parts[1]
-	if err := c.store.RemoveUserFromRole(role, user); err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+	role := roleArg(args)
+	if err := c.store.CreateRole(ctx, actor, role); err != nil {
+		return c.errorMessage(err)
 	}
+	c.undo.Push(actor.ChatID, createRoleOp{role: utils.SanitizeRoleName(role)})
 
-	return fmt.Sprintf(models.PrefixSuccess, fmt.Sprintf("User %s removed from role '%s'", user, role))
+	return c.msg(models.MsgRoleCreated, role)
 }
 
-func (c *Commands) handleListRoles() string {
-	roles, err := c.store.GetAllRoles()
+func (c *Commands) handleRemoveRole(ctx context.Context, actor models.Actor, args string) string {
+	// Removing a role drops all of its memberships, so it only happens when
+	// confirmed with a trailing "confirm"
+	fields, err := utils.SplitArgs(args)
+	if err != nil {
+		return c.msg(models.MsgUnbalancedQuotes)
+	}
+	confirmed := len(fields) > 1 && strings.EqualFold(fields[len(fields)-1], removeRoleConfirmation)
+	if confirmed {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return c.msg(models.MsgProvideRoleName)
+	}
+	role := utils.SanitizeRoleName(strings.Join(fields, " "))
+
+	// Remember the members so the removal can be undone
+	members, err := c.store.GetUsersInRole(ctx, role)
 	if err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+		return c.errorMessage(err)
+	}
+
+	if !confirmed {
+		roles, err := c.store.GetAllRoles(ctx, true)
+		if err != nil {
+			return c.errorMessage(err)
+		}
+		if !utils.Contains(roles, role) {
+			return c.errorMessage(models.ErrRoleNotFound{Role: role})
+		}
+		return c.msg(models.MsgConfirmRemoveRole, len(members), role, role)
 	}
 
-	if len(roles) == 0 {
-		return models.MsgNoRoles
+	if err := c.store.RemoveRole(ctx, actor, role); err != nil {
+		return c.errorMessage(err)
 	}
+	c.undo.Push(actor.ChatID, removeRoleOp{role: role, members: members})
 
-	return fmt.Sprintf(models.PrefixInfo, "Roles: "+strings.Join(roles, ", "))
+	return c.msg(models.MsgRoleRemoved, role)
 }
 
-func (c *Commands) handleListMembers(args string) string {
+func (c *Commands) handleArchiveRole(ctx context.Context, actor models.Actor, args string, archived bool) string {
 	if args == "" {
-		return models.MsgProvideRoleName
+		return c.msg(models.MsgProvideRoleName)
+	}
+
+	role := roleArg(args)
+	if err := c.store.SetRoleArchived(ctx, actor, role, archived); err != nil {
+		return c.errorMessage(err)
+	}
+
+	role = utils.SanitizeRoleName(role)
+	if archived {
+		return c.msg(models.MsgRoleArchivedOK, role)
+	}
+	return c.msg(models.MsgRoleRestored, role)
+}
+
+func (c *Commands) handleAddToRole(ctx context.Context, actor models.Actor, message *tgbotapi.Message, args string) string {
+	parts, err := utils.SplitArgs(args)
+	if err != nil {
+		return c.msg(models.MsgUnbalancedQuotes)
+	}
+	parts, ttl, ok := splitExpires(parts)
+	if !ok {
+		return c.msg(models.MsgUsageAddToRole)
+	}
+	role, user, target, errMsg := c.roleAndUser(message, parts, models.MsgUsageAddToRole)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	added, err := c.store.AddUserToRoleWithExpiry(ctx, actor, role, user, expiresAt)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	// Remember the Telegram ID when the user was picked from a reply
+	if target != nil {
+		if err := c.store.UpsertUser(ctx, userFrom(user, target)); err != nil {
+			c.logger.WithError(err).Warn("Failed to record telegram id")
+		}
+	}
+
+	if !added {
+		return c.msg(models.MsgUserAlreadyInRole, user, role)
+	}
+	c.undo.Push(actor.ChatID, addToRoleOp{role: utils.SanitizeRoleName(role), user: user})
+
+	if !expiresAt.IsZero() {
+		return c.msg(models.MsgUserAddedUntil, user, role, utils.FormatTime(expiresAt))
+	}
+	return c.msg(models.MsgUserAdded, user, role)
+}
+
+// splitExpires removes an --expires <duration> flag from command arguments. It
+// returns the remaining arguments and the duration, which is zero without the
+// flag, or ok false if the duration is missing or invalid.
+func splitExpires(args []string) (rest []string, ttl time.Duration, ok bool) {
+	for i, arg := range args {
+		if arg != "--expires" {
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, 0, false
+		}
+		ttl, err := utils.ParseDuration(args[i+1])
+		if err != nil {
+			return nil, 0, false
+		}
+		return append(args[:i:i], args[i+2:]...), ttl, true
+	}
+	return args, 0, true
+}
+
+func (c *Commands) handleRemoveFromRole(ctx context.Context, actor models.Actor, message *tgbotapi.Message, args string) string {
+	parts, err := utils.SplitArgs(args)
+	if err != nil {
+		return c.msg(models.MsgUnbalancedQuotes)
+	}
+	role, user, _, errMsg := c.roleAndUser(message, parts, models.MsgUsageRemoveFromRole)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	if err := c.store.RemoveUserFromRole(ctx, actor, role, user); err != nil {
+		return c.errorMessage(err)
+	}
+	c.undo.Push(actor.ChatID, removeFromRoleOp{role: utils.SanitizeRoleName(role), user: user})
+
+	return c.msg(models.MsgUserRemoved, user, role)
+}
+
+func (c *Commands) handleTransferRole(ctx context.Context, actor models.Actor, message *tgbotapi.Message, args string) string {
+	parts, err := utils.SplitArgs(args)
+	if err != nil {
+		return c.msg(models.MsgUnbalancedQuotes)
+	}
+	role, owner, target, errMsg := c.roleAndUser(message, parts, models.MsgUsageTransferRole)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	// A user picked from a reply is known to the bot from now on
+	if target != nil {
+		if err := c.store.UpsertUser(ctx, userFrom(owner, target)); err != nil {
+			return c.errorMessage(err)
+		}
+	}
+
+	if err := c.store.SetRoleOwner(ctx, actor, role, owner); err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgRoleTransferred, utils.SanitizeRoleName(role), owner)
+}
+
+// userFrom builds the user record of a Telegram user picked from a reply
+func userFrom(name string, target *tgbotapi.User) models.User {
+	return models.User{
+		Name:       name,
+		TelegramID: target.ID,
+		FirstName:  target.FirstName,
+		LastName:   target.LastName,
+	}
+}
+
+// roleAndUser extracts the role and username from the split arguments of a
+// membership command. The username is normalized like the store does, so a
+// leading @ is optional and responses show the name as stored.
+// When only a role is given and the command replies to another message, the
+// author of that message is used as the target user and returned as well. A
+// reply to a forwarded message targets the author of the original message.
+// A non-empty errMsg is returned when the arguments can't be resolved, using
+// the usage message key when they are missing.
+func (c *Commands) roleAndUser(message *tgbotapi.Message, parts []string, usage string) (role, user string, target *tgbotapi.User, errMsg string) {
+	switch {
+	case len(parts) == 2:
+		// Users naturally write "@john"; it names the same user as "john"
+		return parts[0], utils.SanitizeUsername(parts[1]), nil, ""
+	case len(parts) == 1 && message.ReplyToMessage != nil && message.ReplyToMessage.From != nil:
+		target = message.ReplyToMessage.From
+		if reply := message.ReplyToMessage; reply.ForwardDate != 0 {
+			// Users who hide their account in forwards only leave a name
+			if reply.ForwardFrom == nil {
+				return "", "", nil, c.msg(models.MsgForwardHidden)
+			}
+			target = reply.ForwardFrom
+		}
+		if target.UserName == "" {
+			return "", "", nil, c.msg(models.MsgReplyUserNoUsername)
+		}
+		if target.IsBot && c.config.BlockBotUsernames {
+			return "", "", nil, c.msg(models.MsgReplyUserIsBot)
+		}
+		return parts[0], utils.SanitizeUsername(target.UserName), target, ""
+	default:
+		return "", "", nil, c.msg(usage)
+	}
+}
+
+// checkBanned rejects custom ping text that contains one of BANNED_WORDS
+func (c *Commands) checkBanned(text string) error {
+	if _, banned := utils.FindBanned(text, c.config.BannedWords); banned {
+		return models.ErrInvalidInput{Field: "message", Value: text, Reason: "contains a banned word"}
+	}
+	return nil
+}
+
+// roleArg returns the role named by the arguments of a command that takes
+// only a role. The whole text is the role name, so quotes are optional and
+// only removed when they enclose all of it.
+func roleArg(args string) string {
+	if role, rest, err := utils.NextArg(args); err == nil && rest == "" {
+		return role
+	}
+	return strings.TrimSpace(args)
+}
+
+func (c *Commands) handleListRoles(ctx context.Context, args string) string {
+	if pattern := strings.TrimSpace(args); pattern != "" {
+		roles, err := c.store.GetRolesMatching(ctx, pattern)
+		if err != nil {
+			return c.errorMessage(err)
+		}
+		if len(roles) == 0 {
+			return c.msg(models.MsgNoRoles)
+		}
+		return c.msg(models.MsgRoles, strings.Join(roles, ", "))
+	}
+
+	categories, err := c.store.GetRolesByCategory(ctx)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	if len(categories) == 0 {
+		return c.msg(models.MsgNoRoles)
+	}
+
+	// Without any categories, keep the flat list
+	if roles, ok := categories[models.UncategorizedCategory]; ok && len(categories) == 1 {
+		return c.msg(models.MsgRoles, strings.Join(roles, ", "))
+	}
+
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		if name != models.UncategorizedCategory {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := categories[models.UncategorizedCategory]; ok {
+		names = append(names, models.UncategorizedCategory)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(c.msg(models.MsgRolesHeader))
+	for _, name := range names {
+		label := utils.EscapeMarkdownV2(name)
+		if name == models.UncategorizedCategory {
+			label = c.msg(models.MsgOtherCategory)
+		}
+		sb.WriteString(fmt.Sprintf("\n%s: %s", label, utils.EscapeMarkdownV2(strings.Join(categories[name], ", "))))
+	}
+	return sb.String()
+}
+
+func (c *Commands) handleSetCategory(ctx context.Context, actor models.Actor, args string) string {
+	fields, category := leadingFields(args, 1)
+	if len(fields) == 0 {
+		return c.msg(models.MsgUsageSetCategory)
+	}
+
+	role := fields[0]
+	if err := c.store.SetRoleCategory(ctx, actor, role, category); err != nil {
+		return c.errorMessage(err)
+	}
+
+	role = utils.SanitizeRoleName(role)
+	if category = utils.SanitizeRoleName(category); category == "" {
+		return c.msg(models.MsgCategoryCleared, role)
+	}
+	return c.msg(models.MsgCategorySet, role, category)
+}
+
+// handleSetPingTemplate shows, sets, or resets the ping template of the chat
+func (c *Commands) handleSetPingTemplate(ctx context.Context, actor models.Actor, args string) string {
+	switch template := strings.TrimSpace(args); {
+	case template == "":
+		current, err := c.store.GetPingTemplate(ctx, actor.ChatID)
+		if err != nil {
+			return c.errorMessage(err)
+		}
+		if current == "" {
+			return c.msg(models.MsgPingTemplateDefault)
+		}
+		return c.msg(models.MsgPingTemplateCurrent, current)
+	case strings.EqualFold(template, pingTemplateReset):
+		if err := c.store.SetPingTemplate(ctx, actor, ""); err != nil {
+			return c.errorMessage(err)
+		}
+		return c.msg(models.MsgPingTemplateReset)
+	}
+
+	if err := c.checkBanned(args); err != nil {
+		return c.errorMessage(err)
+	}
+	if err := c.store.SetPingTemplate(ctx, actor, args); err != nil {
+		return c.errorMessage(err)
+	}
+	return c.msg(models.MsgPingTemplateSet, utils.SanitizeMessage(args))
+}
+
+func (c *Commands) handleListMembers(ctx context.Context, args string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if args == "" {
+		return c.msg(models.MsgProvideRoleName), nil
+	}
+
+	// The role may be followed by --format <format>, or --mentions or
+	// --count for short
+	format := listFormatPlain
+	var role []string
+	fields, err := utils.SplitArgs(args)
+	if err != nil {
+		return c.msg(models.MsgUnbalancedQuotes), nil
+	}
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "--format":
+			if i+1 == len(fields) || !utils.Contains(listFormats, strings.ToLower(fields[i+1])) {
+				return c.msg(models.MsgUsageListMembers), nil
+			}
+			format = strings.ToLower(fields[i+1])
+			i++
+		case "--" + listFormatMentions, "--" + listFormatCount, "--" + listFormatPlain:
+			format = strings.TrimPrefix(fields[i], "--")
+		default:
+			role = append(role, fields[i])
+		}
+	}
+	if len(role) == 0 {
+		return c.msg(models.MsgProvideRoleName), nil
 	}
 
 	// Normalize role name to lowercase
-	roleName := strings.ToLower(strings.TrimSpace(args))
+	roleName := strings.ToLower(strings.Join(role, " "))
 
-	users, err := c.store.GetUsersInRole(roleName)
+	users, err := c.store.GetUsersInRole(ctx, roleName)
 	if err != nil {
-		return fmt.Sprintf(models.PrefixError, err)
+		return c.errorMessage(err), nil
+	}
+
+	switch {
+	case format == listFormatCount:
+		return c.msg(models.MsgRoleMemberCount, roleName, len(users)), nil
+	case len(users) == 0:
+		return c.msg(models.MsgNoUsersInRole, roleName), nil
+	}
+	return c.membersPage(roleName, format, users, 0)
+}
+
+// profileName matches the usernames Telegram allows, which have a t.me
+// profile link. Stored names are lowercase.
+var profileName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// membersPage formats one page of a role's members. Roles with more than
+// membersPerPage members get buttons to move between pages, unless the role
+// name is too long to fit in their callback data.
+func (c *Commands) membersPage(role, format string, users []string, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	pages := (len(users) + membersPerPage - 1) / membersPerPage
+	paged := pages > 1 && len(membersCallback(pages-1, format, role)) <= maxCallbackBytes
+	if paged {
+		if page < 0 || page >= pages {
+			page = 0
+		}
+		start := page * membersPerPage
+		users = users[start:min(start+membersPerPage, len(users))]
+	}
+
+	var text string
+	if format == listFormatMentions {
+		// Profile links are tappable like mentions but don't notify anyone.
+		// Names an admin typed in that can't be Telegram usernames have no
+		// profile and could break out of the link, so they are plain text.
+		links := make([]string, len(users))
+		for i, user := range users {
+			if profileName.MatchString(user) {
+				links[i] = fmt.Sprintf("[@%s](https://t.me/%s)", utils.EscapeMarkdownV2(user), user)
+			} else {
+				links[i] = "@" + utils.EscapeMarkdownV2(user)
+			}
+		}
+		text = c.msg(models.MsgUsersInRole, role, models.Markdown(strings.Join(links, ", ")))
+	} else {
+		text = c.msg(models.MsgUsersInRole, role, strings.Join(users, ", "))
+	}
+	if !paged {
+		return text, nil
+	}
+
+	text += "\n" + c.msg(models.MsgMembersPage, page+1, pages)
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(c.msg(models.MsgPreviousPage), membersCallback(page-1, format, role)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(c.msg(models.MsgNextPage), membersCallback(page+1, format, role)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(nav)
+	return text, &keyboard
+}
+
+func (c *Commands) handleUndo(ctx context.Context, actor models.Actor) string {
+	op, ok := c.undo.Pop(actor.ChatID)
+	if !ok {
+		return c.msg(models.MsgNothingToUndo)
+	}
+
+	if err := op.Undo(ctx, c.store, actor); err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgUndone, models.Markdown(op.Description(c.locale)))
+}
+
+func (c *Commands) handleAuditLog(ctx context.Context, args string) string {
+	if args == "" {
+		return c.msg(models.MsgProvideRoleName)
+	}
+
+	// Normalize role name to lowercase
+	roleName := strings.ToLower(roleArg(args))
+
+	entries, err := c.store.GetAuditLog(ctx, roleName, models.AuditLogLimit)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	if len(entries) == 0 {
+		return c.msg(models.MsgNoAuditEntries, roleName)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(c.msg(models.MsgAuditHeader, roleName))
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s @%s %s", utils.FormatTime(entry.Timestamp), entry.Actor, entry.Action)
+		if entry.TargetUser != "" {
+			line += " " + entry.TargetUser
+		}
+		sb.WriteString("\n" + utils.EscapeMarkdownV2(line))
+	}
+	return sb.String()
+}
+
+// handleAllMembers lists every known user, one page at a time
+func (c *Commands) handleAllMembers(ctx context.Context, args string) string {
+	users, err := c.store.GetAllUsers(ctx)
+	if err != nil {
+		return c.errorMessage(err)
 	}
 
 	if len(users) == 0 {
-		return fmt.Sprintf("No users found in role '%s'", roleName)
+		return c.msg(models.MsgNoKnownUsers)
 	}
 
-	return fmt.Sprintf("Users in role '%s': %s", roleName, strings.Join(users, ", "))
+	pages := (len(users) + models.AllMembersPageSize - 1) / models.AllMembersPageSize
+	page := 1
+	if arg := strings.TrimSpace(args); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > pages {
+			return c.msg(models.MsgUsageAllMembers, pages)
+		}
+		page = n
+	}
+
+	start := (page - 1) * models.AllMembersPageSize
+	end := start + models.AllMembersPageSize
+	if end > len(users) {
+		end = len(users)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(c.msg(models.MsgAllMembersHeader, len(users), page, pages))
+	for _, user := range users[start:end] {
+		if user.Roles == 0 {
+			sb.WriteString("\n" + c.msg(models.MsgWithoutRoles, user.Name))
+			continue
+		}
+		sb.WriteString("\n" + utils.EscapeMarkdownV2(user.Name))
+	}
+	return sb.String()
+}
+
+func (c *Commands) handlePrune(ctx context.Context, actor models.Actor) string {
+	removed, err := c.store.PruneOrphanUsers(ctx)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	c.logger.WithFields(map[string]interface{}{
+		"actor":   actor.Username,
+		"removed": removed,
+	}).Info("Pruned users without roles")
+	return c.msg(models.MsgUsersPruned, removed)
+}
+
+// handleNormalizeRoles lowercases role names left in mixed case by older
+// versions, merging roles whose names then collide
+func (c *Commands) handleNormalizeRoles(ctx context.Context, actor models.Actor) string {
+	renamed, merged, err := c.store.NormalizeRoleNames(ctx, actor)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if renamed == 0 && merged == 0 {
+		return c.msg(models.MsgRolesAlreadyLower)
+	}
+	return c.msg(models.MsgRolesNormalized, renamed, merged)
+}
+
+func (c *Commands) handleReloadConfig(actor models.Actor) string {
+	if c.reload == nil {
+		return c.msg(models.MsgInternalError)
+	}
+
+	changed, needRestart, err := c.reload()
+	if err != nil {
+		c.logger.WithError(err).WithField("actor", actor.Username).Warn("Rejected configuration reload")
+		return c.msg(models.MsgReloadFailed, err.Error())
+	}
+
+	text := c.msg(models.MsgConfigUnchanged)
+	if len(changed) > 0 {
+		text = c.msg(models.MsgConfigReloaded, strings.Join(changed, ", "))
+	}
+	if len(needRestart) > 0 {
+		text += "\n" + c.msg(models.MsgReloadNeedsRestart, strings.Join(needRestart, ", "))
+	}
+	return text
+}
+
+func (c *Commands) handleSchedule(ctx context.Context, actor models.Actor, args string) string {
+	fields, message := leadingFields(args, 2)
+	if len(fields) < 2 {
+		return c.msg(models.MsgUsageSchedule)
+	}
+
+	// A spec is either a descriptor like @daily or five cron fields
+	role := fields[0]
+	spec := fields[1]
+	if !strings.HasPrefix(spec, "@") {
+		fields, message = leadingFields(args, 6)
+		if len(fields) < 6 {
+			return c.msg(models.MsgUsageSchedule)
+		}
+		spec = strings.Join(fields[1:], " ")
+	}
+
+	if _, err := scheduler.ParseSpec(spec); err != nil {
+		return c.errorMessage(err)
+	}
+	if err := c.checkBanned(message); err != nil {
+		return c.errorMessage(err)
+	}
+
+	ping := models.ScheduledPing{
+		ChatID:  actor.ChatID,
+		Role:    role,
+		Spec:    spec,
+		Message: utils.SanitizeMessage(message),
+	}
+	id, err := c.store.CreateScheduledPing(ctx, actor, ping)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgScheduleCreated, id, strings.ToLower(role), spec)
+}
+
+func (c *Commands) handleUnschedule(ctx context.Context, actor models.Actor, args string) string {
+	id, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		return c.msg(models.MsgUsageUnschedule)
+	}
+
+	if err := c.store.DeleteScheduledPing(ctx, actor, id); err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgScheduleRemoved, id)
+}
+
+func (c *Commands) handleListSchedules(ctx context.Context, chatID int64) string {
+	pings, err := c.store.GetScheduledPingsForChat(ctx, chatID)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	if len(pings) == 0 {
+		return c.msg(models.MsgNoSchedules)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(c.msg(models.MsgSchedulesHeader))
+	for _, ping := range pings {
+		sb.WriteString("\n" + c.msg(models.MsgScheduleEntry, ping.ID, ping.Role, ping.Spec))
+		if ping.Message != "" {
+			sb.WriteString(": " + utils.EscapeMarkdownV2(ping.Message))
+		}
+	}
+	return sb.String()
+}
+
+// handleWhoAmI shows the caller's identity as the bot sees it
+func (c *Commands) handleWhoAmI(message *tgbotapi.Message) string {
+	username := c.msg(models.MsgNoUsername)
+	if message.From.UserName != "" {
+		username = utils.EscapeMarkdownV2("@" + message.From.UserName)
+	}
+
+	admin := c.msg(models.MsgNo)
+	if c.security.IsAdmin(message.From.UserName) {
+		admin = c.msg(models.MsgYes)
+	}
+
+	return c.msg(models.MsgWhoAmI, models.Markdown(username), message.From.ID, message.Chat.ID, models.Markdown(admin))
+}
+
+// handleFeedback forwards a user's feedback to the configured feedback chat
+func (c *Commands) handleFeedback(send SendFunc, message *tgbotapi.Message) string {
+	if c.config.FeedbackChatID == 0 {
+		return c.msg(models.MsgFeedbackDisabled)
+	}
+
+	text := utils.SanitizeMessage(message.CommandArguments())
+	if strings.TrimSpace(text) == "" {
+		return c.msg(models.MsgUsageFeedback)
+	}
+
+	if !c.feedback.Allow(message.From.ID) {
+		return c.msg(models.MsgFeedbackCooldown, int(feedbackCooldown.Minutes()))
+	}
+
+	sender := message.From.FirstName
+	if message.From.UserName != "" {
+		sender = "@" + message.From.UserName
+	}
+	chat := strconv.FormatInt(message.Chat.ID, 10)
+	if message.Chat.Title != "" {
+		chat = fmt.Sprintf("'%s' (%d)", message.Chat.Title, message.Chat.ID)
+	}
+
+	forward := tgbotapi.NewMessage(c.config.FeedbackChatID, c.msg(models.MsgFeedbackForward, sender, message.From.ID, chat, text))
+	forward.ParseMode = tgbotapi.ModeMarkdownV2
+	if _, err := send(forward.ChatID, forward); err != nil {
+		return c.errorMessage(err)
+	}
+
+	return c.msg(models.MsgFeedbackSent)
+}
+
+// handleStatus gives a quick summary of the bot's health and activity
+func (c *Commands) handleStatus(ctx context.Context) string {
+	roles, err := c.store.GetAllRoles(ctx, false)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	users, err := c.store.GetAllUsers(ctx)
+	if err != nil {
+		return c.errorMessage(err)
+	}
+
+	var updates int64
+	if c.updates != nil {
+		updates = c.updates()
+	}
+
+	return c.msg(models.MsgBotStatus,
+		time.Since(c.startedAt).Round(time.Second).String(),
+		len(roles),
+		len(users),
+		updates,
+		version.String(),
+	)
+}
+
+// handleBotInfo reports runtime diagnostics. Secrets such as the bot token
+// are deliberately left out.
+func (c *Commands) handleBotInfo() string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	dbStats := c.db.Stats()
+
+	// Allowed chats and the rate limit can change on a config reload
+	current := c.security.Config()
+	allowedChats := c.msg(models.MsgAllChats)
+	if len(current.AllowedChats) > 0 {
+		allowedChats = strconv.Itoa(len(current.AllowedChats))
+	}
+
+	const mib = 1 << 20
+	return c.msg(models.MsgBotInfo,
+		time.Since(c.startedAt).Round(time.Second).String(),
+		version.String(),
+		runtime.NumGoroutine(),
+		mem.HeapAlloc/mib,
+		mem.Sys/mib,
+		dbStats.OpenConnections,
+		dbStats.InUse,
+		c.config.WorkerCount,
+		current.RateLimitPerMin,
+		models.Markdown(allowedChats),
+	)
+}
+
+// leadingFields splits off up to n fields from the start of s and returns
+// them together with the untouched remainder, which keeps its internal
+// spacing and line breaks. A field in double quotes may contain spaces; an
+// unclosed quote is kept as part of the field.
+func leadingFields(s string, n int) ([]string, string) {
+	var fields []string
+	rest := strings.TrimSpace(s)
+	for len(fields) < n && rest != "" {
+		var field string
+		field, rest, _ = utils.NextArg(rest)
+		fields = append(fields, field)
+	}
+	return fields, rest
+}
+
+// errorMessage converts a store error into a user-facing message followed by
+// its error code. Unexpected errors are logged and shown as a generic message,
+// so internal details don't leak to users.
+func (c *Commands) errorMessage(err error) string {
+	return c.msg(models.MsgErrorCode, models.Markdown(c.describeError(err)), models.ErrorCode(err))
+}
+
+// describeError returns the user-facing description of an error
+func (c *Commands) describeError(err error) string {
+	var roleNotFound models.ErrRoleNotFound
+	var roleExists models.ErrRoleAlreadyExists
+	var userNotFound models.ErrUserNotFound
+	var invalidInput models.ErrInvalidInput
+	var scheduleNotFound models.ErrScheduleNotFound
+	var tooManyRoles models.ErrTooManyRoles
+	var unknownUser models.ErrUnknownUser
+	var unavailable models.ErrUnavailable
+
+	switch {
+	case errors.As(err, &roleNotFound):
+		return c.msg(models.MsgRoleNotFound, roleNotFound.Role)
+	case errors.As(err, &roleExists):
+		return c.msg(models.MsgRoleAlreadyExists, roleExists.Role)
+	case errors.As(err, &userNotFound):
+		return c.msg(models.MsgUserNotInRole, userNotFound.User, userNotFound.Role)
+	case errors.As(err, &invalidInput):
+		return c.msg(models.MsgInvalidInput, invalidInput.Field, invalidInput.Reason)
+	case errors.As(err, &unknownUser):
+		return c.msg(models.MsgUnknownUser, unknownUser.User)
+	case errors.As(err, &tooManyRoles):
+		return c.msg(models.MsgTooManyRoles, tooManyRoles.Limit)
+	case errors.As(err, &scheduleNotFound):
+		return c.msg(models.MsgScheduleNotFound, scheduleNotFound.ID)
+	case errors.As(err, &unavailable):
+		return c.msg(models.MsgUnavailable)
+	default:
+		c.logger.WithError(err).Error("Command failed")
+		return c.msg(models.MsgInternalError)
+	}
 }
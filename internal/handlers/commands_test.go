@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/config"
+	"didactic-spork/internal/middleware"
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/store/storetest"
+	"didactic-spork/pkg/logger"
+)
+
+const (
+	testAdmin  = "admin"
+	testChatID = -100
+)
+
+// newTestCommands creates command handlers backed by an in-memory store,
+// with testAdmin as the admin
+func newTestCommands(t *testing.T) (*Commands, *storetest.MemoryStore) {
+	t.Helper()
+	cfg := &config.Config{
+		AdminUsername:   testAdmin,
+		Locale:          "en",
+		RateLimitPerMin: 1000,
+		AdminReplies:    config.AdminRepliesGroup,
+	}
+	st := storetest.NewMemoryStore()
+	c := NewCommands(st, middleware.NewSecurity(cfg), middleware.NewChatThrottle(0), nil, cfg, logger.New("error", false))
+	return c, st
+}
+
+// run handles text sent by user as a command and returns the reply
+func run(t *testing.T, c *Commands, user, text string) string {
+	t.Helper()
+	return runIn(t, c, testChatID, user, text)
+}
+
+// runIn is run for a command sent in the chat chatID
+func runIn(t *testing.T, c *Commands, chatID int64, user, text string) string {
+	t.Helper()
+	command, _, _ := strings.Cut(text, " ")
+	update := tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 1, UserName: user},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "supergroup"},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}}
+
+	var replies []string
+	send := func(chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok {
+			replies = append(replies, msg.Text)
+		}
+		return tgbotapi.Message{}, nil
+	}
+	if err := c.Handle(context.Background(), send, update); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	if len(replies) != 1 {
+		t.Fatalf("%s: got %d replies, want 1", text, len(replies))
+	}
+	return replies[0]
+}
+
+func TestCreateRole(t *testing.T) {
+	c, st := newTestCommands(t)
+
+	if got := run(t, c, testAdmin, "/createrole Developers"); !strings.Contains(got, "created successfully") {
+		t.Errorf("create reply = %q", got)
+	}
+	roles, _ := st.GetAllRoles(context.Background(), false)
+	if len(roles) != 1 || roles[0] != "developers" {
+		t.Errorf("roles = %v, want [developers]", roles)
+	}
+
+	if got := run(t, c, testAdmin, "/createrole developers"); !strings.Contains(got, "already exists") {
+		t.Errorf("duplicate create reply = %q", got)
+	}
+	if got := run(t, c, "someone", "/createrole testers"); !strings.Contains(got, "not authorized") {
+		t.Errorf("non-admin create reply = %q", got)
+	}
+}
+
+func TestAddToRole(t *testing.T) {
+	c, st := newTestCommands(t)
+	run(t, c, testAdmin, "/createrole devs")
+
+	if got := run(t, c, testAdmin, "/addtorole devs @Alice"); !strings.Contains(got, "alice added to role 'devs'") {
+		t.Errorf("add reply = %q", got)
+	}
+	if got := run(t, c, testAdmin, "/addtorole missing bob"); !strings.Contains(got, "does not exist") {
+		t.Errorf("add to missing role reply = %q", got)
+	}
+	// @Alice and alice are the same user
+	run(t, c, testAdmin, "/addtorole devs alice")
+
+	users, _ := st.GetUsersInRole(context.Background(), "devs")
+	if len(users) != 1 || users[0] != "alice" {
+		t.Errorf("members = %v, want [alice]", users)
+	}
+
+	if got := run(t, c, testAdmin, "/removefromrole devs @alice"); !strings.Contains(got, "User alice removed from role 'devs'") {
+		t.Errorf("remove reply = %q", got)
+	}
+	if users, _ := st.GetUsersInRole(context.Background(), "devs"); len(users) != 0 {
+		t.Errorf("members = %v after removing @alice, want none", users)
+	}
+}
+
+func TestRoleOwnerCommands(t *testing.T) {
+	c, st := newTestCommands(t)
+	ctx := context.Background()
+	st.CreateRole(ctx, models.Actor{Username: "carol", ChatID: testChatID}, "qa team")
+
+	// The role's creator owns it and may manage its members
+	if got := run(t, c, "carol", `/addtorole "qa team" alice`); !strings.Contains(got, "alice added to role 'qa team'") {
+		t.Errorf("owner add reply = %q", got)
+	}
+	// Nobody else may, except the admin
+	if got := run(t, c, "dave", `/addtorole "qa team" bob`); !strings.Contains(got, "not authorized") {
+		t.Errorf("non-owner add reply = %q", got)
+	}
+	if got := run(t, c, "dave", `/removefromrole "qa team" alice`); !strings.Contains(got, "not authorized") {
+		t.Errorf("non-owner remove reply = %q", got)
+	}
+
+	users, _ := st.GetUsersInRole(ctx, "qa team")
+	if len(users) != 1 || users[0] != "alice" {
+		t.Errorf("members = %v, want [alice]", users)
+	}
+}
+
+func TestUnicodeRoleNames(t *testing.T) {
+	c, st := newTestCommands(t)
+
+	for _, name := range []string{"🚀launch", "Ёлка", "команда"} {
+		if got := run(t, c, testAdmin, "/createrole "+name); !strings.Contains(got, "created successfully") {
+			t.Errorf("create %s reply = %q", name, got)
+		}
+	}
+	// Case folding isn't limited to ASCII
+	if got := run(t, c, testAdmin, "/createrole ёлка"); !strings.Contains(got, "already exists") {
+		t.Errorf("create ёлка reply = %q", got)
+	}
+	run(t, c, testAdmin, "/addtorole ЁЛКА alice")
+	run(t, c, testAdmin, "/addtorole 🚀launch bob")
+
+	roles, _ := st.GetAllRoles(context.Background(), false)
+	if len(roles) != 3 {
+		t.Errorf("roles = %v, want 3", roles)
+	}
+	got := run(t, c, "carol", "/listroles")
+	for _, want := range []string{"🚀launch", "ёлка", "команда"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("list reply %q doesn't contain %q", got, want)
+		}
+	}
+	if got := run(t, c, "carol", "/ping ёлка"); !strings.Contains(got, "@alice") {
+		t.Errorf("ping ёлка reply = %q", got)
+	}
+	if got := run(t, c, "carol", "/ping 🚀launch"); !strings.Contains(got, "@bob") {
+		t.Errorf("ping 🚀launch reply = %q", got)
+	}
+}
+
+func TestPingRole(t *testing.T) {
+	c, _ := newTestCommands(t)
+	run(t, c, testAdmin, "/createrole devs")
+	run(t, c, testAdmin, "/addtorole devs alice")
+	run(t, c, testAdmin, "/addtorole devs bob")
+
+	got := run(t, c, "carol", "/ping devs deploy is done")
+	for _, want := range []string{"@alice", "@bob", "deploy is done"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ping reply %q doesn't contain %q", got, want)
+		}
+	}
+
+	if got := run(t, c, "carol", "/ping missing"); !strings.Contains(got, "No users found") {
+		t.Errorf("ping of missing role reply = %q", got)
+	}
+}
+
+func TestArchiveRole(t *testing.T) {
+	c, _ := newTestCommands(t)
+	run(t, c, testAdmin, "/createrole devs")
+	run(t, c, testAdmin, "/addtorole devs alice")
+
+	if got := run(t, c, testAdmin, "/archiverole devs"); !strings.Contains(got, "Role 'devs' archived") {
+		t.Errorf("archive reply = %q", got)
+	}
+	if got := run(t, c, "carol", "/ping devs"); !strings.Contains(got, "Role 'devs' is archived") || strings.Contains(got, "@alice") {
+		t.Errorf("ping of archived role reply = %q", got)
+	}
+
+	// Restoring brings the role back with its members
+	if got := run(t, c, testAdmin, "/restorerole devs"); !strings.Contains(got, "Role 'devs' restored") {
+		t.Errorf("restore reply = %q", got)
+	}
+	if got := run(t, c, "carol", "/ping devs"); !strings.Contains(got, "@alice") {
+		t.Errorf("ping of restored role reply = %q", got)
+	}
+}
+
+func TestPingBannedWords(t *testing.T) {
+	c, _ := newTestCommands(t)
+	run(t, c, testAdmin, "/createrole devs")
+	run(t, c, testAdmin, "/addtorole devs alice")
+
+	c.config.BannedWords = []string{"spam"}
+	for _, text := range []string{"/ping devs buy spam", "/ping devs FREE SPAM"} {
+		if got := run(t, c, "carol", text); !strings.Contains(got, "contains a banned word") || strings.Contains(got, "@alice") {
+			t.Errorf("%q reply = %q, want it refused", text, got)
+		}
+	}
+	if got := run(t, c, "carol", "/ping devs deploy is done"); !strings.Contains(got, "@alice") {
+		t.Errorf("ping with an allowed message reply = %q", got)
+	}
+
+	c.config.BannedWords = nil
+	if got := run(t, c, "carol", "/ping devs buy spam"); !strings.Contains(got, "@alice") {
+		t.Errorf("ping without banned words reply = %q", got)
+	}
+}
+
+func TestPingSkipsBots(t *testing.T) {
+	c, st := newTestCommands(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: testAdmin, ChatID: testChatID}
+	st.CreateRole(ctx, admin, "devs")
+	st.AddUserToRole(ctx, admin, "devs", "alice")
+	st.AddUserToRole(ctx, admin, "devs", "somebot")
+
+	c.config.BlockBotUsernames = true
+	if got := run(t, c, "carol", "/ping devs"); !strings.Contains(got, "@alice") || strings.Contains(got, "somebot") {
+		t.Errorf("ping reply = %q, want alice without somebot", got)
+	}
+}
+
+func TestPingWithoutRole(t *testing.T) {
+	c, _ := newTestCommands(t)
+
+	// Arguments that are only whitespace name no role
+	for _, text := range []string{"/ping", "/ping  ", "/ping \u00a0"} {
+		if got := run(t, c, "carol", text); got != "pong" {
+			t.Errorf("%q reply = %q, want pong", text, got)
+		}
+	}
+}
+
+func TestChatCommands(t *testing.T) {
+	c, _ := newTestCommands(t)
+	const otherChatID = -200
+	c.config.ChatCommands = map[int64][]string{testChatID: {models.CmdPing, models.CmdListRoles}}
+	runIn(t, c, otherChatID, testAdmin, "/addalias p ping")
+	runIn(t, c, otherChatID, testAdmin, "/addalias mk createrole")
+
+	const disabled = "disabled in this chat"
+	tests := []struct {
+		chatID  int64
+		text    string
+		allowed bool
+	}{
+		{testChatID, "/ping", true},
+		{testChatID, "/createrole devs", false},
+		{otherChatID, "/createrole devs", true},
+		// Aliases and /role subcommands are checked as the command they run
+		{testChatID, "/p", true},
+		{testChatID, "/mk ops", false},
+		{testChatID, "/role list", true},
+		{testChatID, "/role add devs alice", false},
+		{otherChatID, "/role add devs alice", true},
+	}
+	for _, tt := range tests {
+		got := runIn(t, c, tt.chatID, testAdmin, tt.text)
+		if blocked := strings.Contains(got, disabled); blocked == tt.allowed {
+			t.Errorf("%s in chat %d reply = %q, want allowed %v", tt.text, tt.chatID, got, tt.allowed)
+		}
+	}
+}
+
+func TestListMembersMentions(t *testing.T) {
+	c, st := newTestCommands(t)
+	ctx := context.Background()
+	admin := models.Actor{Username: testAdmin, ChatID: testChatID}
+	st.CreateRole(ctx, admin, "devs")
+	st.AddUserToRole(ctx, admin, "devs", "alice")
+	st.AddUserToRole(ctx, admin, "devs", "x)(https://evil.example")
+
+	got := run(t, c, "carol", "/listmembers devs --mentions")
+	if !strings.Contains(got, "[@alice](https://t.me/alice)") {
+		t.Errorf("reply %q doesn't link alice's profile", got)
+	}
+	if strings.Contains(got, "t.me/x") || !strings.Contains(got, `@x\)\(https://evil\.example`) {
+		t.Errorf("reply %q doesn't list the invalid username as escaped text", got)
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	c, _ := newTestCommands(t)
+
+	tests := []struct {
+		err  error
+		want string
+		code string
+	}{
+		{models.ErrRoleNotFound{Role: "devs"}, "Role 'devs' does not exist", models.CodeRoleNotFound},
+		{fmt.Errorf("failed to add user: %w", models.ErrRoleAlreadyExists{Role: "devs"}), "Role 'devs' already exists", models.CodeRoleAlreadyExists},
+		{models.ErrUserNotFound{User: "alice", Role: "devs"}, "User alice is not a member of role 'devs'", models.CodeUserNotInRole},
+		{models.ErrInvalidInput{Field: "role name", Value: "", Reason: "cannot be empty"}, "Invalid role name: cannot be empty", models.CodeInvalidInput},
+		{models.ErrTooManyRoles{Limit: 3}, "maximum of 3 roles", models.CodeTooManyRoles},
+		{models.ErrUnknownUser{User: "alice"}, "User alice is not known to the bot yet", models.CodeUnknownUser},
+		{fmt.Errorf("failed to list roles: %w", models.ErrUnavailable{}), "temporarily unavailable", models.CodeUnavailable},
+		{models.ErrScheduleNotFound{ID: 7}, `Scheduled ping \#7 not found`, models.CodeScheduleNotFound},
+		{errors.New("disk I/O error"), "Something went wrong", models.CodeInternal},
+	}
+	for _, tt := range tests {
+		got := c.describeError(tt.err)
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("describeError(%v) = %q, want it to contain %q", tt.err, got, tt.want)
+		}
+		if code := models.ErrorCode(tt.err); code != tt.code {
+			t.Errorf("ErrorCode(%v) = %q, want %q", tt.err, code, tt.code)
+		}
+	}
+}
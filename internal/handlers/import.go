@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// MemberListFunc returns the members of a chat the bot is able to see
+type MemberListFunc func(chatID int64) ([]tgbotapi.User, error)
+
+// SetMemberLister sets how /importmembers finds a group's members
+func (c *Commands) SetMemberLister(list MemberListFunc) {
+	c.members = list
+}
+
+// handleImportMembers adds the group's members to a role. Telegram's Bot API
+// only lists a group's administrators, so those are the members imported;
+// bots and users without a username are skipped.
+func (c *Commands) handleImportMembers(ctx context.Context, actor models.Actor, args string) string {
+	role := roleArg(args)
+	if role == "" {
+		return c.msg(models.MsgUsageImportMembers)
+	}
+	// Private chats have positive IDs and no member list
+	if c.members == nil || actor.ChatID >= 0 {
+		return c.msg(models.MsgImportGroupOnly)
+	}
+
+	members, err := c.members(actor.ChatID)
+	if err != nil {
+		c.logger.WithError(err).WithField("chat_id", actor.ChatID).Error("Failed to list chat members")
+		return c.msg(models.MsgImportFailed)
+	}
+
+	added, skipped := 0, 0
+	for i := range members {
+		member := &members[i]
+		if member.IsBot || c.isBlockedBot(member.UserName) {
+			continue
+		}
+		if member.UserName == "" {
+			skipped++
+			continue
+		}
+
+		user := utils.SanitizeUsername(member.UserName)
+		ok, err := c.store.AddUserToRole(ctx, actor, role, user)
+		if err != nil {
+			return c.errorMessage(err)
+		}
+		if err := c.store.UpsertUser(ctx, userFrom(user, member)); err != nil {
+			c.logger.WithError(err).Warn("Failed to record telegram id")
+		}
+		if ok {
+			added++
+		}
+	}
+
+	return c.msg(models.MsgMembersImported, added, utils.SanitizeRoleName(role), skipped)
+}
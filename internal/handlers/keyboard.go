@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+)
+
+// Callback data of the /roles and /listmembers keyboard buttons. Telegram
+// limits callback data to 64 bytes, so roles with longer names are left off
+// the keyboard.
+const (
+	callbackPing     = "ping:"
+	callbackPage     = "roles:"
+	callbackMembers  = "members:"
+	maxCallbackBytes = 64
+)
+
+// rolesPerPage is the number of role buttons shown per /roles page
+const rolesPerPage = 10
+
+// membersPerPage is the number of members shown per /listmembers page
+const membersPerPage = 50
+
+// membersCallback returns the callback data of a button showing a page of a
+// role's members, as members:<page>:<format>:<role>
+func membersCallback(page int, format, role string) string {
+	return callbackMembers + strconv.Itoa(page) + ":" + format + ":" + role
+}
+
+// handleRoles lists the roles as buttons that ping the role when tapped
+func (c *Commands) handleRoles(ctx context.Context) (string, *tgbotapi.InlineKeyboardMarkup) {
+	keyboard, err := c.rolesKeyboard(ctx, 0)
+	if err != nil {
+		return c.errorMessage(err), nil
+	}
+	if keyboard == nil {
+		return c.msg(models.MsgNoRoles), nil
+	}
+	return c.msg(models.MsgRolesKeyboard), keyboard
+}
+
+// rolesKeyboard builds one page of the /roles keyboard, one role per row,
+// followed by buttons to the previous and next pages. It returns nil if there
+// are no roles.
+func (c *Commands) rolesKeyboard(ctx context.Context, page int) (*tgbotapi.InlineKeyboardMarkup, error) {
+	all, err := c.store.GetAllRoles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	for _, role := range all {
+		if len(callbackPing+role) <= maxCallbackBytes {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	pages := (len(roles) + rolesPerPage - 1) / rolesPerPage
+	if page < 0 || page >= pages {
+		page = 0
+	}
+	start := page * rolesPerPage
+	end := start + rolesPerPage
+	if end > len(roles) {
+		end = len(roles)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, role := range roles[start:end] {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("@"+role, callbackPing+role),
+		))
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(c.msg(models.MsgPreviousPage), callbackPage+strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(c.msg(models.MsgNextPage), callbackPage+strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard, nil
+}
+
+// HandleCallback handles a tap on a keyboard button: a /roles role button
+// pings the role, and a page button edits the message to show another page
+// of the /roles keyboard or of the /listmembers list
+func (c *Commands) HandleCallback(ctx context.Context, send SendFunc, query *tgbotapi.CallbackQuery) error {
+	chatID := query.Message.Chat.ID
+
+	switch {
+	case strings.HasPrefix(query.Data, callbackPing):
+		if !c.security.IsCommandAllowed(chatID, models.CmdPing) {
+			return nil
+		}
+		text, err := c.PingRoles(ctx, chatID, []string{strings.TrimPrefix(query.Data, callbackPing)}, "")
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			return nil
+		}
+		if err := c.throttle.Wait(ctx, chatID); err != nil {
+			return err
+		}
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = tgbotapi.ModeMarkdownV2
+		_, err = send(chatID, msg)
+		return err
+
+	case strings.HasPrefix(query.Data, callbackPage):
+		page, err := strconv.Atoi(strings.TrimPrefix(query.Data, callbackPage))
+		if err != nil {
+			return nil
+		}
+		keyboard, err := c.rolesKeyboard(ctx, page)
+		if err != nil || keyboard == nil {
+			return err
+		}
+		_, err = send(chatID, tgbotapi.NewEditMessageReplyMarkup(chatID, query.Message.MessageID, *keyboard))
+		return err
+
+	case strings.HasPrefix(query.Data, callbackMembers):
+		if !c.security.IsCommandAllowed(chatID, models.CmdListMembers) {
+			return nil
+		}
+		fields := strings.SplitN(strings.TrimPrefix(query.Data, callbackMembers), ":", 3)
+		if len(fields) != 3 {
+			return nil
+		}
+		page, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil
+		}
+		format, role := fields[1], fields[2]
+		users, err := c.store.GetUsersInRole(ctx, role)
+		if err != nil || len(users) == 0 {
+			// The role was removed or emptied since the list was sent
+			return err
+		}
+		text, keyboard := c.membersPage(role, format, users, page)
+		if keyboard == nil {
+			keyboard = &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+		}
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, *keyboard)
+		edit.ParseMode = tgbotapi.ModeMarkdownV2
+		_, err = send(chatID, edit)
+		return err
+	}
+
+	return nil
+}
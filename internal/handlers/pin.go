@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+)
+
+// PinFunc pins a message in a chat
+type PinFunc func(chatID int64, messageID int) error
+
+// SetPinner sets how /ping --pin pins the ping
+func (c *Commands) SetPinner(pin PinFunc) {
+	c.pin = pin
+}
+
+// pinPing pins a ping that was just sent. If the bot isn't allowed to pin
+// messages in the chat, the ping stays as it is and the chat is told why.
+func (c *Commands) pinPing(send SendFunc, chatID int64, messageID int) error {
+	// A zero message ID means the send was skipped, e.g. because the bot
+	// can't post in the chat
+	if c.pin == nil || messageID == 0 {
+		return nil
+	}
+
+	err := c.pin(chatID, messageID)
+	if err == nil {
+		return nil
+	}
+	c.logger.WithError(err).WithFields(map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}).Warn("Failed to pin ping")
+
+	notice := tgbotapi.NewMessage(chatID, c.msg(models.MsgPinFailed))
+	notice.ParseMode = tgbotapi.ModeMarkdownV2
+	_, err = send(notice.ChatID, notice)
+	return err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// resolveCommand returns the command a message runs and its arguments.
+// Aliases are resolved first, then /role subcommands, so "/role add devs
+// alice" runs /addtorole with "devs alice" and goes through the same chat
+// and permission checks. A /role without a known subcommand is returned as
+// is and answered with its usage.
+func (c *Commands) resolveCommand(message *tgbotapi.Message) (command, args string) {
+	command = c.resolveAlias(message.Command())
+	args = message.CommandArguments()
+	if command != models.CmdRole {
+		return command, args
+	}
+
+	sub, rest, _ := utils.NextArg(args)
+	if target, ok := models.RoleSubcommands[strings.ToLower(sub)]; ok {
+		return target, rest
+	}
+	return command, args
+}
+
+// handleRole answers a /role without a known subcommand
+func (c *Commands) handleRole() string {
+	subs := make([]string, 0, len(models.RoleSubcommands))
+	for sub := range models.RoleSubcommands {
+		subs = append(subs, sub)
+	}
+	sort.Strings(subs)
+	return c.msg(models.MsgUsageRole, strings.Join(subs, ", "))
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/store"
+)
+
+// Undo limits
+const (
+	undoDepth  = 5
+	undoWindow = 15 * time.Minute
+)
+
+// Reversible is a mutating operation that can be reverted by /undo
+type Reversible interface {
+	// Undo reverts the operation on behalf of actor
+	Undo(ctx context.Context, store store.Store, actor models.Actor) error
+	// Description describes what the operation did in the given locale, as
+	// MarkdownV2 text
+	Description(locale string) string
+}
+
+type undoEntry struct {
+	op Reversible
+	at time.Time
+}
+
+// UndoStack keeps the most recent reversible operations of each chat
+type UndoStack struct {
+	mu     sync.Mutex
+	stacks map[int64][]undoEntry
+	depth  int
+	window time.Duration
+}
+
+// NewUndoStack creates an undo stack holding up to depth operations per chat,
+// each of which can be undone for the given window
+func NewUndoStack(depth int, window time.Duration) *UndoStack {
+	return &UndoStack{
+		stacks: make(map[int64][]undoEntry),
+		depth:  depth,
+		window: window,
+	}
+}
+
+// Push records an operation performed in a chat
+func (u *UndoStack) Push(chatID int64, op Reversible) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stack := append(u.stacks[chatID], undoEntry{op: op, at: time.Now()})
+	if len(stack) > u.depth {
+		stack = stack[len(stack)-u.depth:]
+	}
+	u.stacks[chatID] = stack
+}
+
+// Pop removes and returns the most recent operation of a chat that is still
+// within the undo window
+func (u *UndoStack) Pop(chatID int64) (Reversible, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stack := u.stacks[chatID]
+	if len(stack) == 0 {
+		return nil, false
+	}
+
+	last := stack[len(stack)-1]
+	if time.Since(last.at) > u.window {
+		// Everything below the newest entry is older still
+		delete(u.stacks, chatID)
+		return nil, false
+	}
+
+	if len(stack) == 1 {
+		delete(u.stacks, chatID)
+	} else {
+		u.stacks[chatID] = stack[:len(stack)-1]
+	}
+	return last.op, true
+}
+
+type createRoleOp struct {
+	role string
+}
+
+func (o createRoleOp) Undo(ctx context.Context, store store.Store, actor models.Actor) error {
+	return store.RemoveRole(ctx, actor, o.role)
+}
+
+func (o createRoleOp) Description(locale string) string {
+	return models.Msg(models.MsgUndoCreateRole, locale, o.role)
+}
+
+type removeRoleOp struct {
+	role    string
+	members []string
+}
+
+func (o removeRoleOp) Undo(ctx context.Context, store store.Store, actor models.Actor) error {
+	if err := store.CreateRole(ctx, actor, o.role); err != nil {
+		return err
+	}
+	for _, member := range o.members {
+		if _, err := store.AddUserToRole(ctx, actor, o.role, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o removeRoleOp) Description(locale string) string {
+	return models.Msg(models.MsgUndoRemoveRole, locale, o.role, len(o.members))
+}
+
+type addToRoleOp struct {
+	role string
+	user string
+}
+
+func (o addToRoleOp) Undo(ctx context.Context, store store.Store, actor models.Actor) error {
+	return store.RemoveUserFromRole(ctx, actor, o.role, o.user)
+}
+
+func (o addToRoleOp) Description(locale string) string {
+	return models.Msg(models.MsgUndoAddToRole, locale, o.user, o.role)
+}
+
+type removeFromRoleOp struct {
+	role string
+	user string
+}
+
+func (o removeFromRoleOp) Undo(ctx context.Context, store store.Store, actor models.Actor) error {
+	_, err := store.AddUserToRole(ctx, actor, o.role, o.user)
+	return err
+}
+
+func (o removeFromRoleOp) Description(locale string) string {
+	return models.Msg(models.MsgUndoRemoveFromRole, locale, o.user, o.role)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// recordUsage logs a command that is about to run for /usage. Failing to
+// log it never keeps the command from running.
+func (c *Commands) recordUsage(ctx context.Context, command string, chatID int64) {
+	if !models.IsCommand(command) {
+		return
+	}
+	if err := c.store.LogCommand(ctx, command, chatID, time.Now()); err != nil {
+		c.logger.WithError(err).WithField("command", command).Warn("Failed to log command usage")
+	}
+}
+
+// handleUsage reports how often each command was used over the last days,
+// with the change from the days before
+func (c *Commands) handleUsage(ctx context.Context, args string) string {
+	days := models.UsageDefaultDays
+	maxDays := int(models.CommandLogRetention / (24 * time.Hour) / 2)
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > maxDays {
+			return c.msg(models.MsgUsageUsage, maxDays)
+		}
+		days = n
+	}
+
+	window := time.Duration(days) * 24 * time.Hour
+	now := time.Now()
+	current, err := c.store.GetUsageStats(ctx, now.Add(-window))
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	if len(current) == 0 {
+		return c.msg(models.MsgNoUsage, days)
+	}
+
+	// The previous window's counts are what the last two windows add up to
+	// beyond the current one
+	both, err := c.store.GetUsageStats(ctx, now.Add(-2*window))
+	if err != nil {
+		return c.errorMessage(err)
+	}
+	previous := make(map[string]int, len(both))
+	for _, count := range both {
+		previous[count.Command] = count.Count
+	}
+	for _, count := range current {
+		previous[count.Command] -= count.Count
+	}
+
+	var sb strings.Builder
+	sb.WriteString(c.msg(models.MsgUsageHeader, days))
+	for i, count := range current {
+		if i == models.UsageListLimit {
+			rest := 0
+			for _, other := range current[i:] {
+				rest += other.Count
+			}
+			sb.WriteString("\n" + c.msg(models.MsgUsageOthers, len(current)-i, rest))
+			break
+		}
+		line := fmt.Sprintf("/%s: %d (%+d)", count.Command, count.Count, count.Count-previous[count.Command])
+		sb.WriteString("\n" + utils.EscapeMarkdownV2(line))
+	}
+	return sb.String()
+}
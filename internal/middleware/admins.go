@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// AdminStore lists the admins kept in the database
+type AdminStore interface {
+	ListAdmins(ctx context.Context) ([]string, error)
+}
+
+// LoadAdmins replaces the cached admins with those in the store. It runs at
+// startup and after every /promote or /demote, so IsAdmin never has to query
+// the database.
+func (s *Security) LoadAdmins(ctx context.Context, store AdminStore) error {
+	names, err := store.ListAdmins(ctx)
+	if err != nil {
+		return err
+	}
+
+	admins := make(map[string]bool, len(names))
+	for _, name := range names {
+		admins[strings.ToLower(name)] = true
+	}
+
+	s.mu.Lock()
+	s.admins = admins
+	s.mu.Unlock()
+	return nil
+}
+
+// Admins returns the admin from the configuration followed by the promoted
+// admins in name order
+func (s *Security) Admins() []string {
+	configAdmin := s.Config().AdminUsername
+
+	s.mu.RLock()
+	promoted := make([]string, 0, len(s.admins))
+	for name := range s.admins {
+		if !strings.EqualFold(name, configAdmin) {
+			promoted = append(promoted, name)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.Sort(promoted)
+	return append([]string{configAdmin}, promoted...)
+}
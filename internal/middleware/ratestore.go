@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/logger"
+)
+
+// rateFlushInterval is how often rate limit events are written to the
+// database in one batch, so messages never wait on a write
+const rateFlushInterval = 5 * time.Second
+
+// RateEventStore persists rate limit events
+type RateEventStore interface {
+	GetRateEvents(ctx context.Context, since time.Time) ([]models.RateEvent, error)
+	SaveRateEvents(ctx context.Context, events []models.RateEvent, pruneBefore time.Time) error
+}
+
+// Restore loads the events of the current window and starts recording new
+// requests so they can be saved with Flush
+func (rl *RateLimiter) Restore(events []models.RateEvent) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for _, event := range events {
+		rl.requests[event.UserID] = append(rl.requests[event.UserID], event.At)
+	}
+	rl.persist = true
+}
+
+// Flush saves the requests recorded since the last flush and prunes events
+// that fell out of the window. Events that fail to save are kept for the next flush.
+func (rl *RateLimiter) Flush(ctx context.Context, store RateEventStore) error {
+	rl.mu.Lock()
+	events := rl.pending
+	rl.pending = nil
+	rl.mu.Unlock()
+
+	if err := store.SaveRateEvents(ctx, events, time.Now().Add(-rl.window)); err != nil {
+		rl.mu.Lock()
+		rl.pending = append(events, rl.pending...)
+		rl.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RestoreRateLimits loads the rate limit events of the current window from
+// the store and returns how many were restored
+func (s *Security) RestoreRateLimits(ctx context.Context, store RateEventStore) (int, error) {
+	events, err := store.GetRateEvents(ctx, time.Now().Add(-s.rateLimiter.window))
+	if err != nil {
+		return 0, err
+	}
+	s.rateLimiter.Restore(events)
+	return len(events), nil
+}
+
+// SaveRateLimits saves new rate limit events in batches until the context is
+// cancelled, then saves what's left
+func (s *Security) SaveRateLimits(ctx context.Context, store RateEventStore, log *logger.Logger) {
+	ticker := time.NewTicker(rateFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.rateLimiter.Flush(context.WithoutCancel(ctx), store); err != nil {
+				log.WithError(err).Error("Failed to save rate limits")
+			}
+			return
+		case <-ticker.C:
+			if err := s.rateLimiter.Flush(ctx, store); err != nil {
+				log.WithError(err).Warn("Failed to save rate limits")
+			}
+		}
+	}
+}
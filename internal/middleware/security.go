@@ -2,7 +2,6 @@
 package middleware
 
 import (
-	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +18,10 @@ type RateLimiter struct {
 	requests map[int64][]time.Time
 	limit    int
 	window   time.Duration
+
+	// persist records allowed requests in pending so they can be saved
+	persist bool
+	pending []models.RateEvent
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -56,13 +59,49 @@ func (rl *RateLimiter) Allow(userID int64) bool {
 
 	// Add current request
 	rl.requests[userID] = append(rl.requests[userID], now)
+	if rl.persist {
+		rl.pending = append(rl.pending, models.RateEvent{UserID: userID, At: now})
+	}
 	return true
 }
 
+// RetryAfter returns how long until the user's oldest request leaves the
+// window and another request is allowed, or zero if one is allowed now
+func (rl *RateLimiter) RetryAfter(userID int64) time.Duration {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	requests := rl.requests[userID]
+	if len(requests) < rl.limit {
+		return 0
+	}
+
+	// Requests are kept in order, so the oldest one that still counts is
+	// limit requests before the end
+	oldest := requests[len(requests)-rl.limit]
+	if wait := time.Until(oldest.Add(rl.window)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// SetLimit changes how many requests a user may make per window. Requests
+// already made still count towards the new limit.
+func (rl *RateLimiter) SetLimit(limit int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limit = limit
+}
+
 // Security handles security validation
 type Security struct {
+	// mu guards config, which Reload replaces while updates are handled,
+	// and admins
+	mu          sync.RWMutex
 	config      *config.Config
 	rateLimiter *RateLimiter
+	// admins caches the lowercased names of the admins kept in the database
+	admins map[string]bool
 }
 
 // NewSecurity creates a new security middleware
@@ -73,6 +112,22 @@ func NewSecurity(cfg *config.Config) *Security {
 	}
 }
 
+// Config returns the configuration security checks currently use
+func (s *Security) Config() *config.Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Reload switches to a new configuration: the allowed chats, per-chat
+// commands, admin, and rate limit of cfg apply from the next check on
+func (s *Security) Reload(cfg *config.Config) {
+	s.mu.Lock()
+	s.config = cfg
+	s.mu.Unlock()
+	s.rateLimiter.SetLimit(cfg.RateLimitPerMin)
+}
+
 // ValidateMessage performs security validation on incoming messages
 func (s *Security) ValidateMessage(update tgbotapi.Update) error {
 	if update.Message == nil {
@@ -80,17 +135,14 @@ func (s *Security) ValidateMessage(update tgbotapi.Update) error {
 	}
 
 	// Check if chat is allowed
-	if len(s.config.AllowedChats) > 0 {
-		chatID := update.Message.Chat.ID
-		if !s.isChatAllowed(chatID) {
-			return fmt.Errorf("chat %d is not allowed", chatID)
-		}
+	if chatID := update.Message.Chat.ID; !s.IsChatAllowed(chatID) {
+		return models.ErrChatNotAllowed{ChatID: chatID}
 	}
 
 	// Rate limiting
 	userID := update.Message.From.ID
 	if !s.rateLimiter.Allow(userID) {
-		return models.ErrRateLimited{UserID: userID}
+		return models.ErrRateLimited{UserID: userID, RetryAfter: s.rateLimiter.RetryAfter(userID)}
 	}
 
 	// Basic input validation
@@ -105,9 +157,29 @@ func (s *Security) ValidateMessage(update tgbotapi.Update) error {
 	return nil
 }
 
-// isChatAllowed checks if a chat ID is in the allowed chats list
-func (s *Security) isChatAllowed(chatID int64) bool {
-	for _, allowedChat := range s.config.AllowedChats {
+// ValidateCallback performs security validation on taps of inline keyboard
+// buttons, which count towards the user's rate limit like messages
+func (s *Security) ValidateCallback(query *tgbotapi.CallbackQuery) error {
+	if chatID := query.Message.Chat.ID; !s.IsChatAllowed(chatID) {
+		return models.ErrChatNotAllowed{ChatID: chatID}
+	}
+
+	userID := query.From.ID
+	if !s.rateLimiter.Allow(userID) {
+		return models.ErrRateLimited{UserID: userID, RetryAfter: s.rateLimiter.RetryAfter(userID)}
+	}
+
+	return nil
+}
+
+// IsChatAllowed checks if a chat ID is in the allowed chats list.
+// All chats are allowed when no list is configured.
+func (s *Security) IsChatAllowed(chatID int64) bool {
+	allowedChats := s.Config().AllowedChats
+	if len(allowedChats) == 0 {
+		return true
+	}
+	for _, allowedChat := range allowedChats {
 		if chatID == allowedChat {
 			return true
 		}
@@ -115,7 +187,34 @@ func (s *Security) isChatAllowed(chatID int64) bool {
 	return false
 }
 
-// IsAdmin checks if a user is an admin
+// IsCommandAllowed checks if a command may be used in a chat. Chats without a
+// command list allow every command.
+func (s *Security) IsCommandAllowed(chatID int64, command string) bool {
+	commands, ok := s.Config().ChatCommands[chatID]
+	if !ok {
+		return true
+	}
+	for _, allowed := range commands {
+		if command == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin checks if a user is an admin, either the one from the
+// configuration or one promoted with /promote
 func (s *Security) IsAdmin(username string) bool {
-	return username == s.config.AdminUsername
+	if s.IsConfigAdmin(username) {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return username != "" && s.admins[strings.ToLower(username)]
+}
+
+// IsConfigAdmin checks if a user is the admin from the configuration, who
+// can't be demoted. Telegram usernames are case-insensitive.
+func (s *Security) IsConfigAdmin(username string) bool {
+	return username != "" && strings.EqualFold(username, s.Config().AdminUsername)
 }
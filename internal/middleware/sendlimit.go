@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SendLimiter paces every message a bot sends to stay under Telegram's
+// limits: a token bucket caps the messages per second across all chats, and
+// groups additionally get at most one message per interval. Like
+// ChatThrottle, callers over the rate queue up by waiting for their slot.
+type SendLimiter struct {
+	mu sync.Mutex
+	// tat is the theoretical arrival time of the next message when the
+	// bucket is drained; a full bucket lets burst messages through before it
+	tat      time.Time
+	interval time.Duration
+	burst    int
+	groups   *ChatThrottle
+}
+
+// NewSendLimiter creates a send limiter allowing perSecond messages a second
+// across all chats, in bursts of up to perSecond, and one message per
+// groupInterval in each group. Zero disables either limit.
+func NewSendLimiter(perSecond int, groupInterval time.Duration) *SendLimiter {
+	l := &SendLimiter{groups: NewChatThrottle(groupInterval)}
+	if perSecond > 0 {
+		l.interval = time.Second / time.Duration(perSecond)
+		l.burst = perSecond
+	}
+	return l
+}
+
+// Wait blocks until a message may be sent to the chat. Groups and
+// supergroups have negative chat IDs; private chats only count towards the
+// global limit. If the context is cancelled while waiting, the context's
+// error is returned and the message should be discarded.
+func (l *SendLimiter) Wait(ctx context.Context, chatID int64) error {
+	now := time.Now()
+	slot := now
+	if chatID < 0 && l.groups.interval > 0 {
+		slot = l.groups.reserve(chatID)
+	}
+	slot = l.reserve(slot)
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve books a slot in the global bucket no earlier than at and returns it
+func (l *SendLimiter) reserve(at time.Time) time.Time {
+	if l.interval <= 0 {
+		return at
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A message may go out once the backlog ahead of it fits in the bucket
+	slot := l.tat.Add(-time.Duration(l.burst-1) * l.interval)
+	if slot.Before(at) {
+		slot = at
+	}
+	if l.tat.Before(slot) {
+		l.tat = slot
+	}
+	l.tat = l.tat.Add(l.interval)
+	return slot
+}
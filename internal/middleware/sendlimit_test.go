@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSendLimiterBurstThenSpacing(t *testing.T) {
+	l := NewSendLimiter(10, 0)
+	now := time.Now()
+
+	// A full bucket lets a second's worth of messages through at once
+	for i := 0; i < 10; i++ {
+		if slot := l.reserve(now); !slot.Equal(now) {
+			t.Fatalf("message %d of the burst waits %v", i+1, slot.Sub(now))
+		}
+	}
+	// After that, messages are spaced a tenth of a second apart
+	for i := 1; i <= 3; i++ {
+		want := now.Add(time.Duration(i) * 100 * time.Millisecond)
+		if slot := l.reserve(now); !slot.Equal(want) {
+			t.Errorf("message %d after the burst waits %v, want %v", i, slot.Sub(now), want.Sub(now))
+		}
+	}
+
+	// The bucket refills while nothing is sent
+	later := now.Add(2 * time.Second)
+	if slot := l.reserve(later); !slot.Equal(later) {
+		t.Errorf("message after an idle period waits %v", slot.Sub(later))
+	}
+}
+
+func TestSendLimiterGroupInterval(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	l := NewSendLimiter(0, interval)
+	ctx := context.Background()
+
+	// waited returns how long Wait blocked for the chat
+	waited := func(chatID int64) time.Duration {
+		start := time.Now()
+		if err := l.Wait(ctx, chatID); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+
+	if d := waited(-100); d > interval/2 {
+		t.Errorf("first message to a group waited %v", d)
+	}
+	if d := waited(-100); d < interval*8/10 {
+		t.Errorf("second message to the group waited %v, want about %v", d, interval)
+	}
+	// Other groups have their own interval, and private chats have none
+	if d := waited(-200); d > interval/2 {
+		t.Errorf("first message to another group waited %v", d)
+	}
+	for i := 0; i < 3; i++ {
+		if d := waited(42); d > interval/2 {
+			t.Errorf("message %d to a private chat waited %v", i+1, d)
+		}
+	}
+}
+
+func TestSendLimiterCancelledWait(t *testing.T) {
+	l := NewSendLimiter(0, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.Wait(ctx, -100); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := l.Wait(ctx, -100); err != context.Canceled {
+		t.Errorf("err = %v waiting with a cancelled context, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ChatThrottle paces outbound ping messages per chat like a leaky bucket:
+// each chat gets at most one message per interval. Callers over the rate are
+// queued by waiting for their reserved slot instead of being dropped.
+type ChatThrottle struct {
+	mu       sync.Mutex
+	next     map[int64]time.Time
+	interval time.Duration
+}
+
+// NewChatThrottle creates a new chat throttle. A zero interval disables throttling.
+func NewChatThrottle(interval time.Duration) *ChatThrottle {
+	return &ChatThrottle{
+		next:     make(map[int64]time.Time),
+		interval: interval,
+	}
+}
+
+// Wait blocks until the chat may receive its next message. If the context is
+// cancelled while waiting, the reserved slot is given up and the context's
+// error is returned, so the caller should discard the message.
+func (t *ChatThrottle) Wait(ctx context.Context, chatID int64) error {
+	if t.interval <= 0 {
+		return nil
+	}
+
+	slot := t.reserve(chatID)
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve returns the next free send slot of a chat and books it
+func (t *ChatThrottle) reserve(chatID int64) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	slot := t.next[chatID]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[chatID] = slot.Add(t.interval)
+
+	// Forget idle chats so the map doesn't grow without bound
+	const maxTrackedChats = 1000
+	if len(t.next) > maxTrackedChats {
+		for id, next := range t.next {
+			if next.Before(now) {
+				delete(t.next, id)
+			}
+		}
+	}
+
+	return slot
+}
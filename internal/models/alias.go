@@ -0,0 +1,22 @@
+package models
+
+import "regexp"
+
+// aliasPattern is what Telegram accepts as a command name
+var aliasPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ValidateCommandAlias checks that alias can name command. Aliases can only
+// point to built-in commands, never to other aliases, so they can't form
+// cycles, and they can't shadow a built-in command.
+func ValidateCommandAlias(alias, command string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrInvalidInput{Field: "alias", Value: alias, Reason: "must be 1 to 32 lowercase letters, digits, or underscores"}
+	}
+	if IsCommand(alias) {
+		return ErrInvalidInput{Field: "alias", Value: alias, Reason: "is already a command"}
+	}
+	if !IsCommand(command) {
+		return ErrInvalidInput{Field: "command", Value: command, Reason: "is not a command"}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Audit log actions recorded for mutating operations
+const (
+	AuditCreateRole     = "create_role"
+	AuditRemoveRole     = "remove_role"
+	AuditAddToRole      = "add_to_role"
+	AuditRemoveFromRole = "remove_from_role"
+	AuditSchedulePing   = "schedule_ping"
+	AuditUnschedulePing = "unschedule_ping"
+	AuditSetCategory    = "set_category"
+	AuditArchiveRole    = "archive_role"
+	AuditRestoreRole    = "restore_role"
+	AuditTransferRole   = "transfer_role"
+	AuditNormalizeRole  = "normalize_role"
+	AuditPromoteAdmin   = "promote_admin"
+	AuditDemoteAdmin    = "demote_admin"
+)
+
+// Actor identifies who performed an operation and in which chat
+type Actor struct {
+	Username string
+	ChatID   int64
+}
+
+// AuditEntry represents a single recorded mutating operation
+type AuditEntry struct {
+	Timestamp  time.Time
+	Actor      string
+	Action     string
+	Role       string
+	TargetUser string
+	ChatID     int64
+}
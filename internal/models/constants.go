@@ -3,67 +3,264 @@ package models
 
 // Bot commands
 const (
-	CmdPing           = "ping"
-	CmdCreateRole     = "createrole"
-	CmdRemoveRole     = "removerole"
-	CmdAddToRole      = "addtorole"
-	CmdRemoveFromRole = "removefromrole"
-	CmdListRoles      = "listroles"
-	CmdListMembers    = "listmembers"
-	CmdHelp           = "help"
-	CmdStatus         = "status"
+	CmdPing            = "ping"
+	CmdCreateRole      = "createrole"
+	CmdRemoveRole      = "removerole"
+	CmdAddToRole       = "addtorole"
+	CmdRemoveFromRole  = "removefromrole"
+	CmdListRoles       = "listroles"
+	CmdListMembers     = "listmembers"
+	CmdHelp            = "help"
+	CmdStatus          = "status"
+	CmdVersion         = "version"
+	CmdMute            = "mute"
+	CmdUnmute          = "unmute"
+	CmdAuditLog        = "auditlog"
+	CmdUndo            = "undo"
+	CmdSetCategory     = "setcategory"
+	CmdSchedule        = "schedule"
+	CmdUnschedule      = "unschedule"
+	CmdSchedules       = "schedules"
+	CmdBotInfo         = "botinfo"
+	CmdWhoAmI          = "whoami"
+	CmdPingOncall      = "pingoncall"
+	CmdArchiveRole     = "archiverole"
+	CmdRestoreRole     = "restorerole"
+	CmdTransferRole    = "transferrole"
+	CmdAllMembers      = "allmembers"
+	CmdPrune           = "prune"
+	CmdFeedback        = "feedback"
+	CmdDND             = "dnd"
+	CmdRoles           = "roles"
+	CmdReloadConfig    = "reloadconfig"
+	CmdBackup          = "backup"
+	CmdSetPingTemplate = "setpingtemplate"
+	CmdNormalizeRoles  = "normalizeroles"
+	CmdPromote         = "promote"
+	CmdDemote          = "demote"
+	CmdListAdmins      = "listadmins"
+	CmdAddAlias        = "addalias"
+	CmdRemoveAlias     = "removealias"
+	CmdAliases         = "aliases"
+	CmdImportMembers   = "importmembers"
+	CmdUsage           = "usage"
+	CmdRole            = "role"
 )
 
-// Response messages
-const (
-	MsgPong                = "pong"
-	MsgUnauthorized        = "You are not authorized to use this command."
-	MsgProvideRoleName     = "Please provide a role name."
-	MsgUsageAddToRole      = "Usage: /addtorole <rolename> <username>"
-	MsgUsageRemoveFromRole = "Usage: /removefromrole <rolename> <username>"
-	MsgNoRoles             = "No roles found."
-	MsgBotHealthy          = "Bot is running and healthy!"
-	MsgUnknownCommand      = "Unknown command. Use /help to see available commands."
-)
-
-// Response prefixes
-const (
-	PrefixError   = "Error: %v"
-	PrefixSuccess = "%s"
-	PrefixInfo    = "%s"
-	PrefixPing    = "Pinging role '%s': "
-)
-
-// Help message
-const HelpMessage = `**Telegram Role Bot Commands**
-
-**General Commands:**
-/ping - Test if the bot is working
-/ping <rolename> - Ping all users in a role
-/listroles - List all roles
-/listmembers <rolename> - List members of a role
-/help - Show this help message
+// AuditLogLimit is the number of entries shown by /auditlog
+const AuditLogLimit = 20
 
-**Admin Commands:**
-/createrole <rolename> - Create a new role
-/removerole <rolename> - Remove a role
-/addtorole <rolename> <username> - Add a user to a role
-/removefromrole <rolename> <username> - Remove a user from a role
+// AllMembersPageSize is the number of users shown per /allmembers page
+const AllMembersPageSize = 50
 
-**Role Mentions:**
-@<rolename> - Ping all users in a role
+// UncategorizedCategory groups roles that have no category in /listroles; it is
+// shown using the MsgOtherCategory message
+const UncategorizedCategory = "Other"
 
-**Examples:**
-/ping developers
-/createrole developers
-/addtorole developers john_doe
-@developers
-
-**Note:** All role names and usernames are automatically converted to lowercase for consistency.`
+// Response message keys, looked up with Msg
+const (
+	MsgPong                = "pong"
+	MsgUnauthorized        = "unauthorized"
+	MsgProvideRoleName     = "provide_role_name"
+	MsgUsageAddToRole      = "usage_add_to_role"
+	MsgUsageRemoveFromRole = "usage_remove_from_role"
+	MsgReplyUserNoUsername = "reply_user_no_username"
+	MsgForwardHidden       = "forward_hidden"
+	MsgNoRoles             = "no_roles"
+	MsgRoles               = "roles"
+	MsgRolesHeader         = "roles_header"
+	MsgRoleCreated         = "role_created"
+	MsgRoleRemoved         = "role_removed"
+	MsgConfirmRemoveRole   = "confirm_remove_role"
+	MsgUserAdded           = "user_added"
+	MsgUserAddedUntil      = "user_added_until"
+	MsgMembershipExpired   = "membership_expired"
+	MsgInactiveWarning     = "inactive_warning"
+	MsgInactiveRemoved     = "inactive_removed"
+	MsgUserRemoved         = "user_removed"
+	MsgNoUsersInRole       = "no_users_in_role"
+	MsgUsersInRole         = "users_in_role"
+	MsgRoleMemberCount     = "role_member_count"
+	MsgUsageListMembers    = "usage_list_members"
+	MsgBotStatus           = "bot_status"
+	MsgVersion             = "version"
+	MsgUnknownCommand      = "unknown_command"
+	MsgCommandDisabled     = "command_disabled"
+	MsgInternalError       = "internal_error"
+	MsgUnavailable         = "unavailable"
+	MsgErrorCode           = "error_code"
+	MsgRoleNotFound        = "role_not_found"
+	MsgRoleAlreadyExists   = "role_already_exists"
+	MsgTooManyRoles        = "too_many_roles"
+	MsgRoleArchived        = "role_archived"
+	MsgRoleArchivedOK      = "role_archived_ok"
+	MsgRoleRestored        = "role_restored"
+	MsgUsageTransferRole   = "usage_transfer_role"
+	MsgRoleTransferred     = "role_transferred"
+	MsgUnknownUser         = "unknown_user"
+	MsgUserNotInRole       = "user_not_in_role"
+	MsgUserAlreadyInRole   = "user_already_in_role"
+	MsgInvalidInput        = "invalid_input"
+	MsgHelp                = "help"
+	MsgHelpDetail          = "help_detail"
+	MsgAccessEveryone      = "access_everyone"
+	MsgAccessAdmins        = "access_admins"
+	MsgAccessOwners        = "access_owners"
+	MsgNoHelpForCommand    = "no_help_for_command"
+	MsgNeedUsername        = "need_username"
+	MsgPingRole            = "ping_role"
+	MsgPingRoles           = "ping_roles"
+	MsgPingEveryone        = "ping_everyone"
+	MsgPingLimited         = "ping_limited"
+	MsgPingSummary         = "ping_summary"
+	MsgPingOncall          = "ping_oncall"
+	MsgUsagePingLimit      = "usage_ping_limit"
+	MsgEveryoneCooldown    = "everyone_cooldown"
+	MsgRoleMuted           = "role_muted"
+	MsgRoleUnmuted         = "role_unmuted"
+	MsgMutedMembers        = "muted_members"
+	MsgUsageSetCategory    = "usage_set_category"
+	MsgCategorySet         = "category_set"
+	MsgCategoryCleared     = "category_cleared"
+	MsgOtherCategory       = "other_category"
+	MsgNothingToUndo       = "nothing_to_undo"
+	MsgUndone              = "undone"
+	MsgUndoCreateRole      = "undo_create_role"
+	MsgUndoRemoveRole      = "undo_remove_role"
+	MsgUndoAddToRole       = "undo_add_to_role"
+	MsgUndoRemoveFromRole  = "undo_remove_from_role"
+	MsgNoAuditEntries      = "no_audit_entries"
+	MsgAuditHeader         = "audit_header"
+	MsgUsageSchedule       = "usage_schedule"
+	MsgUsageUnschedule     = "usage_unschedule"
+	MsgScheduleCreated     = "schedule_created"
+	MsgScheduleRemoved     = "schedule_removed"
+	MsgScheduleNotFound    = "schedule_not_found"
+	MsgNoSchedules         = "no_schedules"
+	MsgSchedulesHeader     = "schedules_header"
+	MsgScheduleEntry       = "schedule_entry"
+	MsgLeavingUnauthorized = "leaving_unauthorized"
+	MsgDepartedPruned      = "departed_pruned"
+	MsgDepartedNotice      = "departed_notice"
+	MsgBotInfo             = "bot_info"
+	MsgAllChats            = "all_chats"
+	MsgWhoAmI              = "whoami"
+	MsgNoUsername          = "no_username"
+	MsgYes                 = "yes"
+	MsgNo                  = "no"
+	MsgUsageAllMembers     = "usage_all_members"
+	MsgNoKnownUsers        = "no_known_users"
+	MsgAllMembersHeader    = "all_members_header"
+	MsgWithoutRoles        = "without_roles"
+	MsgUsersPruned         = "users_pruned"
+	MsgConfigReloaded      = "config_reloaded"
+	MsgConfigUnchanged     = "config_unchanged"
+	MsgReloadNeedsRestart  = "reload_needs_restart"
+	MsgReloadFailed        = "reload_failed"
+	MsgBackupSent          = "backup_sent"
+	MsgBackupNotSent       = "backup_not_sent"
+	MsgBackupFailed        = "backup_failed"
+	MsgUnbalancedQuotes    = "unbalanced_quotes"
+	MsgPingTemplateSet     = "ping_template_set"
+	MsgPingTemplateReset   = "ping_template_reset"
+	MsgPingTemplateDefault = "ping_template_default"
+	MsgPingTemplateCurrent = "ping_template_current"
+	MsgRolesNormalized     = "roles_normalized"
+	MsgRolesAlreadyLower   = "roles_already_lower"
+	MsgPinAdminOnly        = "pin_admin_only"
+	MsgPinFailed           = "pin_failed"
+	MsgUsagePromote        = "usage_promote"
+	MsgUsageDemote         = "usage_demote"
+	MsgAdminPromoted       = "admin_promoted"
+	MsgAlreadyAdmin        = "already_admin"
+	MsgAdminDemoted        = "admin_demoted"
+	MsgNotPromotedAdmin    = "not_promoted_admin"
+	MsgConfigAdminDemote   = "config_admin_demote"
+	MsgAdmins              = "admins"
+	MsgUsageAddAlias       = "usage_add_alias"
+	MsgUsageRemoveAlias    = "usage_remove_alias"
+	MsgAliasAdded          = "alias_added"
+	MsgAliasRemoved        = "alias_removed"
+	MsgAliasNotFound       = "alias_not_found"
+	MsgAliases             = "aliases"
+	MsgNoAliases           = "no_aliases"
+	MsgUsageImportMembers  = "usage_import_members"
+	MsgImportGroupOnly     = "import_group_only"
+	MsgImportFailed        = "import_failed"
+	MsgMembersImported     = "members_imported"
+	MsgUsageUsage          = "usage_usage"
+	MsgUsageHeader         = "usage_header"
+	MsgUsageOthers         = "usage_others"
+	MsgNoUsage             = "no_usage"
+	MsgReplyUserIsBot      = "reply_user_is_bot"
+	MsgUsageRole           = "usage_role"
+	MsgUsage               = "usage"
+	MsgUsageFeedback       = "usage_feedback"
+	MsgFeedbackDisabled    = "feedback_disabled"
+	MsgFeedbackCooldown    = "feedback_cooldown"
+	MsgFeedbackSent        = "feedback_sent"
+	MsgFeedbackForward     = "feedback_forward"
+	MsgUsageDND            = "usage_dnd"
+	MsgDNDSet              = "dnd_set"
+	MsgDNDOff              = "dnd_off"
+	MsgUnknownTimezone     = "unknown_timezone"
+	MsgPingQuiet           = "ping_quiet"
+	MsgRateLimited         = "rate_limited"
+	MsgRolesKeyboard       = "roles_keyboard"
+	MsgPreviousPage        = "previous_page"
+	MsgNextPage            = "next_page"
+	MsgMembersPage         = "members_page"
+)
 
 // Admin commands that require special privileges
 var AdminCommands = map[string]bool{
-	CmdCreateRole:     true,
+	CmdCreateRole:      true,
+	CmdRemoveRole:      true,
+	CmdAddToRole:       true,
+	CmdRemoveFromRole:  true,
+	CmdAuditLog:        true,
+	CmdUndo:            true,
+	CmdSetCategory:     true,
+	CmdSchedule:        true,
+	CmdUnschedule:      true,
+	CmdSchedules:       true,
+	CmdBotInfo:         true,
+	CmdArchiveRole:     true,
+	CmdRestoreRole:     true,
+	CmdTransferRole:    true,
+	CmdAllMembers:      true,
+	CmdPrune:           true,
+	CmdReloadConfig:    true,
+	CmdBackup:          true,
+	CmdSetPingTemplate: true,
+	CmdNormalizeRoles:  true,
+	CmdPromote:         true,
+	CmdDemote:          true,
+	CmdListAdmins:      true,
+	CmdAddAlias:        true,
+	CmdRemoveAlias:     true,
+	CmdImportMembers:   true,
+	CmdUsage:           true,
+}
+
+// RoleSubcommands maps the subcommands of /role to the commands they run,
+// e.g. /role add devs alice runs /addtorole devs alice
+var RoleSubcommands = map[string]string{
+	"create":   CmdCreateRole,
+	"delete":   CmdRemoveRole,
+	"add":      CmdAddToRole,
+	"remove":   CmdRemoveFromRole,
+	"list":     CmdListRoles,
+	"members":  CmdListMembers,
+	"archive":  CmdArchiveRole,
+	"restore":  CmdRestoreRole,
+	"transfer": CmdTransferRole,
+	"category": CmdSetCategory,
+}
+
+// OwnerCommands are admin commands that a role's owner may also use on that
+// role, which is always the first argument
+var OwnerCommands = map[string]bool{
 	CmdRemoveRole:     true,
 	CmdAddToRole:      true,
 	CmdRemoveFromRole: true,
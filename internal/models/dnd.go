@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DND is a daily do-not-disturb window during which a user isn't mentioned
+// by role pings. Start and End are minutes after midnight; a window whose end
+// is before its start runs past midnight.
+type DND struct {
+	Start int
+	End   int
+	// Timezone is the IANA zone of the window; empty uses the bot's TIMEZONE
+	Timezone string
+}
+
+// ParseDNDWindow parses a window such as "22:00-08:00"
+func ParseDNDWindow(window string) (DND, error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return DND{}, fmt.Errorf("window %q must look like 22:00-08:00", window)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return DND{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return DND{}, err
+	}
+	if start == end {
+		return DND{}, fmt.Errorf("window %q starts and ends at the same time", window)
+	}
+
+	return DND{Start: start, End: end}, nil
+}
+
+// parseClock parses a time of day such as "08:30" into minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Window formats the window as "22:00-08:00"
+func (d DND) Window() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", d.Start/60, d.Start%60, d.End/60, d.End%60)
+}
+
+// Active reports whether t falls within the window. fallback is the zone used
+// when the window has no valid zone of its own.
+func (d DND) Active(t time.Time, fallback *time.Location) bool {
+	loc := fallback
+	if d.Timezone != "" {
+		if zone, err := time.LoadLocation(d.Timezone); err == nil {
+			loc = zone
+		}
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if d.Start < d.End {
+		return minute >= d.Start && minute < d.End
+	}
+	return minute >= d.Start || minute < d.End
+}
@@ -1,7 +1,37 @@
 // Package models defines data models and custom errors.
 package models
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error codes shown to users next to error messages. They stay the same
+// across releases and locales, so they can be searched for and reported.
+const (
+	CodeRoleNotFound      = "E_ROLE_NOT_FOUND"
+	CodeRoleAlreadyExists = "E_ROLE_EXISTS"
+	CodeUserNotInRole     = "E_USER_NOT_IN_ROLE"
+	CodeUnknownUser       = "E_UNKNOWN_USER"
+	CodeUnauthorized      = "E_UNAUTHORIZED"
+	CodeRateLimited       = "E_RATE_LIMITED"
+	CodeChatNotAllowed    = "E_CHAT_NOT_ALLOWED"
+	CodeInvalidInput      = "E_INVALID_INPUT"
+	CodeTooManyRoles      = "E_TOO_MANY_ROLES"
+	CodeScheduleNotFound  = "E_SCHEDULE_NOT_FOUND"
+	CodeUnavailable       = "E_UNAVAILABLE"
+	CodeInternal          = "E_INTERNAL"
+)
+
+// ErrorCode returns the code of a typed error, or CodeInternal for any other error
+func ErrorCode(err error) string {
+	var coded interface{ Code() string }
+	if errors.As(err, &coded) {
+		return coded.Code()
+	}
+	return CodeInternal
+}
 
 // Custom error types for better error handling
 
@@ -13,6 +43,10 @@ func (e ErrRoleNotFound) Error() string {
 	return fmt.Sprintf("role '%s' not found", e.Role)
 }
 
+func (e ErrRoleNotFound) Code() string {
+	return CodeRoleNotFound
+}
+
 type ErrRoleAlreadyExists struct {
 	Role string
 }
@@ -21,6 +55,10 @@ func (e ErrRoleAlreadyExists) Error() string {
 	return fmt.Sprintf("role '%s' already exists", e.Role)
 }
 
+func (e ErrRoleAlreadyExists) Code() string {
+	return CodeRoleAlreadyExists
+}
+
 type ErrUserNotFound struct {
 	User string
 	Role string
@@ -30,6 +68,22 @@ func (e ErrUserNotFound) Error() string {
 	return fmt.Sprintf("user '%s' not found in role '%s'", e.User, e.Role)
 }
 
+func (e ErrUserNotFound) Code() string {
+	return CodeUserNotInRole
+}
+
+type ErrUnknownUser struct {
+	User string
+}
+
+func (e ErrUnknownUser) Error() string {
+	return fmt.Sprintf("user '%s' is not known", e.User)
+}
+
+func (e ErrUnknownUser) Code() string {
+	return CodeUnknownUser
+}
+
 type ErrUnauthorized struct {
 	Operation string
 	User      string
@@ -39,14 +93,36 @@ func (e ErrUnauthorized) Error() string {
 	return fmt.Sprintf("user '%s' is not authorized to perform operation '%s'", e.User, e.Operation)
 }
 
+func (e ErrUnauthorized) Code() string {
+	return CodeUnauthorized
+}
+
 type ErrRateLimited struct {
 	UserID int64
+	// RetryAfter is how long until the user may send another request
+	RetryAfter time.Duration
 }
 
 func (e ErrRateLimited) Error() string {
 	return fmt.Sprintf("rate limit exceeded for user %d", e.UserID)
 }
 
+func (e ErrRateLimited) Code() string {
+	return CodeRateLimited
+}
+
+type ErrChatNotAllowed struct {
+	ChatID int64
+}
+
+func (e ErrChatNotAllowed) Error() string {
+	return fmt.Sprintf("chat %d is not allowed", e.ChatID)
+}
+
+func (e ErrChatNotAllowed) Code() string {
+	return CodeChatNotAllowed
+}
+
 type ErrInvalidInput struct {
 	Field  string
 	Value  string
@@ -59,3 +135,65 @@ func (e ErrInvalidInput) Error() string {
 	}
 	return fmt.Sprintf("invalid %s '%s'", e.Field, e.Value)
 }
+
+func (e ErrInvalidInput) Code() string {
+	return CodeInvalidInput
+}
+
+type ErrTooManyRoles struct {
+	Limit int
+}
+
+func (e ErrTooManyRoles) Error() string {
+	return fmt.Sprintf("role limit of %d reached", e.Limit)
+}
+
+func (e ErrTooManyRoles) Code() string {
+	return CodeTooManyRoles
+}
+
+type ErrScheduleNotFound struct {
+	ID int64
+}
+
+func (e ErrScheduleNotFound) Error() string {
+	return fmt.Sprintf("scheduled ping %d not found", e.ID)
+}
+
+func (e ErrScheduleNotFound) Code() string {
+	return CodeScheduleNotFound
+}
+
+// ErrUnavailable means the database is failing and requests are turned away
+// until it recovers
+type ErrUnavailable struct{}
+
+func (e ErrUnavailable) Error() string {
+	return "database temporarily unavailable"
+}
+
+func (e ErrUnavailable) Code() string {
+	return CodeUnavailable
+}
+
+// Kinds of startup failures, which decide the exit code of the process
+const (
+	StartupConfig   = "config"
+	StartupDatabase = "database"
+	StartupNetwork  = "network"
+)
+
+// ErrStartup is a failure to start the bot, classified by its Kind so
+// supervisors can tell whether restarting may help
+type ErrStartup struct {
+	Kind string
+	Err  error
+}
+
+func (e ErrStartup) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrStartup) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,281 @@
+package models
+
+// CommandHelp holds detailed help for a single command
+type CommandHelp struct {
+	Usage   string
+	Example string
+	// MinArgs and MaxArgs bound the number of arguments, counted like
+	// utils.SplitArgs does; commands outside them get Usage as a reply
+	MinArgs int
+	MaxArgs int
+}
+
+// AnyArgs as MaxArgs allows any number of arguments, e.g. a message
+const AnyArgs = -1
+
+// HelpDescription returns the message key of a command's description
+func HelpDescription(command string) string {
+	return "help_" + command
+}
+
+// IsCommand reports whether name is one of the bot's built-in commands
+func IsCommand(name string) bool {
+	_, ok := CommandHelps[name]
+	return ok
+}
+
+// CommandHelps maps command names to their detailed help, shown by /help <command>
+var CommandHelps = map[string]CommandHelp{
+	CmdPing: {
+		Usage:   "/ping [rolename] [--limit N] [--names] [--pin] [message]",
+		Example: "/ping oncall --limit 2 database is down",
+		MinArgs: 0,
+		MaxArgs: AnyArgs,
+	},
+	CmdPingOncall: {
+		Usage:   "/pingoncall <rolename> [message]",
+		Example: "/pingoncall oncall database is down",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdListRoles: {
+		Usage:   "/listroles [prefix]",
+		Example: "/listroles team-",
+		MinArgs: 0,
+		MaxArgs: AnyArgs,
+	},
+	CmdListMembers: {
+		Usage:   "/listmembers <rolename> [--format plain|mentions|count]",
+		Example: "/listmembers developers --format count",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdMute: {
+		Usage:   "/mute <rolename>",
+		Example: "/mute developers",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdUnmute: {
+		Usage:   "/unmute <rolename>",
+		Example: "/unmute developers",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdHelp: {
+		Usage:   "/help [command]",
+		Example: "/help addtorole",
+		MinArgs: 0,
+		MaxArgs: 1,
+	},
+	CmdStatus: {
+		Usage:   "/status",
+		Example: "/status",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdVersion: {
+		Usage:   "/version",
+		Example: "/version",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdCreateRole: {
+		Usage:   "/createrole <rolename>",
+		Example: "/createrole developers",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdRemoveRole: {
+		Usage:   "/removerole <rolename> [confirm]",
+		Example: "/removerole developers confirm",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdAddToRole: {
+		Usage:   "/addtorole <rolename> <username> [--expires 7d]",
+		Example: "/addtorole developers john_doe",
+		MinArgs: 1,
+		MaxArgs: 4,
+	},
+	CmdRemoveFromRole: {
+		Usage:   "/removefromrole <rolename> <username>",
+		Example: "/removefromrole developers john_doe",
+		MinArgs: 1,
+		MaxArgs: 2,
+	},
+	CmdArchiveRole: {
+		Usage:   "/archiverole <rolename>",
+		Example: "/archiverole hackathon",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdRestoreRole: {
+		Usage:   "/restorerole <rolename>",
+		Example: "/restorerole hackathon",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdTransferRole: {
+		Usage:   "/transferrole <rolename> <username>",
+		Example: "/transferrole backend jane_doe",
+		MinArgs: 1,
+		MaxArgs: 2,
+	},
+	CmdSetCategory: {
+		Usage:   "/setcategory <rolename> [category]",
+		Example: "/setcategory backend engineering",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdUndo: {
+		Usage:   "/undo",
+		Example: "/undo",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdAuditLog: {
+		Usage:   "/auditlog <rolename>",
+		Example: "/auditlog developers",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdSchedule: {
+		Usage:   "/schedule <rolename> <cron spec> [message]",
+		Example: "/schedule team 0 9 * * 1-5 Standup time!",
+		MinArgs: 2,
+		MaxArgs: AnyArgs,
+	},
+	CmdUnschedule: {
+		Usage:   "/unschedule <id>",
+		Example: "/unschedule 3",
+		MinArgs: 1,
+		MaxArgs: 1,
+	},
+	CmdSchedules: {
+		Usage:   "/schedules",
+		Example: "/schedules",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdWhoAmI: {
+		Usage:   "/whoami",
+		Example: "/whoami",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdFeedback: {
+		Usage:   "/feedback <text>",
+		Example: "/feedback It would help to ping roles from other chats",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdDND: {
+		Usage:   "/dnd [HH:MM-HH:MM [time zone] | off]",
+		Example: "/dnd 22:00-08:00 Europe/Madrid",
+		MinArgs: 0,
+		MaxArgs: 2,
+	},
+	CmdRoles: {
+		Usage:   "/roles",
+		Example: "/roles",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdBotInfo: {
+		Usage:   "/botinfo",
+		Example: "/botinfo",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdPrune: {
+		Usage:   "/prune",
+		Example: "/prune",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdAllMembers: {
+		Usage:   "/allmembers [page]",
+		Example: "/allmembers 2",
+		MinArgs: 0,
+		MaxArgs: 1,
+	},
+	CmdReloadConfig: {
+		Usage:   "/reloadconfig",
+		Example: "/reloadconfig",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdSetPingTemplate: {
+		Usage:   "/setpingtemplate [template | reset]",
+		Example: "/setpingtemplate 🔔 {role} needed: {mentions} {message}",
+		MinArgs: 0,
+		MaxArgs: AnyArgs,
+	},
+	CmdNormalizeRoles: {
+		Usage:   "/normalizeroles",
+		Example: "/normalizeroles",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdBackup: {
+		Usage:   "/backup",
+		Example: "/backup",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdPromote: {
+		Usage:   "/promote <username>",
+		Example: "/promote jane_doe",
+		MinArgs: 1,
+		MaxArgs: 1,
+	},
+	CmdDemote: {
+		Usage:   "/demote <username>",
+		Example: "/demote jane_doe",
+		MinArgs: 1,
+		MaxArgs: 1,
+	},
+	CmdListAdmins: {
+		Usage:   "/listadmins",
+		Example: "/listadmins",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+	CmdAddAlias: {
+		Usage:   "/addalias <alias> <command>",
+		Example: "/addalias page ping",
+		MinArgs: 2,
+		MaxArgs: 2,
+	},
+	CmdRemoveAlias: {
+		Usage:   "/removealias <alias>",
+		Example: "/removealias page",
+		MinArgs: 1,
+		MaxArgs: 1,
+	},
+	CmdImportMembers: {
+		Usage:   "/importmembers <rolename>",
+		Example: "/importmembers staff",
+		MinArgs: 1,
+		MaxArgs: AnyArgs,
+	},
+	CmdUsage: {
+		Usage:   "/usage [days]",
+		Example: "/usage 30",
+		MinArgs: 0,
+		MaxArgs: 1,
+	},
+	CmdRole: {
+		Usage:   "/role <subcommand> [arguments]",
+		Example: "/role add developers john_doe",
+		MinArgs: 0,
+		MaxArgs: AnyArgs,
+	},
+	CmdAliases: {
+		Usage:   "/aliases",
+		Example: "/aliases",
+		MinArgs: 0,
+		MaxArgs: 0,
+	},
+}
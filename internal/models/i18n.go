@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+
+	"didactic-spork/pkg/utils"
+)
+
+// DefaultLocale is used when no locale is configured and for keys that are
+// missing from the configured locale
+const DefaultLocale = "en"
+
+// catalogs maps a locale to its messages, keyed by the Msg* constants
+var catalogs = map[string]map[string]string{
+	"en": messagesEN,
+	"es": messagesES,
+}
+
+// Markdown is text already formatted as MarkdownV2, which Msg inserts as is
+type Markdown string
+
+// markdownMessages are catalog entries written in MarkdownV2 instead of plain text
+var markdownMessages = map[string]bool{
+	MsgHelp: true,
+}
+
+// escaped formats a value as fmt would and escapes the result for MarkdownV2,
+// so numbers like negative chat IDs are escaped too
+type escaped struct {
+	value interface{}
+}
+
+func (e escaped) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, utils.EscapeMarkdownV2(fmt.Sprintf(fmt.FormatString(f, verb), e.value)))
+}
+
+// Msg returns the message for key in the given locale, formatted with args, as
+// MarkdownV2 text. Arguments are escaped; pass Markdown for arguments that are
+// already formatted. Unknown locales and keys missing from
+// a locale fall back to English.
+func Msg(key, locale string, args ...interface{}) string {
+	text, ok := catalogs[locale][key]
+	if !ok {
+		text, ok = catalogs[DefaultLocale][key]
+	}
+	if !ok {
+		text = key
+	}
+	if !markdownMessages[key] {
+		text = utils.EscapeMarkdownV2(text)
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	formatted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if markdown, ok := arg.(Markdown); ok {
+			formatted[i] = string(markdown)
+		} else {
+			formatted[i] = escaped{arg}
+		}
+	}
+	return fmt.Sprintf(text, formatted...)
+}
+
+// IsSupportedLocale reports whether messages are available in a locale
+func IsSupportedLocale(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
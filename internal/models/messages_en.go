@@ -0,0 +1,208 @@
+package models
+
+// messagesEN is the English message catalog and the fallback for all locales
+var messagesEN = map[string]string{
+	MsgPong:                "pong",
+	MsgUnauthorized:        "You are not authorized to use this command. Ask an admin: %s",
+	MsgProvideRoleName:     "Please provide a role name.",
+	MsgUsageAddToRole:      "Usage: /addtorole <rolename> <username>, or reply to a user's message with /addtorole <rolename>. Add --expires 7d (or 12h, 30m) to add them temporarily.",
+	MsgUsageRemoveFromRole: "Usage: /removefromrole <rolename> <username>, or reply to a user's message with /removefromrole <rolename>",
+	MsgReplyUserNoUsername: "That user has no Telegram username, so they can't be added to a role.",
+	MsgForwardHidden:       "The author of the forwarded message hides their account in forwards, so the bot can't tell who they are. Give their username instead.",
+	MsgNoRoles:             "No roles found.",
+	MsgRoles:               "Roles: %s",
+	MsgRolesHeader:         "Roles:",
+	MsgRoleCreated:         "Role '%s' created successfully",
+	MsgRoleRemoved:         "Role '%s' removed successfully",
+	MsgConfirmRemoveRole:   "This will remove %d member(s) from '%s'. Send /removerole %s confirm to proceed.",
+	MsgUserAdded:           "User %s added to role '%s'",
+	MsgUserAddedUntil:      "User %s added to role '%s' until %s",
+	MsgMembershipExpired:   "%s's membership in role '%s' expired.",
+	MsgInactiveWarning:     "No messages in %d days from %s. Post something to stay active; an admin can remove inactive members with /removefromrole.",
+	MsgInactiveRemoved:     "Removed from their roles after %d days without messages: %s",
+	MsgUserRemoved:         "User %s removed from role '%s'",
+	MsgNoUsersInRole:       "No users found in role '%s'",
+	MsgUsersInRole:         "Users in role '%s': %s",
+	MsgRoleMemberCount:     "Role '%s' has %d member(s).",
+	MsgUsageListMembers:    "Usage: /listmembers <rolename> [--format plain|mentions|count]",
+	MsgBotStatus:           "✅ Bot is running and healthy!\n⏱ Uptime: %s\n🏷 Roles: %d\n👥 Users: %d\n📨 Updates handled: %d\nℹ️ Version: %s",
+	MsgVersion:             "Version: %s",
+	MsgUnknownCommand:      "Unknown command. Use /help to see available commands.",
+	MsgCommandDisabled:     "This command is disabled in this chat.",
+	MsgInternalError:       "Something went wrong. Please try again later.",
+	MsgUnavailable:         "The bot is temporarily unavailable, please retry shortly.",
+	MsgErrorCode:           "%s (%s)",
+	MsgRoleNotFound:        "Role '%s' does not exist. Use /listroles to see available roles.",
+	MsgRoleAlreadyExists:   "Role '%s' already exists.",
+	MsgTooManyRoles:        "The bot already has the maximum of %d roles, shared by all chats. Remove a role before creating a new one.",
+	MsgRoleArchived:        "Role '%s' is archived. Use /restorerole to bring it back.",
+	MsgRoleArchivedOK:      "Role '%s' archived. Its members are kept; use /restorerole to bring it back.",
+	MsgRoleRestored:        "Role '%s' restored.",
+	MsgUsageTransferRole:   "Usage: /transferrole <rolename> <username>, or reply to a user's message with /transferrole <rolename>",
+	MsgRoleTransferred:     "Role '%s' is now owned by %s.",
+	MsgUnknownUser:         "User %s is not known to the bot yet. Add them to a role first, or reply to one of their messages.",
+	MsgUserNotInRole:       "User %s is not a member of role '%s'.",
+	MsgUserAlreadyInRole:   "User %s is already in role '%s'.",
+	MsgInvalidInput:        "Invalid %s: %s",
+	MsgHelpDetail:          "%s\n%s\nExample: %s\nAccess: %s",
+	MsgAccessEveryone:      "everyone",
+	MsgAccessAdmins:        "admins only",
+	MsgAccessOwners:        "admins and the role's owner",
+	MsgNoHelpForCommand:    "No help available for '%s'. Use /help to see all commands.",
+	MsgNeedUsername:        "You need a Telegram username to use this command.",
+	MsgPingRole:            "Pinging role '%s': ",
+	MsgPingRoles:           "Pinging roles %s: ",
+	MsgPingOncall:          "On call for role '%s': @%s",
+	MsgPingLimited:         "Pinged %d of %d members.",
+	MsgPingSummary:         "+%d more. See everyone with /listmembers %s",
+	MsgUsagePingLimit:      "Usage: /ping <rolename> --limit <count> [message], where count is at least 1",
+	MsgPingEveryone:        "Pinging everyone: ",
+	MsgEveryoneCooldown:    "@%s can only be used once every %d minutes in a chat.",
+	MsgRoleMuted:           "You will no longer be mentioned when '%s' is pinged. Use /unmute to undo.",
+	MsgRoleUnmuted:         "You will be mentioned again when '%s' is pinged.",
+	MsgMutedMembers:        "Muted: %s",
+	MsgUsageSetCategory:    "Usage: /setcategory <rolename> [category]. Leave out the category to clear it.",
+	MsgCategorySet:         "Role '%s' is now in category '%s'.",
+	MsgCategoryCleared:     "Role '%s' no longer has a category.",
+	MsgOtherCategory:       "Other",
+	MsgNothingToUndo:       "Nothing to undo. Only the last 5 changes of the past 15 minutes can be undone.",
+	MsgUndone:              "Undid %s.",
+	MsgUndoCreateRole:      "creation of role '%s'",
+	MsgUndoRemoveRole:      "removal of role '%s' (%d members restored)",
+	MsgUndoAddToRole:       "adding %s to role '%s'",
+	MsgUndoRemoveFromRole:  "removing %s from role '%s'",
+	MsgNoAuditEntries:      "No audit entries found for role '%s'",
+	MsgAuditHeader:         "Recent changes to role '%s':",
+	MsgUsageSchedule:       "Usage: /schedule <rolename> <cron spec> [message], e.g. /schedule team 0 9 * * 1-5 Standup time!",
+	MsgUsageUnschedule:     "Usage: /unschedule <id>. Use /schedules to see scheduled pings.",
+	MsgScheduleCreated:     "Scheduled ping #%d for role '%s' at '%s'.",
+	MsgScheduleRemoved:     "Scheduled ping #%d removed.",
+	MsgScheduleNotFound:    "Scheduled ping #%d not found in this chat.",
+	MsgNoSchedules:         "No scheduled pings in this chat.",
+	MsgScheduleEntry:       "#%d '%s' at %s",
+	MsgSchedulesHeader:     "Scheduled pings:",
+	MsgLeavingUnauthorized: "This bot is not enabled for this chat and will leave now.",
+	MsgDepartedPruned:      "@%s left the chat and was removed from %d role(s).",
+	MsgBotInfo:             "Uptime: %s\nVersion: %s\nGoroutines: %d\nMemory: %d MiB in use, %d MiB from the system\nDatabase connections: %d open, %d in use\nWorkers: %d\nRate limit: %d per minute\nAllowed chats: %s",
+	MsgAllChats:            "all",
+	MsgWhoAmI:              "Username: %s\nUser ID: %d\nChat ID: %d\nAdmin: %s",
+	MsgNoUsername:          "(none, so you can't be added to roles)",
+	MsgYes:                 "yes",
+	MsgNo:                  "no",
+	MsgUsageAllMembers:     "Usage: /allmembers [page], where page is between 1 and %d",
+	MsgNoKnownUsers:        "No users known yet.",
+	MsgAllMembersHeader:    "Known users (%d, page %d of %d):",
+	MsgWithoutRoles:        "%s (no roles)",
+	MsgUsageFeedback:       "Usage: /feedback <text>",
+	MsgFeedbackDisabled:    "Feedback is not enabled for this bot.",
+	MsgFeedbackCooldown:    "You can send feedback once every %d minutes.",
+	MsgFeedbackSent:        "Thanks, your feedback was sent to the bot operators.",
+	MsgFeedbackForward:     "Feedback from %s (ID %d) in chat %s:\n%s",
+	MsgUsageDND:            "Usage: /dnd <HH:MM-HH:MM> [time zone] to set quiet hours, /dnd off to clear them, or /dnd to show them.",
+	MsgDNDSet:              "Do not disturb: %s (%s). You won't be mentioned by role pings during these hours.",
+	MsgDNDOff:              "Do not disturb is off.",
+	MsgUnknownTimezone:     "Unknown time zone '%s'. Use an IANA name such as Europe/Madrid.",
+	MsgPingQuiet:           "%d member(s) skipped (do not disturb).",
+	MsgRateLimited:         "You're doing that too fast. Try again in %ds.",
+	MsgRolesKeyboard:       "Tap a role to ping it:",
+	MsgPreviousPage:        "« Previous",
+	MsgNextPage:            "Next »",
+	MsgMembersPage:         "Page %d of %d",
+	MsgUsersPruned:         "Removed %d user(s) who were not in any role.",
+	MsgDepartedNotice:      "@%s: @%s left the chat but is still a member of: %s. Use /removefromrole to clean up.",
+	MsgConfigReloaded:      "Configuration reloaded. Changed: %s",
+	MsgConfigUnchanged:     "Configuration reloaded. Nothing changed.",
+	MsgReloadNeedsRestart:  "Not applied until restart: %s",
+	MsgReloadFailed:        "The configuration was not reloaded, the current settings are kept:\n%s",
+	MsgBackupSent:          "Database backup sent to your private chat with the bot.",
+	MsgBackupNotSent:       "Couldn't send the backup. Start a private chat with the bot and try again.",
+	MsgBackupFailed:        "The database backup failed. Check the logs for details.",
+	MsgUnbalancedQuotes:    "A quote is never closed. Put names with spaces in double quotes, e.g. \"qa team\".",
+	MsgPingTemplateSet:     "Pings in this chat now use:\n%s",
+	MsgPingTemplateReset:   "Pings in this chat use the default wording again.",
+	MsgPingTemplateDefault: "Pings in this chat use the default wording. Set a template with /setpingtemplate <template>, using {role}, {mentions}, {message}, and {count}; {mentions} is required.",
+	MsgPingTemplateCurrent: "Pings in this chat use:\n%s\nUse /setpingtemplate reset to go back to the default wording.",
+	MsgRolesNormalized:     "Role names normalized to lowercase: %d renamed, %d merged into an existing role.",
+	MsgRolesAlreadyLower:   "All role names are already lowercase.",
+	MsgPinAdminOnly:        "Only admins can pin pings with --pin.",
+	MsgPinFailed:           "Couldn't pin the ping. The bot needs permission to pin messages in this chat.",
+	MsgUsagePromote:        "Usage: /promote <username>",
+	MsgUsageDemote:         "Usage: /demote <username>",
+	MsgAdminPromoted:       "@%s is now an admin.",
+	MsgAlreadyAdmin:        "@%s is already an admin.",
+	MsgAdminDemoted:        "@%s is no longer an admin.",
+	MsgNotPromotedAdmin:    "@%s wasn't made an admin with /promote.",
+	MsgConfigAdminDemote:   "@%s is set as ADMIN_USERNAME and can't be demoted.",
+	MsgAdmins:              "Admins: %s",
+	MsgUsageAddAlias:       "Usage: /addalias <alias> <command>, e.g. /addalias page ping",
+	MsgUsageRemoveAlias:    "Usage: /removealias <alias>",
+	MsgAliasAdded:          "/%s now runs /%s.",
+	MsgAliasRemoved:        "Removed the alias /%s.",
+	MsgAliasNotFound:       "There is no alias /%s.",
+	MsgAliases:             "Command aliases:\n%s",
+	MsgNoAliases:           "No command aliases are set. Admins can add one with /addalias.",
+	MsgUsageImportMembers:  "Usage: /importmembers <rolename>",
+	MsgImportGroupOnly:     "/importmembers only works in groups.",
+	MsgImportFailed:        "Couldn't get the group's members. Try again later.",
+	MsgMembersImported:     "Added %d members to role '%s'. Telegram only lets bots see a group's administrators; %d without a username were skipped.",
+	MsgUsageUsage:          "Usage: /usage [days], with days from 1 to %d",
+	MsgUsageHeader:         "Command usage over the last %d days, with the change from the days before:",
+	MsgUsageOthers:         "%d more commands: %d",
+	MsgNoUsage:             "No commands were used in the last %d days.",
+	MsgReplyUserIsBot:      "That message is from a bot, which can't be added to roles.",
+	MsgUsageRole:           "Usage: /role <subcommand> [arguments], with subcommand one of: %s",
+	MsgUsage:               "Usage: %s",
+
+	MsgHelp: `*Telegram Role Bot Commands*
+
+*General:* /ping \[rolename\] \[\-\-limit N\] \[\-\-names\] \[\-\-pin\] \[message\], /pingoncall <rolename\>, /listroles \[prefix\], /roles, /role <subcommand\> \[arguments\], /listmembers <rolename\> \[\-\-format F\], /mute <rolename\>, /unmute <rolename\>, /dnd \[HH:MM\-HH:MM\|off\], /status, /version, /whoami, /aliases, /feedback <text\>, /help \[command\]
+
+*Admin:* /createrole, /removerole, /archiverole, /restorerole, /transferrole, /addtorole, /removefromrole, /setcategory, /undo, /auditlog, /schedule, /unschedule, /schedules, /allmembers, /prune, /botinfo, /setpingtemplate, /normalizeroles, /promote, /demote, /listadmins, /addalias, /removealias, /importmembers, /usage, /reloadconfig, /backup
+
+*Role Mentions:* @<rolename\> pings all users in a role; admins can use @everyone to ping all users in any role
+
+Use /help <command\> for details, e\.g\. /help addtorole`,
+
+	HelpDescription(CmdPing):            "Without arguments, checks that the bot is responding. With a role name, pings every member of that role, followed by the optional message. Add --limit N after the role to ping only the first N members by name, and --names to mention members by display name instead of @username. Admins can add --pin to pin the ping in the chat; the bot needs permission to pin messages.",
+	HelpDescription(CmdPingOncall):      "Pings the next member of a role in turn, making the role a round-robin on-call rotation. Members take turns in name order.",
+	HelpDescription(CmdListRoles):       "Lists all roles, or only those starting with the given prefix. Use * as a wildcard, e.g. *-team.",
+	HelpDescription(CmdListMembers):     "Lists the members of a role without pinging them. --format mentions (or --mentions) lists tappable profile links, and --format count (or --count) shows only the number of members.",
+	HelpDescription(CmdMute):            "Stops you from being mentioned when a role you belong to is pinged. You stay a member of the role.",
+	HelpDescription(CmdUnmute):          "Makes you mentioned again when a role you muted is pinged.",
+	HelpDescription(CmdHelp):            "Lists all commands, or shows detailed help for one command.",
+	HelpDescription(CmdStatus):          "Shows whether the bot is running, its uptime, the number of roles and known users, the updates handled since it started, and the deployed version.",
+	HelpDescription(CmdVersion):         "Shows the version and commit of the running build.",
+	HelpDescription(CmdCreateRole):      "Creates a new role. Role names are converted to lowercase.",
+	HelpDescription(CmdRemoveRole):      "Removes a role and all of its memberships. The bot first replies with the number of members affected; add confirm after the role name to remove it.",
+	HelpDescription(CmdAddToRole):       "Adds a user to a role. The @ prefix on the username is optional. Reply to someone's message, or to a message forwarded from them, with /addtorole <rolename> to add them without typing their username. Add --expires with a number of days, hours, or minutes, e.g. --expires 7d, to remove them again automatically.",
+	HelpDescription(CmdRemoveFromRole):  "Removes a user from a role. Reply to someone's message with /removefromrole <rolename> to remove them without typing their username.",
+	HelpDescription(CmdArchiveRole):     "Retires a role without losing its members. Archived roles are hidden from /listroles and can't be pinged.",
+	HelpDescription(CmdRestoreRole):     "Brings back an archived role with its members.",
+	HelpDescription(CmdTransferRole):    "Makes another user the owner of a role. The user must already be known to the bot, e.g. as a member of any role. Reply to someone's message with /transferrole <rolename> to pick them.",
+	HelpDescription(CmdSetCategory):     "Puts a role in a category, used to group /listroles output. Leave out the category to clear it.",
+	HelpDescription(CmdUndo):            "Reverts the most recent role change made in this chat. Removed roles are recreated with their members. Only the last 5 changes of the past 15 minutes can be undone.",
+	HelpDescription(CmdAuditLog):        "Shows the most recent changes made to a role.",
+	HelpDescription(CmdSchedule):        "Pings a role on a recurring schedule in this chat. The spec is five cron fields (minute hour day month weekday) or a descriptor like @daily.",
+	HelpDescription(CmdUnschedule):      "Removes a scheduled ping from this chat.",
+	HelpDescription(CmdWhoAmI):          "Shows the username and IDs the bot sees for you, and whether you are an admin. Roles store usernames in lowercase.",
+	HelpDescription(CmdFeedback):        "Sends feedback to the bot operators without leaving the chat.",
+	HelpDescription(CmdDND):             "Sets daily quiet hours during which you aren't mentioned by role pings, optionally in your own time zone. /dnd off clears them, and /dnd alone shows them. /pingoncall still reaches you.",
+	HelpDescription(CmdRoles):           "Shows the roles as buttons; tap one to ping that role.",
+	HelpDescription(CmdBotInfo):         "Shows runtime diagnostics such as uptime, memory usage, and database connections.",
+	HelpDescription(CmdSchedules):       "Lists the scheduled pings of this chat.",
+	HelpDescription(CmdPrune):           "Forgets users who are no longer in any role. Role owners are kept, and the audit log is not changed.",
+	HelpDescription(CmdAllMembers):      "Lists every user the bot knows, marking those who are not in any role. Long lists are split into pages.",
+	HelpDescription(CmdReloadConfig):    "Re-reads the configuration and applies the allowed chats, per-chat commands, admin, and rate limit without a restart. Other settings only change on restart.",
+	HelpDescription(CmdBackup):          "Takes a consistent snapshot of the database and sends it to you as a file in a private chat.",
+	HelpDescription(CmdSetPingTemplate): "Sets how pings in this chat are worded. {role}, {mentions}, {message}, and {count} are filled in, and {mentions} is required so members are still tagged. Without a template it shows the current one; reset goes back to the default.",
+	HelpDescription(CmdNormalizeRoles):  "Lowercases role names created in mixed case by older versions. Roles whose names then match an existing role are merged into it, keeping all members.",
+	HelpDescription(CmdPromote):         "Makes a user an admin. Admins added this way are kept in the database and can be removed with /demote.",
+	HelpDescription(CmdDemote):          "Takes away the admin rights given with /promote. The admin set in ADMIN_USERNAME can't be demoted.",
+	HelpDescription(CmdListAdmins):      "Lists the admin set in ADMIN_USERNAME and everyone made an admin with /promote.",
+	HelpDescription(CmdAddAlias):        "Adds another name for a command, e.g. /page for /ping. Aliases can't reuse the name of a command or point to another alias.",
+	HelpDescription(CmdRemoveAlias):     "Removes an alias added with /addalias.",
+	HelpDescription(CmdAliases):         "Lists the command aliases and the commands they run.",
+	HelpDescription(CmdImportMembers):   "Adds the group's members to a role. Telegram only lets bots see a group's administrators, so only they are added, and only if they have a username.",
+	HelpDescription(CmdUsage):           "Shows how often each command was used over the last 7 days, or the given number of days, and how that changed from the days before.",
+	HelpDescription(CmdRole):            "Groups the role commands under one name: /role create, delete, add, remove, list, members, archive, restore, transfer, and category take the same arguments and need the same rights as /createrole, /removerole, /addtorole, /removefromrole, /listroles, /listmembers, /archiverole, /restorerole, /transferrole, and /setcategory.",
+}
@@ -0,0 +1,208 @@
+package models
+
+// messagesES is the Spanish message catalog
+var messagesES = map[string]string{
+	MsgPong:                "pong",
+	MsgUnauthorized:        "No tienes permiso para usar este comando. Pídeselo a un administrador: %s",
+	MsgProvideRoleName:     "Indica el nombre de un rol.",
+	MsgUsageAddToRole:      "Uso: /addtorole <rol> <usuario>, o responde al mensaje de un usuario con /addtorole <rol>. Añade --expires 7d (o 12h, 30m) para añadirlo temporalmente.",
+	MsgUsageRemoveFromRole: "Uso: /removefromrole <rol> <usuario>, o responde al mensaje de un usuario con /removefromrole <rol>",
+	MsgReplyUserNoUsername: "Ese usuario no tiene nombre de usuario de Telegram, así que no se puede añadir a un rol.",
+	MsgForwardHidden:       "El autor del mensaje reenviado oculta su cuenta en los reenvíos, así que el bot no puede saber quién es. Indica su nombre de usuario.",
+	MsgNoRoles:             "No se encontraron roles.",
+	MsgRoles:               "Roles: %s",
+	MsgRolesHeader:         "Roles:",
+	MsgRoleCreated:         "Rol '%s' creado correctamente",
+	MsgRoleRemoved:         "Rol '%s' eliminado correctamente",
+	MsgConfirmRemoveRole:   "Esto quitará %d miembro(s) de '%s'. Envía /removerole %s confirm para continuar.",
+	MsgUserAdded:           "Usuario %s añadido al rol '%s'",
+	MsgUserAddedUntil:      "Usuario %s añadido al rol '%s' hasta %s",
+	MsgMembershipExpired:   "La pertenencia de %s al rol '%s' ha caducado.",
+	MsgInactiveWarning:     "Sin mensajes en %d días de %s. Escribe algo para seguir activo; un administrador puede quitar a los miembros inactivos con /removefromrole.",
+	MsgInactiveRemoved:     "Quitados de sus roles tras %d días sin mensajes: %s",
+	MsgUserRemoved:         "Usuario %s quitado del rol '%s'",
+	MsgNoUsersInRole:       "No hay usuarios en el rol '%s'",
+	MsgUsersInRole:         "Usuarios en el rol '%s': %s",
+	MsgRoleMemberCount:     "El rol '%s' tiene %d miembro(s).",
+	MsgUsageListMembers:    "Uso: /listmembers <rol> [--format plain|mentions|count]",
+	MsgBotStatus:           "✅ ¡El bot está en marcha y funcionando!\n⏱ Tiempo activo: %s\n🏷 Roles: %d\n👥 Usuarios: %d\n📨 Actualizaciones procesadas: %d\nℹ️ Versión: %s",
+	MsgVersion:             "Versión: %s",
+	MsgUnknownCommand:      "Comando desconocido. Usa /help para ver los comandos disponibles.",
+	MsgCommandDisabled:     "Este comando está desactivado en este chat.",
+	MsgInternalError:       "Algo salió mal. Inténtalo de nuevo más tarde.",
+	MsgUnavailable:         "El bot no está disponible temporalmente, vuelve a intentarlo en breve.",
+	MsgErrorCode:           "%s (%s)",
+	MsgRoleNotFound:        "El rol '%s' no existe. Usa /listroles para ver los roles disponibles.",
+	MsgRoleAlreadyExists:   "El rol '%s' ya existe.",
+	MsgTooManyRoles:        "El bot ya tiene el máximo de %d roles, compartidos por todos los chats. Elimina un rol antes de crear uno nuevo.",
+	MsgRoleArchived:        "El rol '%s' está archivado. Usa /restorerole para recuperarlo.",
+	MsgRoleArchivedOK:      "Rol '%s' archivado. Se conservan sus miembros; usa /restorerole para recuperarlo.",
+	MsgRoleRestored:        "Rol '%s' restaurado.",
+	MsgUsageTransferRole:   "Uso: /transferrole <rol> <usuario>, o responde al mensaje de un usuario con /transferrole <rol>",
+	MsgRoleTransferred:     "El rol '%s' ahora pertenece a %s.",
+	MsgUnknownUser:         "El bot aún no conoce al usuario %s. Añádelo primero a un rol, o responde a uno de sus mensajes.",
+	MsgUserNotInRole:       "El usuario %s no es miembro del rol '%s'.",
+	MsgUserAlreadyInRole:   "El usuario %s ya está en el rol '%s'.",
+	MsgInvalidInput:        "%s no válido: %s",
+	MsgHelpDetail:          "%s\n%s\nEjemplo: %s\nAcceso: %s",
+	MsgAccessEveryone:      "todos",
+	MsgAccessAdmins:        "solo administradores",
+	MsgAccessOwners:        "administradores y el propietario del rol",
+	MsgNoHelpForCommand:    "No hay ayuda para '%s'. Usa /help para ver todos los comandos.",
+	MsgNeedUsername:        "Necesitas un nombre de usuario de Telegram para usar este comando.",
+	MsgPingRole:            "Avisando al rol '%s': ",
+	MsgPingRoles:           "Avisando a los roles %s: ",
+	MsgPingOncall:          "De guardia en el rol '%s': @%s",
+	MsgPingLimited:         "Avisados %d de %d miembros.",
+	MsgPingSummary:         "+%d más. Consulta a todos con /listmembers %s",
+	MsgUsagePingLimit:      "Uso: /ping <rol> --limit <número> [mensaje], donde el número es al menos 1",
+	MsgPingEveryone:        "Avisando a todos: ",
+	MsgEveryoneCooldown:    "@%s solo se puede usar una vez cada %d minutos en un chat.",
+	MsgRoleMuted:           "Ya no se te mencionará cuando se avise a '%s'. Usa /unmute para deshacerlo.",
+	MsgRoleUnmuted:         "Se te volverá a mencionar cuando se avise a '%s'.",
+	MsgMutedMembers:        "Silenciados: %s",
+	MsgUsageSetCategory:    "Uso: /setcategory <rol> [categoría]. Omite la categoría para quitarla.",
+	MsgCategorySet:         "El rol '%s' está ahora en la categoría '%s'.",
+	MsgCategoryCleared:     "El rol '%s' ya no tiene categoría.",
+	MsgOtherCategory:       "Otros",
+	MsgNothingToUndo:       "No hay nada que deshacer. Solo se pueden deshacer los últimos 5 cambios de los últimos 15 minutos.",
+	MsgUndone:              "Deshecho: %s.",
+	MsgUndoCreateRole:      "creación del rol '%s'",
+	MsgUndoRemoveRole:      "eliminación del rol '%s' (%d miembros restaurados)",
+	MsgUndoAddToRole:       "añadir a %s al rol '%s'",
+	MsgUndoRemoveFromRole:  "quitar a %s del rol '%s'",
+	MsgNoAuditEntries:      "No hay registros de auditoría para el rol '%s'",
+	MsgAuditHeader:         "Cambios recientes en el rol '%s':",
+	MsgUsageSchedule:       "Uso: /schedule <rol> <expresión cron> [mensaje], p. ej. /schedule equipo 0 9 * * 1-5 ¡Hora de la reunión!",
+	MsgUsageUnschedule:     "Uso: /unschedule <id>. Usa /schedules para ver los avisos programados.",
+	MsgScheduleCreated:     "Aviso programado #%d para el rol '%s' en '%s'.",
+	MsgScheduleRemoved:     "Aviso programado #%d eliminado.",
+	MsgScheduleNotFound:    "No se encontró el aviso programado #%d en este chat.",
+	MsgNoSchedules:         "No hay avisos programados en este chat.",
+	MsgScheduleEntry:       "#%d '%s' en %s",
+	MsgSchedulesHeader:     "Avisos programados:",
+	MsgLeavingUnauthorized: "Este bot no está habilitado para este chat y saldrá ahora.",
+	MsgDepartedPruned:      "@%s salió del chat y fue quitado de %d rol(es).",
+	MsgBotInfo:             "Tiempo activo: %s\nVersión: %s\nGorrutinas: %d\nMemoria: %d MiB en uso, %d MiB del sistema\nConexiones a la base de datos: %d abiertas, %d en uso\nWorkers: %d\nLímite de peticiones: %d por minuto\nChats permitidos: %s",
+	MsgAllChats:            "todos",
+	MsgWhoAmI:              "Usuario: %s\nID de usuario: %d\nID del chat: %d\nAdministrador: %s",
+	MsgNoUsername:          "(ninguno, así que no se te puede añadir a roles)",
+	MsgYes:                 "sí",
+	MsgNo:                  "no",
+	MsgUsageAllMembers:     "Uso: /allmembers [página], donde la página está entre 1 y %d",
+	MsgNoKnownUsers:        "Todavía no se conoce a ningún usuario.",
+	MsgAllMembersHeader:    "Usuarios conocidos (%d, página %d de %d):",
+	MsgWithoutRoles:        "%s (sin roles)",
+	MsgUsageFeedback:       "Uso: /feedback <texto>",
+	MsgFeedbackDisabled:    "Los comentarios no están habilitados para este bot.",
+	MsgFeedbackCooldown:    "Puedes enviar comentarios una vez cada %d minutos.",
+	MsgFeedbackSent:        "Gracias, tus comentarios se enviaron a los operadores del bot.",
+	MsgFeedbackForward:     "Comentarios de %s (ID %d) en el chat %s:\n%s",
+	MsgUsageDND:            "Uso: /dnd <HH:MM-HH:MM> [zona horaria] para fijar horas de silencio, /dnd off para quitarlas o /dnd para verlas.",
+	MsgDNDSet:              "No molestar: %s (%s). No se te mencionará en avisos de roles durante esas horas.",
+	MsgDNDOff:              "No molestar está desactivado.",
+	MsgUnknownTimezone:     "Zona horaria '%s' desconocida. Usa un nombre IANA como Europe/Madrid.",
+	MsgPingQuiet:           "%d miembro(s) omitidos (no molestar).",
+	MsgRateLimited:         "Vas demasiado rápido. Inténtalo de nuevo en %d s.",
+	MsgRolesKeyboard:       "Toca un rol para avisarlo:",
+	MsgPreviousPage:        "« Anterior",
+	MsgNextPage:            "Siguiente »",
+	MsgMembersPage:         "Página %d de %d",
+	MsgUsersPruned:         "Se eliminaron %d usuario(s) que no estaban en ningún rol.",
+	MsgDepartedNotice:      "@%s: @%s salió del chat pero sigue siendo miembro de: %s. Usa /removefromrole para limpiarlo.",
+	MsgConfigReloaded:      "Configuración recargada. Cambios: %s",
+	MsgConfigUnchanged:     "Configuración recargada. No hubo cambios.",
+	MsgReloadNeedsRestart:  "No se aplica hasta reiniciar: %s",
+	MsgReloadFailed:        "La configuración no se recargó, se mantiene la actual:\n%s",
+	MsgBackupSent:          "Copia de seguridad de la base de datos enviada a tu chat privado con el bot.",
+	MsgBackupNotSent:       "No se pudo enviar la copia de seguridad. Abre un chat privado con el bot y vuelve a intentarlo.",
+	MsgBackupFailed:        "La copia de seguridad de la base de datos falló. Revisa los registros para más detalles.",
+	MsgUnbalancedQuotes:    "Falta cerrar unas comillas. Escribe los nombres con espacios entre comillas dobles, p. ej. \"qa team\".",
+	MsgPingTemplateSet:     "Los avisos de este chat ahora usan:\n%s",
+	MsgPingTemplateReset:   "Los avisos de este chat vuelven a usar el texto predeterminado.",
+	MsgPingTemplateDefault: "Los avisos de este chat usan el texto predeterminado. Define una plantilla con /setpingtemplate <plantilla>, usando {role}, {mentions}, {message} y {count}; {mentions} es obligatorio.",
+	MsgPingTemplateCurrent: "Los avisos de este chat usan:\n%s\nUsa /setpingtemplate reset para volver al texto predeterminado.",
+	MsgRolesNormalized:     "Nombres de rol pasados a minúsculas: %d renombrados, %d fusionados con un rol existente.",
+	MsgRolesAlreadyLower:   "Todos los nombres de rol ya están en minúsculas.",
+	MsgPinAdminOnly:        "Solo los administradores pueden fijar avisos con --pin.",
+	MsgPinFailed:           "No se pudo fijar el aviso. El bot necesita permiso para fijar mensajes en este chat.",
+	MsgUsagePromote:        "Uso: /promote <usuario>",
+	MsgUsageDemote:         "Uso: /demote <usuario>",
+	MsgAdminPromoted:       "@%s ahora es administrador.",
+	MsgAlreadyAdmin:        "@%s ya es administrador.",
+	MsgAdminDemoted:        "@%s ya no es administrador.",
+	MsgNotPromotedAdmin:    "@%s no fue nombrado administrador con /promote.",
+	MsgConfigAdminDemote:   "@%s está configurado como ADMIN_USERNAME y no se puede degradar.",
+	MsgAdmins:              "Administradores: %s",
+	MsgUsageAddAlias:       "Uso: /addalias <alias> <comando>, p. ej. /addalias page ping",
+	MsgUsageRemoveAlias:    "Uso: /removealias <alias>",
+	MsgAliasAdded:          "/%s ahora ejecuta /%s.",
+	MsgAliasRemoved:        "Se eliminó el alias /%s.",
+	MsgAliasNotFound:       "No existe el alias /%s.",
+	MsgAliases:             "Alias de comandos:\n%s",
+	MsgNoAliases:           "No hay alias de comandos. Los administradores pueden añadir uno con /addalias.",
+	MsgUsageImportMembers:  "Uso: /importmembers <rol>",
+	MsgImportGroupOnly:     "/importmembers solo funciona en grupos.",
+	MsgImportFailed:        "No se pudieron obtener los miembros del grupo. Inténtalo más tarde.",
+	MsgMembersImported:     "Añadidos %d miembros al rol '%s'. Telegram solo deja a los bots ver a los administradores de un grupo; se omitieron %d sin nombre de usuario.",
+	MsgUsageUsage:          "Uso: /usage [días], con días de 1 a %d",
+	MsgUsageHeader:         "Uso de comandos en los últimos %d días, con el cambio respecto a los días anteriores:",
+	MsgUsageOthers:         "%d comandos más: %d",
+	MsgNoUsage:             "No se usó ningún comando en los últimos %d días.",
+	MsgReplyUserIsBot:      "Ese mensaje es de un bot, que no se puede añadir a roles.",
+	MsgUsageRole:           "Uso: /role <subcomando> [argumentos], con subcomando uno de: %s",
+	MsgUsage:               "Uso: %s",
+
+	MsgHelp: `*Comandos de Telegram Role Bot*
+
+*Generales:* /ping \[rol\] \[\-\-limit N\] \[\-\-names\] \[\-\-pin\] \[mensaje\], /pingoncall <rol\>, /listroles \[prefijo\], /roles, /role <subcomando\> \[argumentos\], /listmembers <rol\> \[\-\-format F\], /mute <rol\>, /unmute <rol\>, /dnd \[HH:MM\-HH:MM\|off\], /status, /version, /whoami, /aliases, /feedback <texto\>, /help \[comando\]
+
+*Administración:* /createrole, /removerole, /archiverole, /restorerole, /transferrole, /addtorole, /removefromrole, /setcategory, /undo, /auditlog, /schedule, /unschedule, /schedules, /allmembers, /prune, /botinfo, /setpingtemplate, /normalizeroles, /promote, /demote, /listadmins, /addalias, /removealias, /importmembers, /usage, /reloadconfig, /backup
+
+*Menciones de rol:* @<rol\> avisa a todos los usuarios de un rol; los administradores pueden usar @everyone para avisar a todos los usuarios de cualquier rol
+
+Usa /help <comando\> para más detalles, p\. ej\. /help addtorole`,
+
+	HelpDescription(CmdPing):            "Sin argumentos, comprueba que el bot responde. Con un rol, avisa a todos sus miembros, seguido del mensaje opcional. Añade --limit N después del rol para avisar solo a los N primeros miembros por nombre, y --names para mencionarlos por su nombre visible en lugar de @usuario. Los administradores pueden añadir --pin para fijar el aviso en el chat; el bot necesita permiso para fijar mensajes.",
+	HelpDescription(CmdPingOncall):      "Avisa por turnos al siguiente miembro de un rol, convirtiendo el rol en una rotación de guardias. Los miembros se turnan por orden de nombre.",
+	HelpDescription(CmdListRoles):       "Muestra todos los roles, o solo los que empiezan por el prefijo indicado. Usa * como comodín, p. ej. *-team.",
+	HelpDescription(CmdListMembers):     "Muestra los miembros de un rol sin avisarles. --format mentions (o --mentions) muestra enlaces a sus perfiles, y --format count (o --count) muestra solo el número de miembros.",
+	HelpDescription(CmdMute):            "Evita que se te mencione cuando se avisa a un rol al que perteneces. Sigues siendo miembro del rol.",
+	HelpDescription(CmdUnmute):          "Hace que se te vuelva a mencionar cuando se avisa a un rol que silenciaste.",
+	HelpDescription(CmdHelp):            "Muestra todos los comandos, o la ayuda detallada de un comando.",
+	HelpDescription(CmdStatus):          "Indica si el bot está en marcha, su tiempo activo, el número de roles y usuarios conocidos, las actualizaciones procesadas desde que arrancó y la versión desplegada.",
+	HelpDescription(CmdVersion):         "Muestra la versión y el commit de la compilación en ejecución.",
+	HelpDescription(CmdCreateRole):      "Crea un rol nuevo. Los nombres de rol se convierten a minúsculas.",
+	HelpDescription(CmdRemoveRole):      "Elimina un rol y todos sus miembros. El bot responde primero con el número de miembros afectados; añade confirm tras el nombre del rol para eliminarlo.",
+	HelpDescription(CmdAddToRole):       "Añade un usuario a un rol. El prefijo @ es opcional. Responde al mensaje de alguien, o a un mensaje reenviado de esa persona, con /addtorole <rol> para añadirlo sin escribir su nombre de usuario. Añade --expires con un número de días, horas o minutos, p. ej. --expires 7d, para quitarlo de nuevo automáticamente.",
+	HelpDescription(CmdRemoveFromRole):  "Quita a un usuario de un rol. Responde al mensaje de alguien con /removefromrole <rol> para quitarlo sin escribir su nombre de usuario.",
+	HelpDescription(CmdArchiveRole):     "Retira un rol sin perder sus miembros. Los roles archivados no aparecen en /listroles y no se puede avisar a ellos.",
+	HelpDescription(CmdRestoreRole):     "Recupera un rol archivado con sus miembros.",
+	HelpDescription(CmdTransferRole):    "Hace a otro usuario propietario de un rol. El bot ya debe conocer al usuario, p. ej. como miembro de algún rol. Responde al mensaje de alguien con /transferrole <rol> para elegirlo.",
+	HelpDescription(CmdSetCategory):     "Asigna una categoría a un rol, usada para agrupar la salida de /listroles. Omite la categoría para quitarla.",
+	HelpDescription(CmdUndo):            "Revierte el último cambio de roles hecho en este chat. Los roles eliminados se recrean con sus miembros. Solo se pueden deshacer los últimos 5 cambios de los últimos 15 minutos.",
+	HelpDescription(CmdAuditLog):        "Muestra los cambios más recientes de un rol.",
+	HelpDescription(CmdSchedule):        "Avisa a un rol de forma periódica en este chat. La expresión son cinco campos cron (minuto hora día mes día-de-la-semana) o un descriptor como @daily.",
+	HelpDescription(CmdUnschedule):      "Elimina un aviso programado de este chat.",
+	HelpDescription(CmdWhoAmI):          "Muestra el nombre de usuario y los ID que el bot ve para ti, y si eres administrador. Los roles guardan los nombres de usuario en minúsculas.",
+	HelpDescription(CmdFeedback):        "Envía comentarios a los operadores del bot sin salir del chat.",
+	HelpDescription(CmdDND):             "Fija horas de silencio diarias en las que no se te menciona en avisos de roles, opcionalmente en tu propia zona horaria. /dnd off las quita y /dnd a secas las muestra. /pingoncall te sigue avisando.",
+	HelpDescription(CmdRoles):           "Muestra los roles como botones; toca uno para avisar a ese rol.",
+	HelpDescription(CmdBotInfo):         "Muestra diagnósticos de ejecución como el tiempo activo, el uso de memoria y las conexiones a la base de datos.",
+	HelpDescription(CmdSchedules):       "Muestra los avisos programados de este chat.",
+	HelpDescription(CmdPrune):           "Olvida a los usuarios que ya no están en ningún rol. Se conservan los propietarios de roles y el registro de auditoría no cambia.",
+	HelpDescription(CmdAllMembers):      "Muestra todos los usuarios que conoce el bot y marca a los que no están en ningún rol. Las listas largas se dividen en páginas.",
+	HelpDescription(CmdReloadConfig):    "Vuelve a leer la configuración y aplica los chats permitidos, los comandos por chat, el administrador y el límite de uso sin reiniciar. El resto de ajustes solo cambia al reiniciar.",
+	HelpDescription(CmdBackup):          "Hace una copia coherente de la base de datos y te la envía como archivo en un chat privado.",
+	HelpDescription(CmdSetPingTemplate): "Define el texto de los avisos de este chat. Se rellenan {role}, {mentions}, {message} y {count}, y {mentions} es obligatorio para que los miembros sigan recibiendo la mención. Sin plantilla muestra la actual; reset vuelve al texto predeterminado.",
+	HelpDescription(CmdNormalizeRoles):  "Pasa a minúsculas los nombres de rol creados con mayúsculas por versiones anteriores. Los roles cuyo nombre coincide entonces con un rol existente se fusionan con él, conservando todos los miembros.",
+	HelpDescription(CmdPromote):         "Nombra administrador a un usuario. Los administradores nombrados así se guardan en la base de datos y se pueden quitar con /demote.",
+	HelpDescription(CmdDemote):          "Quita los permisos de administrador dados con /promote. El administrador de ADMIN_USERNAME no se puede degradar.",
+	HelpDescription(CmdListAdmins):      "Muestra el administrador de ADMIN_USERNAME y a todos los nombrados con /promote.",
+	HelpDescription(CmdAddAlias):        "Añade otro nombre para un comando, p. ej. /page para /ping. Un alias no puede usar el nombre de un comando ni apuntar a otro alias.",
+	HelpDescription(CmdRemoveAlias):     "Elimina un alias añadido con /addalias.",
+	HelpDescription(CmdAliases):         "Muestra los alias de comandos y los comandos que ejecutan.",
+	HelpDescription(CmdImportMembers):   "Añade los miembros del grupo a un rol. Telegram solo deja a los bots ver a los administradores de un grupo, así que solo se añaden ellos, y solo si tienen nombre de usuario.",
+	HelpDescription(CmdUsage):           "Muestra cuántas veces se usó cada comando en los últimos 7 días, o en los días indicados, y cómo cambió respecto a los días anteriores.",
+	HelpDescription(CmdRole):            "Agrupa los comandos de roles bajo un nombre: /role create, delete, add, remove, list, members, archive, restore, transfer y category usan los mismos argumentos y permisos que /createrole, /removerole, /addtorole, /removefromrole, /listroles, /listmembers, /archiverole, /restorerole, /transferrole y /setcategory.",
+}
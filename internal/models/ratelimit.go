@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// RateEvent is a single rate-limited request, persisted so limits survive restarts
+type RateEvent struct {
+	UserID int64
+	At     time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+// ScheduledPing is a recurring ping of a role in a chat
+type ScheduledPing struct {
+	ID        int64
+	ChatID    int64
+	Role      string
+	Spec      string
+	Message   string
+	CreatedBy string
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Placeholders that ping templates are filled in with
+const (
+	PlaceholderRole     = "{role}"
+	PlaceholderMentions = "{mentions}"
+	PlaceholderMessage  = "{message}"
+	PlaceholderCount    = "{count}"
+)
+
+// MaxPingTemplateLength is the longest ping template allowed, in characters
+const MaxPingTemplateLength = 500
+
+// ValidatePingTemplate checks that a ping template mentions the pinged users
+// and isn't too long
+func ValidatePingTemplate(template string) error {
+	if !strings.Contains(template, PlaceholderMentions) {
+		return ErrInvalidInput{Field: "ping template", Value: template, Reason: "must contain " + PlaceholderMentions}
+	}
+	if utf8.RuneCountInString(template) > MaxPingTemplateLength {
+		return ErrInvalidInput{Field: "ping template", Value: template, Reason: fmt.Sprintf("is longer than %d characters", MaxPingTemplateLength)}
+	}
+	return nil
+}
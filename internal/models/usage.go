@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CommandCount is the number of times a command was used
+type CommandCount struct {
+	Command string
+	Count   int
+}
+
+// CommandLogRetention is how long used commands are kept for /usage
+const CommandLogRetention = 90 * 24 * time.Hour
+
+// UsageDefaultDays is the window /usage reports on without an argument
+const UsageDefaultDays = 7
+
+// UsageListLimit is the number of commands listed by /usage; the rest are
+// summed up on one line
+const UsageListLimit = 15
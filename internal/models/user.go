@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// User represents a Telegram user known to the bot
+type User struct {
+	Name       string
+	TelegramID int64
+	FirstName  string
+	LastName   string
+}
+
+// DisplayName returns the user's first and last name, or "" if neither is known
+func (u User) DisplayName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// KnownUser is a user known to the bot with the number of roles they are in
+type KnownUser struct {
+	Name  string
+	Roles int
+}
+
+// Membership is a user's membership in a role
+type Membership struct {
+	Role string
+	User string
+	// ChatID is the chat the user was added in
+	ChatID int64
+	// ExpiresAt is when the membership ends; zero if it doesn't
+	ExpiresAt time.Time
+}
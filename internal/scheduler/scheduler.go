@@ -0,0 +1,94 @@
+// Package scheduler fires recurring pings on cron schedules.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/store"
+	"didactic-spork/pkg/logger"
+)
+
+// FireFunc sends a scheduled ping when it is due
+type FireFunc func(ctx context.Context, ping models.ScheduledPing) error
+
+// Scheduler checks the stored schedules once a minute and fires the due ones.
+// Schedules are read from the store on every tick, so changes made through
+// commands and schedules created before a restart are picked up automatically.
+type Scheduler struct {
+	store  store.Store
+	fire   FireFunc
+	logger *logger.Logger
+}
+
+// New creates a new scheduler
+func New(store store.Store, fire FireFunc, logger *logger.Logger) *Scheduler {
+	return &Scheduler{
+		store:  store,
+		fire:   fire,
+		logger: logger,
+	}
+}
+
+// ParseSpec parses a standard five-field cron spec or a descriptor like @daily
+func ParseSpec(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, models.ErrInvalidInput{Field: "schedule", Value: spec, Reason: err.Error()}
+	}
+	return schedule, nil
+}
+
+// Run fires due pings at the start of every minute until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.Info("Scheduler started")
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logger.Info("Scheduler stopped")
+			return
+		case <-timer.C:
+			s.tick(ctx, next)
+		}
+	}
+}
+
+// tick fires every ping whose schedule matches the given minute
+func (s *Scheduler) tick(ctx context.Context, at time.Time) {
+	pings, err := s.store.GetScheduledPings(ctx)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load scheduled pings")
+		return
+	}
+
+	for _, ping := range pings {
+		log := s.logger.WithFields(map[string]interface{}{
+			"schedule_id": ping.ID,
+			"chat_id":     ping.ChatID,
+			"role":        ping.Role,
+		})
+
+		schedule, err := ParseSpec(ping.Spec)
+		if err != nil {
+			log.WithError(err).Warn("Skipping scheduled ping with invalid spec")
+			continue
+		}
+		if !schedule.Next(at.Add(-time.Second)).Equal(at) {
+			continue
+		}
+
+		if err := s.fire(ctx, ping); err != nil {
+			log.WithError(err).Error("Failed to send scheduled ping")
+			continue
+		}
+		log.Info("Sent scheduled ping")
+	}
+}
@@ -0,0 +1,503 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"didactic-spork/internal/models"
+)
+
+// After breakerThreshold consecutive database failures, store calls fail
+// fast for breakerCooldown. After that, one call at a time is let through to
+// probe whether the database has recovered.
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// breakerStore stops calling a Store whose database keeps failing, e.g.
+// because its file stays locked or the disk is full. While the breaker is
+// open, calls fail with models.ErrUnavailable instead of hitting the database.
+type breakerStore struct {
+	Store
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is when the breaker last opened; zero while it is closed
+	openedAt time.Time
+	probing  bool
+}
+
+// isDBFailure reports whether err means the database failed, rather than
+// the request being invalid or cancelled
+func isDBFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return models.ErrorCode(err) == models.CodeInternal
+}
+
+// allow reports whether a call may go to the database
+func (s *breakerStore) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.openedAt.IsZero() {
+		return true
+	}
+	if s.probing || time.Since(s.openedAt) < breakerCooldown {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call. A failed probe
+// opens the breaker for another cooldown.
+func (s *breakerStore) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probing = false
+	if !isDBFailure(err) {
+		s.failures = 0
+		s.openedAt = time.Time{}
+		return
+	}
+
+	s.failures++
+	if s.failures >= breakerThreshold {
+		s.openedAt = time.Now()
+	}
+}
+
+// call runs a store call unless the breaker is open
+func (s *breakerStore) call(fn func() error) error {
+	if !s.allow() {
+		return models.ErrUnavailable{}
+	}
+	err := fn()
+	s.record(err)
+	return err
+}
+
+func (s *breakerStore) CreateRole(ctx context.Context, actor models.Actor, role string) error {
+	return s.call(func() error {
+		return s.Store.CreateRole(ctx, actor, role)
+	})
+}
+
+func (s *breakerStore) RemoveRole(ctx context.Context, actor models.Actor, role string) error {
+	return s.call(func() error {
+		return s.Store.RemoveRole(ctx, actor, role)
+	})
+}
+
+func (s *breakerStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	var added bool
+	err := s.call(func() (err error) {
+		added, err = s.Store.AddUserToRole(ctx, actor, role, user)
+		return err
+	})
+	return added, err
+}
+
+func (s *breakerStore) AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, role, user string, expiresAt time.Time) (bool, error) {
+	var added bool
+	err := s.call(func() (err error) {
+		added, err = s.Store.AddUserToRoleWithExpiry(ctx, actor, role, user, expiresAt)
+		return err
+	})
+	return added, err
+}
+
+func (s *breakerStore) RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error) {
+	var expired []models.Membership
+	err := s.call(func() (err error) {
+		expired, err = s.Store.RemoveExpiredMemberships(ctx, actor, now)
+		return err
+	})
+	return expired, err
+}
+
+func (s *breakerStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error {
+	return s.call(func() error {
+		return s.Store.RemoveUserFromRole(ctx, actor, role, user)
+	})
+}
+
+func (s *breakerStore) UpsertUser(ctx context.Context, user models.User) error {
+	return s.call(func() error {
+		return s.Store.UpsertUser(ctx, user)
+	})
+}
+
+func (s *breakerStore) GetUsers(ctx context.Context, names []string) ([]models.User, error) {
+	var users []models.User
+	err := s.call(func() (err error) {
+		users, err = s.Store.GetUsers(ctx, names)
+		return err
+	})
+	return users, err
+}
+
+func (s *breakerStore) RemoveUserFromAllRoles(ctx context.Context, actor models.Actor, user string) (int, error) {
+	var removed int
+	err := s.call(func() (err error) {
+		removed, err = s.Store.RemoveUserFromAllRoles(ctx, actor, user)
+		return err
+	})
+	return removed, err
+}
+
+func (s *breakerStore) GetUsersInRole(ctx context.Context, role string) ([]string, error) {
+	var users []string
+	err := s.call(func() (err error) {
+		users, err = s.Store.GetUsersInRole(ctx, role)
+		return err
+	})
+	return users, err
+}
+
+func (s *breakerStore) NextOncall(ctx context.Context, role string) (string, error) {
+	var user string
+	err := s.call(func() (err error) {
+		user, err = s.Store.NextOncall(ctx, role)
+		return err
+	})
+	return user, err
+}
+
+func (s *breakerStore) MuteRole(ctx context.Context, role, user string) error {
+	return s.call(func() error {
+		return s.Store.MuteRole(ctx, role, user)
+	})
+}
+
+func (s *breakerStore) UnmuteRole(ctx context.Context, role, user string) error {
+	return s.call(func() error {
+		return s.Store.UnmuteRole(ctx, role, user)
+	})
+}
+
+func (s *breakerStore) GetMutedUsersInRole(ctx context.Context, role string) ([]string, error) {
+	var users []string
+	err := s.call(func() (err error) {
+		users, err = s.Store.GetMutedUsersInRole(ctx, role)
+		return err
+	})
+	return users, err
+}
+
+func (s *breakerStore) SetDND(ctx context.Context, user string, dnd *models.DND) error {
+	return s.call(func() error {
+		return s.Store.SetDND(ctx, user, dnd)
+	})
+}
+
+func (s *breakerStore) GetDND(ctx context.Context, users []string) (map[string]models.DND, error) {
+	var dnd map[string]models.DND
+	err := s.call(func() (err error) {
+		dnd, err = s.Store.GetDND(ctx, users)
+		return err
+	})
+	return dnd, err
+}
+
+func (s *breakerStore) SetPingTemplate(ctx context.Context, actor models.Actor, template string) error {
+	return s.call(func() error {
+		return s.Store.SetPingTemplate(ctx, actor, template)
+	})
+}
+
+func (s *breakerStore) GetPingTemplate(ctx context.Context, chatID int64) (string, error) {
+	var template string
+	err := s.call(func() (err error) {
+		template, err = s.Store.GetPingTemplate(ctx, chatID)
+		return err
+	})
+	return template, err
+}
+
+func (s *breakerStore) SetCommandAlias(ctx context.Context, actor models.Actor, alias, command string) error {
+	return s.call(func() error {
+		return s.Store.SetCommandAlias(ctx, actor, alias, command)
+	})
+}
+
+func (s *breakerStore) RemoveCommandAlias(ctx context.Context, alias string) (bool, error) {
+	var removed bool
+	err := s.call(func() (err error) {
+		removed, err = s.Store.RemoveCommandAlias(ctx, alias)
+		return err
+	})
+	return removed, err
+}
+
+func (s *breakerStore) GetCommandAliases(ctx context.Context) (map[string]string, error) {
+	var aliases map[string]string
+	err := s.call(func() (err error) {
+		aliases, err = s.Store.GetCommandAliases(ctx)
+		return err
+	})
+	return aliases, err
+}
+
+func (s *breakerStore) AddAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	var added bool
+	err := s.call(func() (err error) {
+		added, err = s.Store.AddAdmin(ctx, actor, user)
+		return err
+	})
+	return added, err
+}
+
+func (s *breakerStore) RemoveAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	var removed bool
+	err := s.call(func() (err error) {
+		removed, err = s.Store.RemoveAdmin(ctx, actor, user)
+		return err
+	})
+	return removed, err
+}
+
+func (s *breakerStore) ListAdmins(ctx context.Context) ([]string, error) {
+	var admins []string
+	err := s.call(func() (err error) {
+		admins, err = s.Store.ListAdmins(ctx)
+		return err
+	})
+	return admins, err
+}
+
+func (s *breakerStore) GetAllRoles(ctx context.Context, includeArchived bool) ([]string, error) {
+	var roles []string
+	err := s.call(func() (err error) {
+		roles, err = s.Store.GetAllRoles(ctx, includeArchived)
+		return err
+	})
+	return roles, err
+}
+
+func (s *breakerStore) GetRolesMatching(ctx context.Context, pattern string) ([]string, error) {
+	var roles []string
+	err := s.call(func() (err error) {
+		roles, err = s.Store.GetRolesMatching(ctx, pattern)
+		return err
+	})
+	return roles, err
+}
+
+func (s *breakerStore) SetRoleCategory(ctx context.Context, actor models.Actor, role, category string) error {
+	return s.call(func() error {
+		return s.Store.SetRoleCategory(ctx, actor, role, category)
+	})
+}
+
+func (s *breakerStore) GetRolesByCategory(ctx context.Context) (map[string][]string, error) {
+	var categories map[string][]string
+	err := s.call(func() (err error) {
+		categories, err = s.Store.GetRolesByCategory(ctx)
+		return err
+	})
+	return categories, err
+}
+
+func (s *breakerStore) SetRoleArchived(ctx context.Context, actor models.Actor, role string, archived bool) error {
+	return s.call(func() error {
+		return s.Store.SetRoleArchived(ctx, actor, role, archived)
+	})
+}
+
+func (s *breakerStore) SetRoleOwner(ctx context.Context, actor models.Actor, role, owner string) error {
+	return s.call(func() error {
+		return s.Store.SetRoleOwner(ctx, actor, role, owner)
+	})
+}
+
+func (s *breakerStore) IsRoleOwner(ctx context.Context, role, user string) (bool, error) {
+	var owner bool
+	err := s.call(func() (err error) {
+		owner, err = s.Store.IsRoleOwner(ctx, role, user)
+		return err
+	})
+	return owner, err
+}
+
+func (s *breakerStore) IsRoleArchived(ctx context.Context, role string) (bool, error) {
+	var archived bool
+	err := s.call(func() (err error) {
+		archived, err = s.Store.IsRoleArchived(ctx, role)
+		return err
+	})
+	return archived, err
+}
+
+func (s *breakerStore) GetRolesForUser(ctx context.Context, user string) ([]string, error) {
+	var roles []string
+	err := s.call(func() (err error) {
+		roles, err = s.Store.GetRolesForUser(ctx, user)
+		return err
+	})
+	return roles, err
+}
+
+func (s *breakerStore) GetAllUsersInChat(ctx context.Context) ([]string, error) {
+	var users []string
+	err := s.call(func() (err error) {
+		users, err = s.Store.GetAllUsersInChat(ctx)
+		return err
+	})
+	return users, err
+}
+
+func (s *breakerStore) GetAllUsers(ctx context.Context) ([]models.KnownUser, error) {
+	var users []models.KnownUser
+	err := s.call(func() (err error) {
+		users, err = s.Store.GetAllUsers(ctx)
+		return err
+	})
+	return users, err
+}
+
+func (s *breakerStore) PruneOrphanUsers(ctx context.Context) (int, error) {
+	var removed int
+	err := s.call(func() (err error) {
+		removed, err = s.Store.PruneOrphanUsers(ctx)
+		return err
+	})
+	return removed, err
+}
+
+func (s *breakerStore) NormalizeRoleNames(ctx context.Context, actor models.Actor) (renamed, merged int, err error) {
+	err = s.call(func() (err error) {
+		renamed, merged, err = s.Store.NormalizeRoleNames(ctx, actor)
+		return err
+	})
+	return renamed, merged, err
+}
+
+func (s *breakerStore) GetAuditLog(ctx context.Context, role string, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := s.call(func() (err error) {
+		entries, err = s.Store.GetAuditLog(ctx, role, limit)
+		return err
+	})
+	return entries, err
+}
+
+func (s *breakerStore) CreateScheduledPing(ctx context.Context, actor models.Actor, ping models.ScheduledPing) (int64, error) {
+	var id int64
+	err := s.call(func() (err error) {
+		id, err = s.Store.CreateScheduledPing(ctx, actor, ping)
+		return err
+	})
+	return id, err
+}
+
+func (s *breakerStore) DeleteScheduledPing(ctx context.Context, actor models.Actor, id int64) error {
+	return s.call(func() error {
+		return s.Store.DeleteScheduledPing(ctx, actor, id)
+	})
+}
+
+func (s *breakerStore) GetScheduledPings(ctx context.Context) ([]models.ScheduledPing, error) {
+	var pings []models.ScheduledPing
+	err := s.call(func() (err error) {
+		pings, err = s.Store.GetScheduledPings(ctx)
+		return err
+	})
+	return pings, err
+}
+
+func (s *breakerStore) GetScheduledPingsForChat(ctx context.Context, chatID int64) ([]models.ScheduledPing, error) {
+	var pings []models.ScheduledPing
+	err := s.call(func() (err error) {
+		pings, err = s.Store.GetScheduledPingsForChat(ctx, chatID)
+		return err
+	})
+	return pings, err
+}
+
+func (s *breakerStore) SetChatDeparted(ctx context.Context, chatID int64, departed bool, at time.Time) error {
+	return s.call(func() error {
+		return s.Store.SetChatDeparted(ctx, chatID, departed, at)
+	})
+}
+
+func (s *breakerStore) GetChatsDepartedBefore(ctx context.Context, before time.Time) ([]int64, error) {
+	var chats []int64
+	err := s.call(func() (err error) {
+		chats, err = s.Store.GetChatsDepartedBefore(ctx, before)
+		return err
+	})
+	return chats, err
+}
+
+func (s *breakerStore) DeleteChatData(ctx context.Context, chatID int64) error {
+	return s.call(func() error {
+		return s.Store.DeleteChatData(ctx, chatID)
+	})
+}
+
+func (s *breakerStore) GetRateEvents(ctx context.Context, since time.Time) ([]models.RateEvent, error) {
+	var events []models.RateEvent
+	err := s.call(func() (err error) {
+		events, err = s.Store.GetRateEvents(ctx, since)
+		return err
+	})
+	return events, err
+}
+
+func (s *breakerStore) GetLastUpdateID(ctx context.Context, shard int) (int, error) {
+	var id int
+	err := s.call(func() (err error) {
+		id, err = s.Store.GetLastUpdateID(ctx, shard)
+		return err
+	})
+	return id, err
+}
+
+func (s *breakerStore) SetLastUpdateID(ctx context.Context, shard, id int) error {
+	return s.call(func() error {
+		return s.Store.SetLastUpdateID(ctx, shard, id)
+	})
+}
+
+func (s *breakerStore) SaveRateEvents(ctx context.Context, events []models.RateEvent, pruneBefore time.Time) error {
+	return s.call(func() error {
+		return s.Store.SaveRateEvents(ctx, events, pruneBefore)
+	})
+}
+
+func (s *breakerStore) LogCommand(ctx context.Context, command string, chatID int64, at time.Time) error {
+	return s.call(func() error {
+		return s.Store.LogCommand(ctx, command, chatID, at)
+	})
+}
+
+func (s *breakerStore) GetUsageStats(ctx context.Context, since time.Time) ([]models.CommandCount, error) {
+	var counts []models.CommandCount
+	err := s.call(func() (err error) {
+		counts, err = s.Store.GetUsageStats(ctx, since)
+		return err
+	})
+	return counts, err
+}
+
+func (s *breakerStore) SetLastSeen(ctx context.Context, user string, at time.Time) error {
+	return s.call(func() error {
+		return s.Store.SetLastSeen(ctx, user, at)
+	})
+}
+
+func (s *breakerStore) GetInactiveMemberships(ctx context.Context, seenAfter, seenBefore time.Time) ([]models.Membership, error) {
+	var inactive []models.Membership
+	err := s.call(func() (err error) {
+		inactive, err = s.Store.GetInactiveMemberships(ctx, seenAfter, seenBefore)
+		return err
+	})
+	return inactive, err
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"didactic-spork/internal/models"
+)
+
+// flakyStore is a Store whose GetAllRoles fails with err while it is set.
+// Calls wait for release when it is set, so a call can be held in flight.
+type flakyStore struct {
+	Store
+
+	mu      sync.Mutex
+	calls   int
+	err     error
+	release chan struct{}
+}
+
+func (f *flakyStore) GetAllRoles(ctx context.Context, includeArchived bool) ([]string, error) {
+	f.mu.Lock()
+	f.calls++
+	err, release := f.err, f.release
+	f.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	return nil, err
+}
+
+func (f *flakyStore) set(err error, release chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err, f.release = err, release
+}
+
+func (f *flakyStore) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	inner := &flakyStore{err: errors.New("disk I/O error")}
+	breaker := &breakerStore{Store: inner}
+	ctx := context.Background()
+
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := breaker.GetAllRoles(ctx, false); errors.As(err, &models.ErrUnavailable{}) {
+			t.Fatalf("call %d failed fast before the breaker opened", i+1)
+		}
+	}
+
+	// Open: calls fail fast without reaching the database
+	if _, err := breaker.GetAllRoles(ctx, false); !errors.As(err, &models.ErrUnavailable{}) {
+		t.Fatalf("err = %v with the breaker open, want ErrUnavailable", err)
+	}
+	if n := inner.callCount(); n != breakerThreshold {
+		t.Fatalf("inner store called %d times, want %d", n, breakerThreshold)
+	}
+
+	// After the cooldown one probe goes through while the others still fail fast
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-breakerCooldown)
+	breaker.mu.Unlock()
+	release := make(chan struct{})
+	inner.set(nil, release)
+	probed := make(chan error)
+	go func() {
+		_, err := breaker.GetAllRoles(ctx, false)
+		probed <- err
+	}()
+	for inner.callCount() == breakerThreshold {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := breaker.GetAllRoles(ctx, false); !errors.As(err, &models.ErrUnavailable{}) {
+		t.Errorf("err = %v during the probe, want ErrUnavailable", err)
+	}
+	close(release)
+	if err := <-probed; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	// The successful probe closed the breaker
+	inner.set(nil, nil)
+	if _, err := breaker.GetAllRoles(ctx, false); err != nil {
+		t.Errorf("err = %v after recovery, want nil", err)
+	}
+	if n := inner.callCount(); n != breakerThreshold+2 {
+		t.Errorf("inner store called %d times, want %d", n, breakerThreshold+2)
+	}
+}
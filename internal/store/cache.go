@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/pkg/utils"
+)
+
+// membersCacheStore keeps the members of recently pinged roles in memory, so
+// a role pinged over and over in a busy group doesn't hit the database each
+// time. Entries expire after ttl, the oldest entry is dropped when size
+// roles are cached, and a role's entry is dropped whenever a write through
+// the store may change its members.
+type membersCacheStore struct {
+	Store
+
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]cachedMembers
+	// generation counts invalidations, so a read that started before one
+	// doesn't cache the members it got from before the write
+	generation uint64
+}
+
+type cachedMembers struct {
+	users   []string
+	expires time.Time
+}
+
+func newMembersCacheStore(store Store, ttl time.Duration, size int) *membersCacheStore {
+	return &membersCacheStore{
+		Store:   store,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cachedMembers),
+	}
+}
+
+func (s *membersCacheStore) GetUsersInRole(ctx context.Context, role string) ([]string, error) {
+	key := utils.SanitizeRoleName(role)
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return slices.Clone(entry.users), nil
+	}
+
+	users, err := s.Store.GetUsersInRole(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		s.evict()
+		s.entries[key] = cachedMembers{users: slices.Clone(users), expires: time.Now().Add(s.ttl)}
+	}
+	return users, nil
+}
+
+// evict makes room for one more entry, dropping expired entries first and
+// then the one closest to expiring. It must be called with mu held.
+func (s *membersCacheStore) evict() {
+	if len(s.entries) < s.size {
+		return
+	}
+
+	now := time.Now()
+	oldest := ""
+	for role, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, role)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(s.entries[oldest].expires) {
+			oldest = role
+		}
+	}
+	if len(s.entries) >= s.size {
+		delete(s.entries, oldest)
+	}
+}
+
+// invalidate drops the cached members of the given roles, or of every role
+// if none are given
+func (s *membersCacheStore) invalidate(roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	if len(roles) == 0 {
+		clear(s.entries)
+		return
+	}
+	for _, role := range roles {
+		delete(s.entries, utils.SanitizeRoleName(role))
+	}
+}
+
+func (s *membersCacheStore) CreateRole(ctx context.Context, actor models.Actor, role string) error {
+	defer s.invalidate(role)
+	return s.Store.CreateRole(ctx, actor, role)
+}
+
+func (s *membersCacheStore) RemoveRole(ctx context.Context, actor models.Actor, role string) error {
+	defer s.invalidate(role)
+	return s.Store.RemoveRole(ctx, actor, role)
+}
+
+func (s *membersCacheStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	defer s.invalidate(role)
+	return s.Store.AddUserToRole(ctx, actor, role, user)
+}
+
+func (s *membersCacheStore) AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, role, user string, expiresAt time.Time) (bool, error) {
+	defer s.invalidate(role)
+	return s.Store.AddUserToRoleWithExpiry(ctx, actor, role, user, expiresAt)
+}
+
+func (s *membersCacheStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error {
+	defer s.invalidate(role)
+	return s.Store.RemoveUserFromRole(ctx, actor, role, user)
+}
+
+func (s *membersCacheStore) RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error) {
+	expired, err := s.Store.RemoveExpiredMemberships(ctx, actor, now)
+	if err != nil {
+		s.invalidate()
+		return nil, err
+	}
+	if len(expired) > 0 {
+		roles := make([]string, len(expired))
+		for i, membership := range expired {
+			roles[i] = membership.Role
+		}
+		s.invalidate(roles...)
+	}
+	return expired, nil
+}
+
+func (s *membersCacheStore) RemoveUserFromAllRoles(ctx context.Context, actor models.Actor, user string) (int, error) {
+	defer s.invalidate()
+	return s.Store.RemoveUserFromAllRoles(ctx, actor, user)
+}
+
+func (s *membersCacheStore) NormalizeRoleNames(ctx context.Context, actor models.Actor) (renamed, merged int, err error) {
+	defer s.invalidate()
+	return s.Store.NormalizeRoleNames(ctx, actor)
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"didactic-spork/internal/models"
+)
+
+// countingStore is a Store holding the members of roles in memory that
+// counts how often GetUsersInRole reaches it
+type countingStore struct {
+	Store
+
+	mu      sync.Mutex
+	reads   int
+	members map[string][]string
+}
+
+func (f *countingStore) GetUsersInRole(ctx context.Context, role string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	return slices.Clone(f.members[role]), nil
+}
+
+func (f *countingStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members[role] = append(f.members[role], user)
+	return true, nil
+}
+
+func (f *countingStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members[role] = slices.DeleteFunc(f.members[role], func(u string) bool { return u == user })
+	return nil
+}
+
+func (f *countingStore) RemoveRole(ctx context.Context, actor models.Actor, role string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.members, role)
+	return nil
+}
+
+func (f *countingStore) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+func TestMembersCache(t *testing.T) {
+	inner := &countingStore{members: map[string][]string{"devs": {"alice"}, "ops": {"bob"}}}
+	cache := newMembersCacheStore(inner, time.Hour, 10)
+	ctx := context.Background()
+
+	// get reads the members of role and checks them and the reads so far
+	get := func(role string, want []string, reads int) {
+		t.Helper()
+		users, err := cache.GetUsersInRole(ctx, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(users, want) {
+			t.Errorf("%s members = %v, want %v", role, users, want)
+		}
+		if n := inner.readCount(); n != reads {
+			t.Errorf("store read %d times, want %d", n, reads)
+		}
+	}
+
+	get("devs", []string{"alice"}, 1)
+	get("devs", []string{"alice"}, 1)
+	get("Devs", []string{"alice"}, 1)
+	get("ops", []string{"bob"}, 2)
+
+	// Writes drop only the entry of the role they change
+	cache.AddUserToRole(ctx, testActor, "devs", "carol")
+	get("devs", []string{"alice", "carol"}, 3)
+	get("ops", []string{"bob"}, 3)
+	cache.RemoveUserFromRole(ctx, testActor, "devs", "alice")
+	get("devs", []string{"carol"}, 4)
+	cache.RemoveRole(ctx, testActor, "devs")
+	get("devs", nil, 5)
+	get("ops", []string{"bob"}, 5)
+}
+
+func TestMembersCacheExpires(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	inner := &countingStore{members: map[string][]string{"devs": {"alice"}}}
+	cache := newMembersCacheStore(inner, ttl, 10)
+	ctx := context.Background()
+
+	cache.GetUsersInRole(ctx, "devs")
+	cache.GetUsersInRole(ctx, "devs")
+	if n := inner.readCount(); n != 1 {
+		t.Fatalf("store read %d times before the entry expired, want 1", n)
+	}
+	time.Sleep(ttl + 10*time.Millisecond)
+	cache.GetUsersInRole(ctx, "devs")
+	if n := inner.readCount(); n != 2 {
+		t.Errorf("store read %d times after the entry expired, want 2", n)
+	}
+}
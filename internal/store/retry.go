@@ -0,0 +1,261 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"didactic-spork/internal/models"
+)
+
+// Retries of writes that fail because another connection holds the write
+// lock for longer than the busy timeout
+const (
+	maxBusyRetries = 3
+	busyRetryDelay = 100 * time.Millisecond
+)
+
+// busyRetryStore retries the writes of a Store when SQLite reports the
+// database as busy or locked. SQLite allows a single writer at a time, so
+// concurrent commands can collide under load.
+type busyRetryStore struct {
+	Store
+}
+
+// isBusy reports whether err means SQLite couldn't get a lock
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// retryBusy runs write, retrying with a growing delay while it fails with a
+// busy error
+func retryBusy(ctx context.Context, write func() error) error {
+	err := write()
+	for attempt := 1; attempt <= maxBusyRetries && isBusy(err); attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * busyRetryDelay):
+		}
+		err = write()
+	}
+	return err
+}
+
+func (s *busyRetryStore) CreateRole(ctx context.Context, actor models.Actor, role string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.CreateRole(ctx, actor, role)
+	})
+}
+
+func (s *busyRetryStore) RemoveRole(ctx context.Context, actor models.Actor, role string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.RemoveRole(ctx, actor, role)
+	})
+}
+
+func (s *busyRetryStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	var added bool
+	err := retryBusy(ctx, func() (err error) {
+		added, err = s.Store.AddUserToRole(ctx, actor, role, user)
+		return err
+	})
+	return added, err
+}
+
+func (s *busyRetryStore) AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, role, user string, expiresAt time.Time) (bool, error) {
+	var added bool
+	err := retryBusy(ctx, func() (err error) {
+		added, err = s.Store.AddUserToRoleWithExpiry(ctx, actor, role, user, expiresAt)
+		return err
+	})
+	return added, err
+}
+
+func (s *busyRetryStore) RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error) {
+	var expired []models.Membership
+	err := retryBusy(ctx, func() (err error) {
+		expired, err = s.Store.RemoveExpiredMemberships(ctx, actor, now)
+		return err
+	})
+	return expired, err
+}
+
+func (s *busyRetryStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.RemoveUserFromRole(ctx, actor, role, user)
+	})
+}
+
+func (s *busyRetryStore) UpsertUser(ctx context.Context, user models.User) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.UpsertUser(ctx, user)
+	})
+}
+
+func (s *busyRetryStore) RemoveUserFromAllRoles(ctx context.Context, actor models.Actor, user string) (int, error) {
+	var removed int
+	err := retryBusy(ctx, func() (err error) {
+		removed, err = s.Store.RemoveUserFromAllRoles(ctx, actor, user)
+		return err
+	})
+	return removed, err
+}
+
+func (s *busyRetryStore) NextOncall(ctx context.Context, role string) (string, error) {
+	var user string
+	err := retryBusy(ctx, func() (err error) {
+		user, err = s.Store.NextOncall(ctx, role)
+		return err
+	})
+	return user, err
+}
+
+func (s *busyRetryStore) MuteRole(ctx context.Context, role, user string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.MuteRole(ctx, role, user)
+	})
+}
+
+func (s *busyRetryStore) UnmuteRole(ctx context.Context, role, user string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.UnmuteRole(ctx, role, user)
+	})
+}
+
+func (s *busyRetryStore) SetDND(ctx context.Context, user string, dnd *models.DND) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetDND(ctx, user, dnd)
+	})
+}
+
+func (s *busyRetryStore) SetPingTemplate(ctx context.Context, actor models.Actor, template string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetPingTemplate(ctx, actor, template)
+	})
+}
+
+func (s *busyRetryStore) SetCommandAlias(ctx context.Context, actor models.Actor, alias, command string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetCommandAlias(ctx, actor, alias, command)
+	})
+}
+
+func (s *busyRetryStore) RemoveCommandAlias(ctx context.Context, alias string) (bool, error) {
+	var removed bool
+	err := retryBusy(ctx, func() (err error) {
+		removed, err = s.Store.RemoveCommandAlias(ctx, alias)
+		return err
+	})
+	return removed, err
+}
+
+func (s *busyRetryStore) AddAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	var added bool
+	err := retryBusy(ctx, func() (err error) {
+		added, err = s.Store.AddAdmin(ctx, actor, user)
+		return err
+	})
+	return added, err
+}
+
+func (s *busyRetryStore) RemoveAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	var removed bool
+	err := retryBusy(ctx, func() (err error) {
+		removed, err = s.Store.RemoveAdmin(ctx, actor, user)
+		return err
+	})
+	return removed, err
+}
+
+func (s *busyRetryStore) SetRoleCategory(ctx context.Context, actor models.Actor, role, category string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetRoleCategory(ctx, actor, role, category)
+	})
+}
+
+func (s *busyRetryStore) SetRoleArchived(ctx context.Context, actor models.Actor, role string, archived bool) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetRoleArchived(ctx, actor, role, archived)
+	})
+}
+
+func (s *busyRetryStore) SetRoleOwner(ctx context.Context, actor models.Actor, role, owner string) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetRoleOwner(ctx, actor, role, owner)
+	})
+}
+
+func (s *busyRetryStore) PruneOrphanUsers(ctx context.Context) (int, error) {
+	var removed int
+	err := retryBusy(ctx, func() (err error) {
+		removed, err = s.Store.PruneOrphanUsers(ctx)
+		return err
+	})
+	return removed, err
+}
+
+func (s *busyRetryStore) NormalizeRoleNames(ctx context.Context, actor models.Actor) (renamed, merged int, err error) {
+	err = retryBusy(ctx, func() (err error) {
+		renamed, merged, err = s.Store.NormalizeRoleNames(ctx, actor)
+		return err
+	})
+	return renamed, merged, err
+}
+
+func (s *busyRetryStore) CreateScheduledPing(ctx context.Context, actor models.Actor, ping models.ScheduledPing) (int64, error) {
+	var id int64
+	err := retryBusy(ctx, func() (err error) {
+		id, err = s.Store.CreateScheduledPing(ctx, actor, ping)
+		return err
+	})
+	return id, err
+}
+
+func (s *busyRetryStore) DeleteScheduledPing(ctx context.Context, actor models.Actor, id int64) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.DeleteScheduledPing(ctx, actor, id)
+	})
+}
+
+func (s *busyRetryStore) SetChatDeparted(ctx context.Context, chatID int64, departed bool, at time.Time) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetChatDeparted(ctx, chatID, departed, at)
+	})
+}
+
+func (s *busyRetryStore) DeleteChatData(ctx context.Context, chatID int64) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.DeleteChatData(ctx, chatID)
+	})
+}
+
+func (s *busyRetryStore) SetLastUpdateID(ctx context.Context, shard, id int) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetLastUpdateID(ctx, shard, id)
+	})
+}
+
+func (s *busyRetryStore) SaveRateEvents(ctx context.Context, events []models.RateEvent, pruneBefore time.Time) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SaveRateEvents(ctx, events, pruneBefore)
+	})
+}
+
+func (s *busyRetryStore) LogCommand(ctx context.Context, command string, chatID int64, at time.Time) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.LogCommand(ctx, command, chatID, at)
+	})
+}
+
+func (s *busyRetryStore) SetLastSeen(ctx context.Context, user string, at time.Time) error {
+	return retryBusy(ctx, func() error {
+		return s.Store.SetLastSeen(ctx, user, at)
+	})
+}
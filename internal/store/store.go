@@ -2,9 +2,12 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"didactic-spork/internal/models"
 	"didactic-spork/pkg/utils"
@@ -12,32 +15,167 @@ import (
 
 // Store defines the interface for data storage operations
 type Store interface {
-	CreateRole(role string) error
-	RemoveRole(role string) error
-	AddUserToRole(role, user string) error
-	RemoveUserFromRole(role, user string) error
-	GetUsersInRole(role string) ([]string, error)
-	GetAllRoles() ([]string, error)
+	CreateRole(ctx context.Context, actor models.Actor, role string) error
+	RemoveRole(ctx context.Context, actor models.Actor, role string) error
+	AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error)
+	AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, role, user string, expiresAt time.Time) (bool, error)
+	RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error)
+	RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error
+	UpsertUser(ctx context.Context, user models.User) error
+	GetUsers(ctx context.Context, names []string) ([]models.User, error)
+	RemoveUserFromAllRoles(ctx context.Context, actor models.Actor, user string) (int, error)
+	GetUsersInRole(ctx context.Context, role string) ([]string, error)
+	NextOncall(ctx context.Context, role string) (string, error)
+	MuteRole(ctx context.Context, role, user string) error
+	UnmuteRole(ctx context.Context, role, user string) error
+	GetMutedUsersInRole(ctx context.Context, role string) ([]string, error)
+	SetDND(ctx context.Context, user string, dnd *models.DND) error
+	GetDND(ctx context.Context, users []string) (map[string]models.DND, error)
+	SetPingTemplate(ctx context.Context, actor models.Actor, template string) error
+	GetPingTemplate(ctx context.Context, chatID int64) (string, error)
+	SetCommandAlias(ctx context.Context, actor models.Actor, alias, command string) error
+	RemoveCommandAlias(ctx context.Context, alias string) (bool, error)
+	GetCommandAliases(ctx context.Context) (map[string]string, error)
+	AddAdmin(ctx context.Context, actor models.Actor, user string) (bool, error)
+	RemoveAdmin(ctx context.Context, actor models.Actor, user string) (bool, error)
+	ListAdmins(ctx context.Context) ([]string, error)
+	GetAllRoles(ctx context.Context, includeArchived bool) ([]string, error)
+	GetRolesMatching(ctx context.Context, pattern string) ([]string, error)
+	SetRoleCategory(ctx context.Context, actor models.Actor, role, category string) error
+	GetRolesByCategory(ctx context.Context) (map[string][]string, error)
+	SetRoleArchived(ctx context.Context, actor models.Actor, role string, archived bool) error
+	SetRoleOwner(ctx context.Context, actor models.Actor, role, owner string) error
+	IsRoleOwner(ctx context.Context, role, user string) (bool, error)
+	IsRoleArchived(ctx context.Context, role string) (bool, error)
+	GetRolesForUser(ctx context.Context, user string) ([]string, error)
+	GetAllUsersInChat(ctx context.Context) ([]string, error)
+	GetAllUsers(ctx context.Context) ([]models.KnownUser, error)
+	PruneOrphanUsers(ctx context.Context) (int, error)
+	NormalizeRoleNames(ctx context.Context, actor models.Actor) (renamed, merged int, err error)
+	GetAuditLog(ctx context.Context, role string, limit int) ([]models.AuditEntry, error)
+	CreateScheduledPing(ctx context.Context, actor models.Actor, ping models.ScheduledPing) (int64, error)
+	DeleteScheduledPing(ctx context.Context, actor models.Actor, id int64) error
+	GetScheduledPings(ctx context.Context) ([]models.ScheduledPing, error)
+	GetScheduledPingsForChat(ctx context.Context, chatID int64) ([]models.ScheduledPing, error)
+	SetChatDeparted(ctx context.Context, chatID int64, departed bool, at time.Time) error
+	GetChatsDepartedBefore(ctx context.Context, before time.Time) ([]int64, error)
+	DeleteChatData(ctx context.Context, chatID int64) error
+	GetRateEvents(ctx context.Context, since time.Time) ([]models.RateEvent, error)
+	GetLastUpdateID(ctx context.Context, shard int) (int, error)
+	SetLastUpdateID(ctx context.Context, shard, id int) error
+	SaveRateEvents(ctx context.Context, events []models.RateEvent, pruneBefore time.Time) error
+	LogCommand(ctx context.Context, command string, chatID int64, at time.Time) error
+	GetUsageStats(ctx context.Context, since time.Time) ([]models.CommandCount, error)
+	SetLastSeen(ctx context.Context, user string, at time.Time) error
+	GetInactiveMemberships(ctx context.Context, seenAfter, seenBefore time.Time) ([]models.Membership, error)
 }
 
+// activeMembership is a query condition on role_users, aliased ru, that
+// leaves out expired memberships. It takes the current time in Unix
+// milliseconds as its argument.
+const activeMembership = "(ru.expires_at IS NULL OR ru.expires_at > ?)"
+
 // SQLStore implements Store interface using SQL database
 type SQLStore struct {
 	db *sql.DB
+	// read serves the lookups done for every ping; it is db unless a
+	// read-only copy was configured
+	read *sql.DB
+	// readMembers serves GetUsersInRole: read, or db when the members are
+	// cached
+	readMembers *sql.DB
+	opts        Options
+}
+
+// Options holds the limits enforced by the store
+type Options struct {
+	// MaxRoles caps the number of roles; zero means unlimited
+	MaxRoles int
+	// ReservedNames are role names that can't be created
+	ReservedNames []string
+	// BannedWords are lowercase substrings role names may not contain
+	BannedWords []string
+	// NamePattern is a regular expression new role names must match in
+	// full, ignoring case; empty allows any name
+	NamePattern string
+	// RejectBots refuses to add users whose username looks like a bot's
+	RejectBots bool
+	// MembersCacheTTL is how long GetUsersInRole results are cached, for up
+	// to MembersCacheSize roles; zero for either disables the cache
+	MembersCacheTTL  time.Duration
+	MembersCacheSize int
+	// ReadDB is a read-only copy of db that GetAllRoles reads from, and
+	// GetUsersInRole too unless members are cached; nil reads from db
+	ReadDB *sql.DB
 }
 
-// New creates a new store instance
-func New(db *sql.DB) Store {
-	return &SQLStore{db: db}
+// New creates a new store instance. Writes are retried when the database is
+// busy, and calls fail fast while the database keeps failing. Role members
+// are cached in front of all that, so cached pings still work while the
+// database is unavailable.
+func New(db *sql.DB, opts Options) Store {
+	read := opts.ReadDB
+	if read == nil {
+		read = db
+	}
+	// Cached members are read from db: a copy lagging behind a write would
+	// put the members from before it back in the cache right after the
+	// write dropped them, for a whole TTL
+	cached := opts.MembersCacheTTL > 0 && opts.MembersCacheSize > 0
+	readMembers := read
+	if cached {
+		readMembers = db
+	}
+
+	var store Store = &breakerStore{Store: &busyRetryStore{Store: &SQLStore{db: db, read: read, readMembers: readMembers, opts: opts}}}
+	if cached {
+		store = newMembersCacheStore(store, opts.MembersCacheTTL, opts.MembersCacheSize)
+	}
+	return store
 }
 
 // CreateRole creates a new role
-func (s *SQLStore) CreateRole(role string) error {
+func (s *SQLStore) CreateRole(ctx context.Context, actor models.Actor, role string) error {
 	role = utils.SanitizeRoleName(role)
 	if role == "" {
 		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
 	}
+	if utils.Contains(s.opts.ReservedNames, role) {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "is reserved"}
+	}
+	if _, banned := utils.FindBanned(role, s.opts.BannedWords); banned {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "contains a banned word"}
+	}
+	if pattern := s.opts.NamePattern; pattern != "" {
+		// Anchored, so "team-.+" doesn't also allow "myteam-x"; names are
+		// lowercased by now, so "Team-[A-Z]+" must ignore case to match
+		convention, err := regexp.Compile("(?i)^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid role name pattern: %w", err)
+		}
+		if !convention.MatchString(role) {
+			return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "must match the naming convention " + pattern}
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Roles aren't scoped to a chat yet, so the cap applies to all of them
+	if s.opts.MaxRoles > 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM roles").Scan(&count); err != nil {
+			return fmt.Errorf("failed to count roles: %w", err)
+		}
+		if count >= s.opts.MaxRoles {
+			return models.ErrTooManyRoles{Limit: s.opts.MaxRoles}
+		}
+	}
 
-	_, err := s.db.Exec("INSERT INTO roles (name) VALUES (?)", role)
+	_, err = tx.ExecContext(ctx, "INSERT INTO roles (name, created_by) VALUES (?, ?)", role, utils.SanitizeUsername(actor.Username))
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
 			return models.ErrRoleAlreadyExists{Role: role}
@@ -45,17 +183,39 @@ func (s *SQLStore) CreateRole(role string) error {
 		return fmt.Errorf("failed to create role: %w", err)
 	}
 
-	return nil
+	if err := recordAudit(ctx, tx, actor, models.AuditCreateRole, role, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // RemoveRole removes a role
-func (s *SQLStore) RemoveRole(role string) error {
+func (s *SQLStore) RemoveRole(ctx context.Context, actor models.Actor, role string) error {
 	role = utils.SanitizeRoleName(role)
 	if role == "" {
 		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
 	}
 
-	result, err := s.db.Exec("DELETE FROM roles WHERE name = ?", role)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Delete memberships explicitly rather than relying on ON DELETE CASCADE,
+	// which only works on connections where foreign keys are enabled
+	_, err = tx.ExecContext(ctx, "DELETE FROM role_users WHERE role_id IN (SELECT id FROM roles WHERE name = ?)", role)
+	if err != nil {
+		return fmt.Errorf("failed to remove role members: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM muted_roles WHERE role_id IN (SELECT id FROM roles WHERE name = ?)", role)
+	if err != nil {
+		return fmt.Errorf("failed to remove muted roles: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE name = ?", role)
 	if err != nil {
 		return fmt.Errorf("failed to remove role: %w", err)
 	}
@@ -65,60 +225,111 @@ func (s *SQLStore) RemoveRole(role string) error {
 		return models.ErrRoleNotFound{Role: role}
 	}
 
-	return nil
+	// Scheduled pings reference roles by name, so they aren't cascaded
+	_, err = tx.ExecContext(ctx, "DELETE FROM scheduled_pings WHERE role = ?", role)
+	if err != nil {
+		return fmt.Errorf("failed to remove scheduled pings: %w", err)
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditRemoveRole, role, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddUserToRole adds a user to a role. It reports whether the user was added,
+// which is false when the user was already a member.
+func (s *SQLStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	return s.AddUserToRoleWithExpiry(ctx, actor, role, user, time.Time{})
 }
 
-// AddUserToRole adds a user to a role
-func (s *SQLStore) AddUserToRole(role, user string) error {
+// AddUserToRoleWithExpiry adds a user to a role until expiresAt, after which
+// the membership no longer counts and is removed by RemoveExpiredMemberships.
+// A zero expiresAt adds the user for good. It reports whether the user was
+// added, which is false when the user was already a member.
+func (s *SQLStore) AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, role, user string, expiresAt time.Time) (bool, error) {
 	role = utils.SanitizeRoleName(role)
 	user = utils.SanitizeUsername(user)
 
 	if role == "" {
-		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+		return false, models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
 	}
 	if user == "" {
-		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+	if s.opts.RejectBots && utils.LooksLikeBot(user) {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "belongs to a bot"}
 	}
 
 	// Start transaction
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return false, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	// Ensure user exists
-	_, err = tx.Exec("INSERT OR IGNORE INTO users (name) VALUES (?)", user)
+	_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO users (name) VALUES (?)", user)
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return false, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	// Check if role exists
 	var roleExists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = ?)", role).Scan(&roleExists)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = ?)", role).Scan(&roleExists)
 	if err != nil {
-		return fmt.Errorf("failed to check role existence: %w", err)
+		return false, fmt.Errorf("failed to check role existence: %w", err)
 	}
 	if !roleExists {
-		return models.ErrRoleNotFound{Role: role}
+		return false, models.ErrRoleNotFound{Role: role}
+	}
+
+	// A membership that expired but hasn't been swept yet doesn't count
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM role_users
+		WHERE role_id = (SELECT id FROM roles WHERE name = ?)
+		AND user_id = (SELECT id FROM users WHERE name = ?)
+		AND expires_at <= ?
+	`, role, user, time.Now().UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to remove expired membership: %w", err)
+	}
+
+	var expires interface{}
+	if !expiresAt.IsZero() {
+		expires = expiresAt.UnixMilli()
 	}
 
 	// Add user to role
-	_, err = tx.Exec(`
-		INSERT OR IGNORE INTO role_users (role_id, user_id)
-		SELECT r.id, u.id
+	result, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO role_users (role_id, user_id, chat_id, expires_at)
+		SELECT r.id, u.id, ?, ?
 		FROM roles r, users u
 		WHERE r.name = ? AND u.name = ?
-	`, role, user)
+	`, actor.ChatID, expires, role, user)
 	if err != nil {
-		return fmt.Errorf("failed to add user to role: %w", err)
+		return false, fmt.Errorf("failed to add user to role: %w", err)
 	}
 
-	return tx.Commit()
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditAddToRole, role, user); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
 }
 
 // RemoveUserFromRole removes a user from a role
-func (s *SQLStore) RemoveUserFromRole(role, user string) error {
+func (s *SQLStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, role, user string) error {
 	role = utils.SanitizeRoleName(role)
 	user = utils.SanitizeUsername(user)
 
@@ -129,7 +340,13 @@ func (s *SQLStore) RemoveUserFromRole(role, user string) error {
 		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
 	}
 
-	result, err := s.db.Exec(`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		DELETE FROM role_users
 		WHERE role_id = (SELECT id FROM roles WHERE name = ?)
 		AND user_id = (SELECT id FROM users WHERE name = ?)
@@ -143,24 +360,235 @@ func (s *SQLStore) RemoveUserFromRole(role, user string) error {
 		return models.ErrUserNotFound{User: user, Role: role}
 	}
 
-	return nil
+	// A user who rejoins the role later starts out unmuted
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM muted_roles
+		WHERE role_id = (SELECT id FROM roles WHERE name = ?)
+		AND user_id = (SELECT id FROM users WHERE name = ?)
+	`, role, user)
+	if err != nil {
+		return fmt.Errorf("failed to unmute user: %w", err)
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditRemoveFromRole, role, user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveExpiredMemberships removes the role memberships that expired by now
+// and returns them. The removals are recorded in the audit log as made by
+// actor in the chat each user was added in.
+func (s *SQLStore) RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT r.name, u.name, ru.chat_id, ru.expires_at
+		FROM role_users ru
+		JOIN roles r ON r.id = ru.role_id
+		JOIN users u ON u.id = ru.user_id
+		WHERE ru.expires_at <= ?
+	`, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired memberships: %w", err)
+	}
+
+	var expired []models.Membership
+	for rows.Next() {
+		var membership models.Membership
+		var expiresAt int64
+		if err := rows.Scan(&membership.Role, &membership.User, &membership.ChatID, &expiresAt); err != nil {
+			continue // Skip invalid entries
+		}
+		membership.ExpiresAt = time.UnixMilli(expiresAt)
+		expired = append(expired, membership)
+	}
+	rows.Close()
+
+	for _, membership := range expired {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM role_users
+			WHERE role_id = (SELECT id FROM roles WHERE name = ?)
+			AND user_id = (SELECT id FROM users WHERE name = ?)
+		`, membership.Role, membership.User)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove expired membership: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM muted_roles
+			WHERE role_id = (SELECT id FROM roles WHERE name = ?)
+			AND user_id = (SELECT id FROM users WHERE name = ?)
+		`, membership.Role, membership.User)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmute user: %w", err)
+		}
+
+		auditActor := models.Actor{Username: actor, ChatID: membership.ChatID}
+		if err := recordAudit(ctx, tx, auditActor, models.AuditRemoveFromRole, membership.Role, membership.User); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return expired, nil
+}
+
+// UpsertUser records a user together with their Telegram ID. If the ID was
+// previously linked to another username (the user renamed themselves), that
+// link is cleared.
+func (s *SQLStore) UpsertUser(ctx context.Context, user models.User) error {
+	user.Name = utils.SanitizeUsername(user.Name)
+	if user.Name == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user.Name, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET telegram_id = NULL WHERE telegram_id = ? AND name != ?", user.TelegramID, user.Name)
+	if err != nil {
+		return fmt.Errorf("failed to unlink telegram id: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (name, telegram_id, first_name, last_name) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			telegram_id = excluded.telegram_id,
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			updated_at = CURRENT_TIMESTAMP
+	`, user.Name, user.TelegramID, user.FirstName, user.LastName)
+	if err != nil {
+		return fmt.Errorf("failed to upsert user: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetUsers returns the known details of the given users. Unknown users are
+// left out.
+func (s *SQLStore) GetUsers(ctx context.Context, names []string) ([]models.User, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = utils.SanitizeUsername(name)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, COALESCE(telegram_id, 0), first_name, last_name
+		FROM users
+		WHERE name IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.Name, &user.TelegramID, &user.FirstName, &user.LastName); err != nil {
+			continue // Skip invalid entries
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// RemoveUserFromAllRoles removes a user from every role they belong to and
+// returns the number of memberships removed
+func (s *SQLStore) RemoveUserFromAllRoles(ctx context.Context, actor models.Actor, user string) (int, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return 0, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT r.name
+		FROM roles r
+		JOIN role_users ru ON r.id = ru.role_id
+		JOIN users u ON u.id = ru.user_id
+		WHERE u.name = ?
+	`, user)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get roles for user: %w", err)
+	}
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			continue // Skip invalid entries
+		}
+		roles = append(roles, role)
+	}
+	rows.Close()
+
+	if len(roles) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM role_users WHERE user_id = (SELECT id FROM users WHERE name = ?)", user)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove user from roles: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM muted_roles WHERE user_id = (SELECT id FROM users WHERE name = ?)", user)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove muted roles: %w", err)
+	}
+
+	for _, role := range roles {
+		if err := recordAudit(ctx, tx, actor, models.AuditRemoveFromRole, role, user); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(roles), nil
 }
 
 // GetUsersInRole returns the users in a role
-func (s *SQLStore) GetUsersInRole(role string) ([]string, error) {
+func (s *SQLStore) GetUsersInRole(ctx context.Context, role string) ([]string, error) {
 	role = utils.SanitizeRoleName(role)
 	if role == "" {
 		return nil, models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
 	}
 
-	rows, err := s.db.Query(`
+	rows, err := s.readMembers.QueryContext(ctx, `
 		SELECT u.name
 		FROM users u
 		JOIN role_users ru ON u.id = ru.user_id
 		JOIN roles r ON r.id = ru.role_id
-		WHERE r.name = ?
+		WHERE r.name = ? AND `+activeMembership+`
 		ORDER BY u.name
-	`, role)
+	`, role, time.Now().UnixMilli())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users in role: %w", err)
 	}
@@ -178,22 +606,1239 @@ func (s *SQLStore) GetUsersInRole(role string) ([]string, error) {
 	return users, nil
 }
 
-// GetAllRoles returns all roles
-func (s *SQLStore) GetAllRoles() ([]string, error) {
-	rows, err := s.db.Query("SELECT name FROM roles ORDER BY name")
+// NextOncall returns the next member of a role's on-call rotation and advances
+// the rotation. Members take turns in name order. An empty string is returned
+// when the role has no members.
+func (s *SQLStore) NextOncall(ctx context.Context, role string) (string, error) {
+	role = utils.SanitizeRoleName(role)
+	if role == "" {
+		return "", models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all roles: %w", err)
+		return "", fmt.Errorf("failed to start transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var roles []string
+	var roleID, index int64
+	err = tx.QueryRowContext(ctx, "SELECT id, oncall_index FROM roles WHERE name = ?", role).Scan(&roleID, &index)
+	if err == sql.ErrNoRows {
+		return "", models.ErrRoleNotFound{Role: role}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.name
+		FROM users u
+		JOIN role_users ru ON u.id = ru.user_id
+		WHERE ru.role_id = ? AND `+activeMembership+`
+		ORDER BY u.name
+	`, roleID, time.Now().UnixMilli())
+	if err != nil {
+		return "", fmt.Errorf("failed to get users in role: %w", err)
+	}
+	var members []string
 	for rows.Next() {
-		var role string
-		if err := rows.Scan(&role); err != nil {
+		var user string
+		if err := rows.Scan(&user); err != nil {
 			continue // Skip invalid entries
 		}
-		roles = append(roles, role)
+		members = append(members, user)
 	}
+	rows.Close()
 
-	return roles, nil
+	if len(members) == 0 {
+		return "", nil
+	}
+
+	// Members may have left since the last turn, so wrap the stored index
+	next := members[index%int64(len(members))]
+	_, err = tx.ExecContext(ctx, "UPDATE roles SET oncall_index = ? WHERE id = ?", (index+1)%int64(len(members)), roleID)
+	if err != nil {
+		return "", fmt.Errorf("failed to advance on-call rotation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return next, nil
+}
+
+// MuteRole stops a member of a role from being mentioned when it is pinged
+func (s *SQLStore) MuteRole(ctx context.Context, role, user string) error {
+	role = utils.SanitizeRoleName(role)
+	user = utils.SanitizeUsername(user)
+
+	if role == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var isMember bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM role_users ru
+			JOIN roles r ON r.id = ru.role_id
+			JOIN users u ON u.id = ru.user_id
+			WHERE r.name = ? AND u.name = ?
+		)
+	`, role, user).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check role membership: %w", err)
+	}
+	if !isMember {
+		return models.ErrUserNotFound{User: user, Role: role}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO muted_roles (role_id, user_id)
+		SELECT r.id, u.id
+		FROM roles r, users u
+		WHERE r.name = ? AND u.name = ?
+	`, role, user)
+	if err != nil {
+		return fmt.Errorf("failed to mute role: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UnmuteRole makes a muted member of a role mentionable again. Unmuting a role
+// that isn't muted is a no-op.
+func (s *SQLStore) UnmuteRole(ctx context.Context, role, user string) error {
+	role = utils.SanitizeRoleName(role)
+	user = utils.SanitizeUsername(user)
+
+	if role == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM muted_roles
+		WHERE role_id = (SELECT id FROM roles WHERE name = ?)
+		AND user_id = (SELECT id FROM users WHERE name = ?)
+	`, role, user)
+	if err != nil {
+		return fmt.Errorf("failed to unmute role: %w", err)
+	}
+
+	return nil
+}
+
+// SetDND sets a user's do-not-disturb window, or clears it if dnd is nil.
+// Users who aren't known yet are added.
+func (s *SQLStore) SetDND(ctx context.Context, user string, dnd *models.DND) error {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	var start, end sql.NullInt64
+	var timezone string
+	if dnd != nil {
+		start = sql.NullInt64{Int64: int64(dnd.Start), Valid: true}
+		end = sql.NullInt64{Int64: int64(dnd.End), Valid: true}
+		timezone = dnd.Timezone
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (name, dnd_start, dnd_end, dnd_timezone) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			dnd_start = excluded.dnd_start,
+			dnd_end = excluded.dnd_end,
+			dnd_timezone = excluded.dnd_timezone,
+			updated_at = CURRENT_TIMESTAMP
+	`, user, start, end, timezone)
+	if err != nil {
+		return fmt.Errorf("failed to set do not disturb: %w", err)
+	}
+
+	return nil
+}
+
+// GetDND returns the do-not-disturb windows of the given users. Users without
+// a window are left out.
+func (s *SQLStore) GetDND(ctx context.Context, users []string) (map[string]models.DND, error) {
+	windows := make(map[string]models.DND)
+	if len(users) == 0 {
+		return windows, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(users)), ",")
+	args := make([]interface{}, len(users))
+	for i, user := range users {
+		args[i] = utils.SanitizeUsername(user)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, dnd_start, dnd_end, dnd_timezone
+		FROM users
+		WHERE dnd_start IS NOT NULL AND name IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get do not disturb windows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var dnd models.DND
+		if err := rows.Scan(&name, &dnd.Start, &dnd.End, &dnd.Timezone); err != nil {
+			continue // Skip invalid entries
+		}
+		windows[name] = dnd
+	}
+
+	return windows, nil
+}
+
+// SetPingTemplate sets the template of pings in the actor's chat, or clears
+// it if template is empty
+func (s *SQLStore) SetPingTemplate(ctx context.Context, actor models.Actor, template string) error {
+	template = utils.SanitizeMessage(template)
+	if template == "" {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM ping_templates WHERE chat_id = ?", actor.ChatID); err != nil {
+			return fmt.Errorf("failed to clear ping template: %w", err)
+		}
+		return nil
+	}
+	if err := models.ValidatePingTemplate(template); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ping_templates (chat_id, template, updated_by) VALUES (?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			template = excluded.template,
+			updated_by = excluded.updated_by,
+			updated_at = CURRENT_TIMESTAMP
+	`, actor.ChatID, template, utils.SanitizeUsername(actor.Username))
+	if err != nil {
+		return fmt.Errorf("failed to set ping template: %w", err)
+	}
+
+	return nil
+}
+
+// GetPingTemplate returns the template of pings in a chat, or "" if the chat
+// uses the default
+func (s *SQLStore) GetPingTemplate(ctx context.Context, chatID int64) (string, error) {
+	var template string
+	err := s.db.QueryRowContext(ctx, "SELECT template FROM ping_templates WHERE chat_id = ?", chatID).Scan(&template)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get ping template: %w", err)
+	}
+	return template, nil
+}
+
+// SetCommandAlias makes alias run command, replacing what the alias ran before
+func (s *SQLStore) SetCommandAlias(ctx context.Context, actor models.Actor, alias, command string) error {
+	alias = normalizeCommandName(alias)
+	command = normalizeCommandName(command)
+	if err := models.ValidateCommandAlias(alias, command); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO command_aliases (alias, command, created_by) VALUES (?, ?, ?)
+		ON CONFLICT(alias) DO UPDATE SET
+			command = excluded.command,
+			created_by = excluded.created_by,
+			created_at = CURRENT_TIMESTAMP
+	`, alias, command, utils.SanitizeUsername(actor.Username))
+	if err != nil {
+		return fmt.Errorf("failed to set command alias: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveCommandAlias removes an alias. It reports false if there was no such alias.
+func (s *SQLStore) RemoveCommandAlias(ctx context.Context, alias string) (bool, error) {
+	alias = normalizeCommandName(alias)
+	if alias == "" {
+		return false, models.ErrInvalidInput{Field: "alias", Value: alias, Reason: "cannot be empty"}
+	}
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM command_aliases WHERE alias = ?", alias)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove command alias: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove command alias: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetCommandAliases returns every alias with the command it runs
+func (s *SQLStore) GetCommandAliases(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT alias, command FROM command_aliases")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var alias, command string
+		if err := rows.Scan(&alias, &command); err != nil {
+			continue // Skip invalid entries
+		}
+		aliases[alias] = command
+	}
+
+	return aliases, rows.Err()
+}
+
+// normalizeCommandName lowercases a command name and drops its leading slash
+func normalizeCommandName(name string) string {
+	return strings.TrimPrefix(strings.ToLower(utils.SanitizeInput(name)), "/")
+}
+
+// AddAdmin makes a user an admin. It reports false if the user already was one.
+func (s *SQLStore) AddAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO admins (username, added_by) VALUES (?, ?)", user, utils.SanitizeUsername(actor.Username))
+	if err != nil {
+		return false, fmt.Errorf("failed to add admin: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditPromoteAdmin, "", user); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// RemoveAdmin takes away a user's admin rights. It reports false if the user
+// wasn't an admin.
+func (s *SQLStore) RemoveAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM admins WHERE username = ?", user)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove admin: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditDemoteAdmin, "", user); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// ListAdmins returns the users made admins with AddAdmin, in name order. The
+// admin from the configuration isn't stored and isn't included.
+func (s *SQLStore) ListAdmins(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT username FROM admins ORDER BY username COLLATE NOCASE")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admins: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []string
+	for rows.Next() {
+		var admin string
+		if err := rows.Scan(&admin); err != nil {
+			continue // Skip invalid entries
+		}
+		admins = append(admins, admin)
+	}
+
+	return admins, rows.Err()
+}
+
+// GetMutedUsersInRole returns the members of a role who have muted it
+func (s *SQLStore) GetMutedUsersInRole(ctx context.Context, role string) ([]string, error) {
+	role = utils.SanitizeRoleName(role)
+	if role == "" {
+		return nil, models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.name
+		FROM users u
+		JOIN muted_roles m ON u.id = m.user_id
+		JOIN roles r ON r.id = m.role_id
+		WHERE r.name = ?
+		ORDER BY u.name
+	`, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get muted users in role: %w", err)
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			continue // Skip invalid entries
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// GetAllRoles returns all roles, leaving out archived ones unless includeArchived is set
+func (s *SQLStore) GetAllRoles(ctx context.Context, includeArchived bool) ([]string, error) {
+	rows, err := s.read.QueryContext(ctx, "SELECT name FROM roles WHERE archived = 0 OR ? ORDER BY name", includeArchived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			continue // Skip invalid entries
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// GetRolesMatching returns the active roles whose names start with the given prefix.
+// A '*' in the pattern matches any run of characters and disables the
+// implicit prefix match, so "*-team" finds roles ending in "-team".
+func (s *SQLStore) GetRolesMatching(ctx context.Context, pattern string) ([]string, error) {
+	pattern = utils.SanitizeRoleName(pattern)
+	if pattern == "" {
+		return nil, models.ErrInvalidInput{Field: "pattern", Value: pattern, Reason: "cannot be empty"}
+	}
+
+	like := strings.ReplaceAll(utils.EscapeLike(pattern), "*", "%")
+	if !strings.Contains(pattern, "*") {
+		like += "%"
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM roles WHERE name LIKE ? ESCAPE '\' AND archived = 0 ORDER BY name`, like)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matching roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			continue // Skip invalid entries
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// SetRoleCategory assigns a role to a category. An empty category removes
+// the role from its category.
+func (s *SQLStore) SetRoleCategory(ctx context.Context, actor models.Actor, role, category string) error {
+	role = utils.SanitizeRoleName(role)
+	category = utils.SanitizeRoleName(category)
+	if role == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE roles SET category = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE name = ?
+	`, category, role)
+	if err != nil {
+		return fmt.Errorf("failed to set role category: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return models.ErrRoleNotFound{Role: role}
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditSetCategory, role, category); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRoleArchived archives or restores a role. Archived roles keep their
+// members but are hidden from listings and can't be pinged.
+func (s *SQLStore) SetRoleArchived(ctx context.Context, actor models.Actor, role string, archived bool) error {
+	role = utils.SanitizeRoleName(role)
+	if role == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE roles SET archived = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE name = ?
+	`, archived, role)
+	if err != nil {
+		return fmt.Errorf("failed to archive role: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return models.ErrRoleNotFound{Role: role}
+	}
+
+	action := models.AuditRestoreRole
+	if archived {
+		action = models.AuditArchiveRole
+	}
+	if err := recordAudit(ctx, tx, actor, action, role, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRoleOwner transfers ownership of a role to another user, who must already
+// be known to the bot
+func (s *SQLStore) SetRoleOwner(ctx context.Context, actor models.Actor, role, owner string) error {
+	role = utils.SanitizeRoleName(role)
+	owner = utils.SanitizeUsername(owner)
+
+	if role == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+	if owner == "" {
+		return models.ErrInvalidInput{Field: "username", Value: owner, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var known bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE name = ?)", owner).Scan(&known)
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !known {
+		return models.ErrUnknownUser{User: owner}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE roles SET created_by = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE name = ?
+	`, owner, role)
+	if err != nil {
+		return fmt.Errorf("failed to set role owner: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return models.ErrRoleNotFound{Role: role}
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditTransferRole, role, owner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsRoleOwner reports whether a user owns a role
+func (s *SQLStore) IsRoleOwner(ctx context.Context, role, user string) (bool, error) {
+	role = utils.SanitizeRoleName(role)
+	user = utils.SanitizeUsername(user)
+	if role == "" || user == "" {
+		return false, nil
+	}
+
+	var owner bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = ? AND created_by = ?)", role, user).Scan(&owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to check role owner: %w", err)
+	}
+	return owner, nil
+}
+
+// IsRoleArchived reports whether a role is archived. Unknown roles are not archived.
+func (s *SQLStore) IsRoleArchived(ctx context.Context, role string) (bool, error) {
+	var archived bool
+	err := s.db.QueryRowContext(ctx, "SELECT archived FROM roles WHERE name = ?", utils.SanitizeRoleName(role)).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check if role is archived: %w", err)
+	}
+	return archived, nil
+}
+
+// GetRolesByCategory returns all active roles grouped by category. Roles
+// without a category are grouped under models.UncategorizedCategory.
+func (s *SQLStore) GetRolesByCategory(ctx context.Context) (map[string][]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, COALESCE(category, '') FROM roles WHERE archived = 0 ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles by category: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[string][]string)
+	for rows.Next() {
+		var role, category string
+		if err := rows.Scan(&role, &category); err != nil {
+			continue // Skip invalid entries
+		}
+		if category == "" {
+			category = models.UncategorizedCategory
+		}
+		categories[category] = append(categories[category], role)
+	}
+
+	return categories, nil
+}
+
+// GetRolesForUser returns the roles a user belongs to
+func (s *SQLStore) GetRolesForUser(ctx context.Context, user string) ([]string, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return nil, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.name
+		FROM roles r
+		JOIN role_users ru ON r.id = ru.role_id
+		JOIN users u ON u.id = ru.user_id
+		WHERE u.name = ? AND `+activeMembership+`
+		ORDER BY r.name
+	`, user, time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles for user: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			continue // Skip invalid entries
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// GetAllUsersInChat returns every user who belongs to an active role. Roles
+// aren't scoped to chats yet, so this covers the members of all roles.
+func (s *SQLStore) GetAllUsersInChat(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT u.name
+		FROM users u
+		JOIN role_users ru ON u.id = ru.user_id
+		JOIN roles r ON r.id = ru.role_id
+		WHERE r.archived = 0 AND `+activeMembership+`
+		ORDER BY u.name
+	`, time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			continue // Skip invalid entries
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// GetAllUsers returns every user in the users table, sorted by name, with the
+// number of roles each belongs to. Users in no role are left over from
+// removed memberships.
+func (s *SQLStore) GetAllUsers(ctx context.Context) ([]models.KnownUser, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.name, COUNT(ru.role_id)
+		FROM users u
+		LEFT JOIN role_users ru ON u.id = ru.user_id
+		GROUP BY u.id
+		ORDER BY u.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.KnownUser
+	for rows.Next() {
+		var user models.KnownUser
+		if err := rows.Scan(&user.Name, &user.Roles); err != nil {
+			continue // Skip invalid entries
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// PruneOrphanUsers deletes users who are in no role and returns how many were
+// removed. Role owners are kept so their roles stay transferable. The audit log
+// stores usernames rather than user IDs, so its entries are unaffected.
+func (s *SQLStore) PruneOrphanUsers(ctx context.Context) (int, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM users
+		WHERE id NOT IN (SELECT user_id FROM role_users)
+		AND name NOT IN (SELECT created_by FROM roles)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune users: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+// NormalizeRoleNames lowercases role names left in mixed case by older
+// versions, which the lowercasing handlers can't match. A role whose
+// lowercase name is already taken is merged into that role: its members and
+// mutes are added to it and the role is removed. Roles differing only in
+// ASCII case are merged at startup, so this only happens for other scripts,
+// which the NOCASE index doesn't fold. Scheduled pings and audit entries
+// follow the new name. It returns how many roles were renamed and how many
+// were merged.
+func (s *SQLStore) NormalizeRoleNames(ctx context.Context, actor models.Actor) (renamed, merged int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	type role struct {
+		id   int64
+		name string
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM roles ORDER BY id")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get roles: %w", err)
+	}
+	var mixed []role
+	for rows.Next() {
+		var r role
+		if err := rows.Scan(&r.id, &r.name); err != nil {
+			continue // Skip invalid entries
+		}
+		if r.name != utils.SanitizeRoleName(r.name) {
+			mixed = append(mixed, r)
+		}
+	}
+	rows.Close()
+
+	for _, r := range mixed {
+		name := utils.SanitizeRoleName(r.name)
+
+		var target int64
+		err := tx.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ?", name).Scan(&target)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := tx.ExecContext(ctx, "UPDATE roles SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", name, r.id); err != nil {
+				return 0, 0, fmt.Errorf("failed to rename role: %w", err)
+			}
+			renamed++
+		case err != nil:
+			return 0, 0, fmt.Errorf("failed to get role: %w", err)
+		default:
+			// The old memberships and mutes are deleted explicitly, as in
+			// RemoveRole, rather than relying on ON DELETE CASCADE
+			for _, query := range []string{
+				`INSERT OR IGNORE INTO role_users (role_id, user_id, chat_id, expires_at, created_at)
+					SELECT ?2, user_id, chat_id, expires_at, created_at FROM role_users WHERE role_id = ?1`,
+				`DELETE FROM role_users WHERE role_id = ?1`,
+				`INSERT OR IGNORE INTO muted_roles (role_id, user_id, created_at)
+					SELECT ?2, user_id, created_at FROM muted_roles WHERE role_id = ?1`,
+				`DELETE FROM muted_roles WHERE role_id = ?1`,
+			} {
+				if _, err := tx.ExecContext(ctx, query, r.id, target); err != nil {
+					return 0, 0, fmt.Errorf("failed to merge role: %w", err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE id = ?", r.id); err != nil {
+				return 0, 0, fmt.Errorf("failed to remove merged role: %w", err)
+			}
+			merged++
+		}
+
+		for _, query := range []string{
+			"UPDATE scheduled_pings SET role = ? WHERE role = ?",
+			"UPDATE audit_log SET role = ? WHERE role = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, query, name, r.name); err != nil {
+				return 0, 0, fmt.Errorf("failed to rename role references: %w", err)
+			}
+		}
+		if err := recordAudit(ctx, tx, actor, models.AuditNormalizeRole, name, r.name); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return renamed, merged, nil
+}
+
+// GetAuditLog returns the most recent audit entries for a role, newest first
+func (s *SQLStore) GetAuditLog(ctx context.Context, role string, limit int) ([]models.AuditEntry, error) {
+	role = utils.SanitizeRoleName(role)
+	if role == "" {
+		return nil, models.ErrInvalidInput{Field: "role name", Value: role, Reason: "cannot be empty"}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT created_at, actor, action, role, target_user, chat_id
+		FROM audit_log
+		WHERE role = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, role, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.Timestamp, &entry.Actor, &entry.Action, &entry.Role, &entry.TargetUser, &entry.ChatID); err != nil {
+			continue // Skip invalid entries
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// CreateScheduledPing stores a recurring ping and returns its ID
+func (s *SQLStore) CreateScheduledPing(ctx context.Context, actor models.Actor, ping models.ScheduledPing) (int64, error) {
+	ping.Role = utils.SanitizeRoleName(ping.Role)
+	if ping.Role == "" {
+		return 0, models.ErrInvalidInput{Field: "role name", Value: ping.Role, Reason: "cannot be empty"}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var roleExists bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = ?)", ping.Role).Scan(&roleExists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check role existence: %w", err)
+	}
+	if !roleExists {
+		return 0, models.ErrRoleNotFound{Role: ping.Role}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO scheduled_pings (chat_id, role, cron_spec, message, created_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, ping.ChatID, ping.Role, ping.Spec, ping.Message, actor.Username)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create scheduled ping: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scheduled ping id: %w", err)
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditSchedulePing, ping.Role, ""); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return id, nil
+}
+
+// DeleteScheduledPing removes a recurring ping from the actor's chat
+func (s *SQLStore) DeleteScheduledPing(ctx context.Context, actor models.Actor, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM scheduled_pings WHERE id = ? AND chat_id = ?", id, actor.ChatID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return models.ErrScheduleNotFound{ID: id}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get scheduled ping: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM scheduled_pings WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove scheduled ping: %w", err)
+	}
+
+	if err := recordAudit(ctx, tx, actor, models.AuditUnschedulePing, role, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetScheduledPings returns all recurring pings across chats, leaving out
+// those of chats the bot was removed from
+func (s *SQLStore) GetScheduledPings(ctx context.Context) ([]models.ScheduledPing, error) {
+	return s.queryScheduledPings(ctx, `
+		SELECT id, chat_id, role, cron_spec, message, created_by
+		FROM scheduled_pings
+		WHERE chat_id NOT IN (SELECT chat_id FROM departed_chats)
+		ORDER BY id
+	`)
+}
+
+// GetScheduledPingsForChat returns the recurring pings of a chat
+func (s *SQLStore) GetScheduledPingsForChat(ctx context.Context, chatID int64) ([]models.ScheduledPing, error) {
+	return s.queryScheduledPings(ctx, `
+		SELECT id, chat_id, role, cron_spec, message, created_by
+		FROM scheduled_pings
+		WHERE chat_id = ?
+		ORDER BY id
+	`, chatID)
+}
+
+func (s *SQLStore) queryScheduledPings(ctx context.Context, query string, args ...interface{}) ([]models.ScheduledPing, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled pings: %w", err)
+	}
+	defer rows.Close()
+
+	var pings []models.ScheduledPing
+	for rows.Next() {
+		var ping models.ScheduledPing
+		if err := rows.Scan(&ping.ID, &ping.ChatID, &ping.Role, &ping.Spec, &ping.Message, &ping.CreatedBy); err != nil {
+			continue // Skip invalid entries
+		}
+		pings = append(pings, ping)
+	}
+
+	return pings, nil
+}
+
+// SetChatDeparted records that the bot was removed from a chat at the given
+// time, or that it was added back, which forgets the departure
+func (s *SQLStore) SetChatDeparted(ctx context.Context, chatID int64, departed bool, at time.Time) error {
+	if !departed {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM departed_chats WHERE chat_id = ?", chatID); err != nil {
+			return fmt.Errorf("failed to clear chat departure: %w", err)
+		}
+		return nil
+	}
+
+	// Keep the first departure time if the bot is removed again
+	_, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO departed_chats (chat_id, left_at) VALUES (?, ?)", chatID, at.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to record chat departure: %w", err)
+	}
+	return nil
+}
+
+// GetChatsDepartedBefore returns the chats the bot was removed from before
+// the given time
+func (s *SQLStore) GetChatsDepartedBefore(ctx context.Context, before time.Time) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT chat_id FROM departed_chats WHERE left_at < ? ORDER BY left_at", before.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get departed chats: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			continue // Skip invalid entries
+		}
+		chats = append(chats, chatID)
+	}
+
+	return chats, rows.Err()
+}
+
+// DeleteChatData deletes what is kept for a single chat: its scheduled pings,
+// its ping template, and its departure record. Roles are shared by all
+// chats and are kept.
+func (s *SQLStore) DeleteChatData(ctx context.Context, chatID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"scheduled_pings", "ping_templates", "departed_chats"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE chat_id = ?", chatID); err != nil {
+			return fmt.Errorf("failed to delete chat data from %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRateEvents returns the rate limit events that happened since the given time
+func (s *SQLStore) GetRateEvents(ctx context.Context, since time.Time) ([]models.RateEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT user_id, occurred_at FROM rate_events
+		WHERE occurred_at >= ?
+		ORDER BY occurred_at
+	`, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rate events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.RateEvent
+	for rows.Next() {
+		var event models.RateEvent
+		var occurredAt int64
+		if err := rows.Scan(&event.UserID, &occurredAt); err != nil {
+			continue // Skip invalid entries
+		}
+		event.At = time.UnixMilli(occurredAt)
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// SaveRateEvents stores a batch of rate limit events and deletes those older
+// than pruneBefore, in a single transaction
+func (s *SQLStore) SaveRateEvents(ctx context.Context, events []models.RateEvent, pruneBefore time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO rate_events (user_id, occurred_at) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare rate event insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if _, err := stmt.ExecContext(ctx, event.UserID, event.At.UnixMilli()); err != nil {
+			return fmt.Errorf("failed to save rate event: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM rate_events WHERE occurred_at < ?", pruneBefore.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to prune rate events: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// LogCommand records that a command was used, for GetUsageStats. Entries
+// older than models.CommandLogRetention are deleted along the way.
+func (s *SQLStore) LogCommand(ctx context.Context, command string, chatID int64, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO command_log (command, chat_id, used_at) VALUES (?, ?, ?)", command, chatID, at.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to log command: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM command_log WHERE used_at < ?", at.Add(-models.CommandLogRetention).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to prune command log: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetUsageStats returns how often each command was used since the given
+// time, most used first
+func (s *SQLStore) GetUsageStats(ctx context.Context, since time.Time) ([]models.CommandCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT command, COUNT(*) FROM command_log
+		WHERE used_at >= ?
+		GROUP BY command
+		ORDER BY COUNT(*) DESC, command
+	`, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage stats: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []models.CommandCount
+	for rows.Next() {
+		var count models.CommandCount
+		if err := rows.Scan(&count.Command, &count.Count); err != nil {
+			continue // Skip invalid entries
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
+
+// SetLastSeen records when a user last posted. Users the bot doesn't know,
+// i.e. who were never added to a role, are ignored.
+func (s *SQLStore) SetLastSeen(ctx context.Context, user string, at time.Time) error {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET last_seen_at = ? WHERE name = ?", at.UnixMilli(), user)
+	if err != nil {
+		return fmt.Errorf("failed to record last seen: %w", err)
+	}
+	return nil
+}
+
+// GetInactiveMemberships returns the role memberships of users last seen in
+// [seenAfter, seenBefore). Users who never posted count as seen when they
+// were first recorded.
+func (s *SQLStore) GetInactiveMemberships(ctx context.Context, seenAfter, seenBefore time.Time) ([]models.Membership, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.name, u.name, ru.chat_id
+		FROM role_users ru
+		JOIN roles r ON r.id = ru.role_id
+		JOIN users u ON u.id = ru.user_id
+		WHERE `+activeMembership+`
+		AND COALESCE(u.last_seen_at, CAST(strftime('%s', u.created_at) AS INTEGER) * 1000) >= ?
+		AND COALESCE(u.last_seen_at, CAST(strftime('%s', u.created_at) AS INTEGER) * 1000) < ?
+		ORDER BY ru.chat_id, u.name, r.name
+	`, time.Now().UnixMilli(), seenAfter.UnixMilli(), seenBefore.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inactive memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var inactive []models.Membership
+	for rows.Next() {
+		var membership models.Membership
+		if err := rows.Scan(&membership.Role, &membership.User, &membership.ChatID); err != nil {
+			continue // Skip invalid entries
+		}
+		inactive = append(inactive, membership)
+	}
+
+	return inactive, nil
+}
+
+// lastUpdateIDKey returns the bot_state key of the last Telegram update
+// handled by a shard. Update IDs are counted per bot token, so each shard
+// keeps its own. The first shard uses the key from before sharding.
+func lastUpdateIDKey(shard int) string {
+	if shard == 0 {
+		return "last_update_id"
+	}
+	return fmt.Sprintf("last_update_id_%d", shard)
+}
+
+// GetLastUpdateID returns the ID of the last Telegram update handled by a
+// shard, or 0
+func (s *SQLStore) GetLastUpdateID(ctx context.Context, shard int) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM bot_state WHERE key = ?", lastUpdateIDKey(shard)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last update id: %w", err)
+	}
+	return id, nil
+}
+
+// SetLastUpdateID records the ID of the last Telegram update handled by a
+// shard. The stored ID never decreases.
+func (s *SQLStore) SetLastUpdateID(ctx context.Context, shard, id int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO bot_state (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = MAX(value, excluded.value)
+	`, lastUpdateIDKey(shard), id)
+	if err != nil {
+		return fmt.Errorf("failed to set last update id: %w", err)
+	}
+	return nil
+}
+
+// recordAudit writes an audit entry as part of the caller's transaction
+func recordAudit(ctx context.Context, tx *sql.Tx, actor models.Actor, action, role, user string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, role, target_user, chat_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, actor.Username, action, role, user, actor.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
 }
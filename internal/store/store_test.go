@@ -0,0 +1,423 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"didactic-spork/internal/database"
+	"didactic-spork/internal/models"
+)
+
+var testActor = models.Actor{Username: "admin", ChatID: -100}
+
+// newTestStore creates a SQLStore on a fresh database in a temporary
+// directory
+func newTestStore(t *testing.T, opts Options) (*SQLStore, *sql.DB) {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "bot.db"), database.Options{
+		JournalMode:   "WAL",
+		Synchronous:   "NORMAL",
+		CacheSize:     -2000,
+		BusyTimeoutMs: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &SQLStore{db: db, read: db, readMembers: db, opts: opts}, db
+}
+
+// count returns the single integer a query selects
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// disableForeignKeys turns off ON DELETE CASCADE, keeping db to a single
+// connection so it stays off for the whole test
+func disableForeignKeys(t *testing.T, db *sql.DB) {
+	t.Helper()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA foreign_keys = OFF"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveRoleLeavesNoMemberships(t *testing.T) {
+	s, db := newTestStore(t, Options{})
+	ctx := context.Background()
+	disableForeignKeys(t, db)
+
+	for _, role := range []string{"devs", "ops"} {
+		if err := s.CreateRole(ctx, testActor, role); err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range []string{"alice", "bob"} {
+			if _, err := s.AddUserToRole(ctx, testActor, role, user); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := s.MuteRole(ctx, "devs", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RemoveRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM role_users WHERE role_id NOT IN (SELECT id FROM roles)"); n != 0 {
+		t.Errorf("%d memberships of the removed role remain", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM muted_roles WHERE role_id NOT IN (SELECT id FROM roles)"); n != 0 {
+		t.Errorf("%d mutes of the removed role remain", n)
+	}
+	if users, err := s.GetUsersInRole(ctx, "ops"); err != nil || len(users) != 2 {
+		t.Errorf("ops members = %v, %v; want alice and bob untouched", users, err)
+	}
+}
+
+func TestNormalizeRoleNamesMergesWithoutCascade(t *testing.T) {
+	s, db := newTestStore(t, Options{})
+	ctx := context.Background()
+
+	disableForeignKeys(t, db)
+
+	// The NOCASE index only folds ASCII, so these can coexist
+	if _, err := db.Exec("INSERT INTO roles (name) VALUES ('ärzte'), ('Ärzte'), ('Devs')"); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct{ role, user string }{{"ärzte", "alice"}, {"Ärzte", "bob"}, {"Ärzte", "alice"}} {
+		if _, err := db.Exec("INSERT OR IGNORE INTO users (name) VALUES (?)", m.user); err != nil {
+			t.Fatal(err)
+		}
+		_, err := db.Exec(`INSERT INTO role_users (role_id, user_id)
+			SELECT r.id, u.id FROM roles r, users u WHERE r.name = ? AND u.name = ?`, m.role, m.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renamed, merged, err := s.NormalizeRoleNames(ctx, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 1 || merged != 1 {
+		t.Errorf("renamed %d and merged %d roles, want 1 and 1", renamed, merged)
+	}
+
+	users, err := s.GetUsersInRole(ctx, "ärzte")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0] != "alice" || users[1] != "bob" {
+		t.Errorf("members = %v, want [alice bob]", users)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM role_users WHERE role_id NOT IN (SELECT id FROM roles)"); n != 0 {
+		t.Errorf("%d memberships of the merged role remain", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM roles WHERE name = 'devs'"); n != 1 {
+		t.Error("Devs was not renamed to devs")
+	}
+}
+
+func TestCreateRoleNamePattern(t *testing.T) {
+	s, _ := newTestStore(t, Options{NamePattern: "Team-[A-Z]+"})
+	ctx := context.Background()
+
+	if err := s.CreateRole(ctx, testActor, "Team-Backend"); err != nil {
+		t.Errorf("role following the convention was refused: %v", err)
+	}
+
+	err := s.CreateRole(ctx, testActor, "myteam-backend")
+	var invalid models.ErrInvalidInput
+	if !errors.As(err, &invalid) {
+		t.Fatalf("role not following the convention: err = %v, want ErrInvalidInput", err)
+	}
+	if want := "must match the naming convention Team-[A-Z]+"; invalid.Reason != want {
+		t.Errorf("reason = %q, want %q", invalid.Reason, want)
+	}
+}
+
+func TestCreateRoleReservedNames(t *testing.T) {
+	s, _ := newTestStore(t, Options{ReservedNames: []string{"everyone", "all", "here", "admin"}})
+	ctx := context.Background()
+
+	for _, name := range []string{"everyone", "all", "here", "admin", "EVERYONE", "All", "HERE", "Admin", " admin "} {
+		var invalid models.ErrInvalidInput
+		if err := s.CreateRole(ctx, testActor, name); !errors.As(err, &invalid) || invalid.Reason != "is reserved" {
+			t.Errorf("CreateRole(%q): err = %v, want ErrInvalidInput for a reserved name", name, err)
+		}
+	}
+	if err := s.CreateRole(ctx, testActor, "admins"); err != nil {
+		t.Errorf("CreateRole(\"admins\"): %v", err)
+	}
+}
+
+func TestCreateRoleBannedWords(t *testing.T) {
+	s, _ := newTestStore(t, Options{BannedWords: []string{"spam"}})
+	ctx := context.Background()
+
+	for _, name := range []string{"spam", "SpamTeam", "anti-SPAM"} {
+		var invalid models.ErrInvalidInput
+		if err := s.CreateRole(ctx, testActor, name); !errors.As(err, &invalid) || invalid.Reason != "contains a banned word" {
+			t.Errorf("CreateRole(%q): err = %v, want ErrInvalidInput for a banned word", name, err)
+		}
+	}
+	if err := s.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Errorf("CreateRole(\"devs\"): %v", err)
+	}
+
+	// Without banned words nothing is filtered
+	s, _ = newTestStore(t, Options{})
+	if err := s.CreateRole(ctx, testActor, "spam"); err != nil {
+		t.Errorf("CreateRole(\"spam\") without banned words: %v", err)
+	}
+}
+
+func TestAddUserToRoleRejectsBots(t *testing.T) {
+	s, _ := newTestStore(t, Options{RejectBots: true})
+	ctx := context.Background()
+	if err := s.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+
+	var invalid models.ErrInvalidInput
+	if _, err := s.AddUserToRole(ctx, testActor, "devs", "SomeBot"); !errors.As(err, &invalid) || invalid.Reason != "belongs to a bot" {
+		t.Errorf("adding a bot: err = %v, want ErrInvalidInput for a bot", err)
+	}
+	if _, err := s.AddUserToRole(ctx, testActor, "devs", "robert"); err != nil {
+		t.Errorf("adding robert: %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	s, _ := newTestStore(t, Options{})
+	ctx := context.Background()
+	if err := s.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+
+	var roleExists models.ErrRoleAlreadyExists
+	if err := s.CreateRole(ctx, testActor, "Devs"); !errors.As(err, &roleExists) || roleExists.Role != "devs" {
+		t.Errorf("duplicate CreateRole: err = %v, want ErrRoleAlreadyExists for devs", err)
+	}
+	var invalid models.ErrInvalidInput
+	if err := s.CreateRole(ctx, testActor, "  "); !errors.As(err, &invalid) {
+		t.Errorf("empty CreateRole: err = %v, want ErrInvalidInput", err)
+	}
+	var roleNotFound models.ErrRoleNotFound
+	if _, err := s.AddUserToRole(ctx, testActor, "ops", "alice"); !errors.As(err, &roleNotFound) || roleNotFound.Role != "ops" {
+		t.Errorf("AddUserToRole to a missing role: err = %v, want ErrRoleNotFound for ops", err)
+	}
+	if err := s.RemoveRole(ctx, testActor, "ops"); !errors.As(err, &roleNotFound) {
+		t.Errorf("RemoveRole of a missing role: err = %v, want ErrRoleNotFound", err)
+	}
+	var userNotFound models.ErrUserNotFound
+	if err := s.RemoveUserFromRole(ctx, testActor, "devs", "alice"); !errors.As(err, &userNotFound) {
+		t.Errorf("RemoveUserFromRole of a non-member: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCreateRoleMaxRoles(t *testing.T) {
+	s, _ := newTestStore(t, Options{MaxRoles: 3})
+	ctx := context.Background()
+
+	for _, role := range []string{"devs", "ops", "qa"} {
+		if err := s.CreateRole(ctx, testActor, role); err != nil {
+			t.Fatalf("creating %s under the cap: %v", role, err)
+		}
+	}
+	var tooMany models.ErrTooManyRoles
+	if err := s.CreateRole(ctx, testActor, "design"); !errors.As(err, &tooMany) || tooMany.Limit != 3 {
+		t.Fatalf("creating past the cap: err = %v, want ErrTooManyRoles with limit 3", err)
+	}
+
+	// Removing a role makes room again
+	if err := s.RemoveRole(ctx, testActor, "qa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateRole(ctx, testActor, "design"); err != nil {
+		t.Errorf("creating after a removal: %v", err)
+	}
+}
+
+func TestGetRolesMatchingTreatsWildcardsLiterally(t *testing.T) {
+	s, _ := newTestStore(t, Options{})
+	ctx := context.Background()
+	for _, role := range []string{"on_call", "oncall", "on-call", "100%", "1000", "back-team", "front-team"} {
+		if err := s.CreateRole(ctx, testActor, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"on_", []string{"on_call"}},
+		{"100%", []string{"100%"}},
+		{"%", nil},
+		{"*-team", []string{"back-team", "front-team"}},
+	}
+	for _, tt := range tests {
+		got, err := s.GetRolesMatching(ctx, tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetRolesMatching(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCachedMembersAreReadFromPrimary(t *testing.T) {
+	_, primary := newTestStore(t, Options{})
+	// A copy that hasn't caught up with any write yet
+	_, replica := newTestStore(t, Options{})
+	ctx := context.Background()
+
+	uncached := New(primary, Options{ReadDB: replica})
+	cached := New(primary, Options{ReadDB: replica, MembersCacheTTL: time.Minute, MembersCacheSize: 10})
+	if err := cached.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.AddUserToRole(ctx, testActor, "devs", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if users, _ := uncached.GetUsersInRole(ctx, "devs"); len(users) != 0 {
+		t.Errorf("uncached members = %v, want none from the lagging copy", users)
+	}
+	if users, _ := cached.GetUsersInRole(ctx, "devs"); len(users) != 1 || users[0] != "alice" {
+		t.Errorf("cached members = %v, want [alice] from the primary", users)
+	}
+}
+
+func TestUncachedReadsUseReadDB(t *testing.T) {
+	_, primary := newTestStore(t, Options{})
+	replicaStore, replica := newTestStore(t, Options{})
+	ctx := context.Background()
+	// Data only the read copy has, so reads from it can be told apart
+	if err := replicaStore.CreateRole(ctx, testActor, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replicaStore.AddUserToRole(ctx, testActor, "ops", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(primary, Options{ReadDB: replica})
+	if err := s.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddUserToRole(ctx, testActor, "devs", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if roles, _ := s.GetAllRoles(ctx, false); len(roles) != 1 || roles[0] != "ops" {
+		t.Errorf("roles = %v, want [ops] from the read copy", roles)
+	}
+	if users, _ := s.GetUsersInRole(ctx, "ops"); len(users) != 1 || users[0] != "bob" {
+		t.Errorf("ops members = %v, want [bob] from the read copy", users)
+	}
+	if n := count(t, primary, "SELECT COUNT(*) FROM role_users"); n != 1 {
+		t.Errorf("primary has %d memberships, want alice's", n)
+	}
+	if n := count(t, replica, "SELECT COUNT(*) FROM roles WHERE name = 'devs'"); n != 0 {
+		t.Error("devs was written to the read copy")
+	}
+}
+
+func TestConcurrentAddUserToRole(t *testing.T) {
+	_, db := newTestStore(t, Options{})
+	s := New(db, Options{})
+	ctx := context.Background()
+	if err := s.CreateRole(ctx, testActor, "devs"); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, perWorker = 20, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := s.AddUserToRole(ctx, testActor, "devs", fmt.Sprintf("user%d_%d", w, i)); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if isBusy(err) {
+			t.Errorf("concurrent add failed on a lock: %v", err)
+		} else {
+			t.Errorf("concurrent add: %v", err)
+		}
+	}
+	if users, err := s.GetUsersInRole(ctx, "devs"); err != nil || len(users) != workers*perWorker {
+		t.Errorf("devs has %d members (%v), want %d", len(users), err, workers*perWorker)
+	}
+}
+
+func TestExpiredMemberships(t *testing.T) {
+	s, _ := newTestStore(t, Options{})
+	ctx := context.Background()
+	if err := s.CreateRole(ctx, testActor, "oncall"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for user, expires := range map[string]time.Time{
+		"alice": now.Add(-time.Minute),
+		"bob":   now.Add(time.Hour),
+		"carol": {},
+	} {
+		if _, err := s.AddUserToRoleWithExpiry(ctx, testActor, "oncall", user, expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Expired members are left out before the sweeper gets to them
+	users, err := s.GetUsersInRole(ctx, "oncall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(users, []string{"bob", "carol"}) {
+		t.Errorf("members = %v, want [bob carol]", users)
+	}
+
+	expired, err := s.RemoveExpiredMemberships(ctx, "rolesbot", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].User != "alice" || expired[0].Role != "oncall" || expired[0].ChatID != testActor.ChatID {
+		t.Errorf("expired = %+v, want alice's oncall membership", expired)
+	}
+	if expired, _ := s.RemoveExpiredMemberships(ctx, "rolesbot", now); len(expired) != 0 {
+		t.Errorf("second sweep removed %+v, want nothing", expired)
+	}
+
+	// Once bob's time is up he is swept too; carol never expires
+	expired, err = s.RemoveExpiredMemberships(ctx, "rolesbot", now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].User != "bob" {
+		t.Errorf("expired = %+v, want bob's membership", expired)
+	}
+}
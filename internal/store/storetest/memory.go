@@ -0,0 +1,685 @@
+// Package storetest provides an in-memory store.Store for tests
+package storetest
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"didactic-spork/internal/models"
+	"didactic-spork/internal/store"
+	"didactic-spork/pkg/utils"
+)
+
+// MemoryStore is a map-based store.Store that validates input like the SQL
+// store does. It covers roles, memberships and their expiry, users, mutes,
+// do-not-disturb, ping templates, aliases, admins, and usage. The other
+// methods, such as scheduled pings and chat cleanup, go to the embedded
+// Store, which is nil and panics; set it to delegate them elsewhere.
+type MemoryStore struct {
+	store.Store
+
+	mu        sync.Mutex
+	roles     map[string]*role
+	users     map[string]models.User
+	dnd       map[string]models.DND
+	lastSeen  map[string]time.Time
+	templates map[int64]string
+	aliases   map[string]string
+	admins    map[string]bool
+	usage     []usageEntry
+	updateIDs map[int]int
+
+	audit []models.AuditEntry
+}
+
+type role struct {
+	category string
+	archived bool
+	owner    string
+	oncall   int
+	members  map[string]membership
+	muted    map[string]bool
+}
+
+type membership struct {
+	chatID    int64
+	expiresAt time.Time
+}
+
+type usageEntry struct {
+	command string
+	at      time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		roles:     make(map[string]*role),
+		users:     make(map[string]models.User),
+		dnd:       make(map[string]models.DND),
+		lastSeen:  make(map[string]time.Time),
+		templates: make(map[int64]string),
+		aliases:   make(map[string]string),
+		admins:    make(map[string]bool),
+		updateIDs: make(map[int]int),
+	}
+}
+
+func (s *MemoryStore) record(actor models.Actor, action, role, target string) {
+	s.audit = append(s.audit, models.AuditEntry{
+		Timestamp:  time.Now(),
+		Actor:      actor.Username,
+		Action:     action,
+		Role:       role,
+		TargetUser: target,
+		ChatID:     actor.ChatID,
+	})
+}
+
+// active reports whether a membership hasn't expired
+func (m membership) active(now time.Time) bool {
+	return m.expiresAt.IsZero() || m.expiresAt.After(now)
+}
+
+func (s *MemoryStore) CreateRole(ctx context.Context, actor models.Actor, name string) error {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[name]; ok {
+		return models.ErrRoleAlreadyExists{Role: name}
+	}
+	s.roles[name] = &role{
+		owner:   utils.SanitizeUsername(actor.Username),
+		members: make(map[string]membership),
+		muted:   make(map[string]bool),
+	}
+	s.record(actor, models.AuditCreateRole, name, "")
+	return nil
+}
+
+func (s *MemoryStore) RemoveRole(ctx context.Context, actor models.Actor, name string) error {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[name]; !ok {
+		return models.ErrRoleNotFound{Role: name}
+	}
+	delete(s.roles, name)
+	s.record(actor, models.AuditRemoveRole, name, "")
+	return nil
+}
+
+func (s *MemoryStore) AddUserToRole(ctx context.Context, actor models.Actor, role, user string) (bool, error) {
+	return s.AddUserToRoleWithExpiry(ctx, actor, role, user, time.Time{})
+}
+
+func (s *MemoryStore) AddUserToRoleWithExpiry(ctx context.Context, actor models.Actor, name, user string, expiresAt time.Time) (bool, error) {
+	name = utils.SanitizeRoleName(name)
+	user = utils.SanitizeUsername(user)
+	if name == "" {
+		return false, models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return false, models.ErrRoleNotFound{Role: name}
+	}
+	if _, ok := s.users[user]; !ok {
+		s.users[user] = models.User{Name: user}
+	}
+	if m, ok := r.members[user]; ok && m.active(time.Now()) {
+		return false, nil
+	}
+	r.members[user] = membership{chatID: actor.ChatID, expiresAt: expiresAt}
+	s.record(actor, models.AuditAddToRole, name, user)
+	return true, nil
+}
+
+func (s *MemoryStore) RemoveUserFromRole(ctx context.Context, actor models.Actor, name, user string) error {
+	name = utils.SanitizeRoleName(name)
+	user = utils.SanitizeUsername(user)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return models.ErrUserNotFound{User: user, Role: name}
+	}
+	if _, ok := r.members[user]; !ok {
+		return models.ErrUserNotFound{User: user, Role: name}
+	}
+	delete(r.members, user)
+	delete(r.muted, user)
+	s.record(actor, models.AuditRemoveFromRole, name, user)
+	return nil
+}
+
+func (s *MemoryStore) RemoveExpiredMemberships(ctx context.Context, actor string, now time.Time) ([]models.Membership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []models.Membership
+	for name, r := range s.roles {
+		for user, m := range r.members {
+			if m.expiresAt.IsZero() || m.expiresAt.After(now) {
+				continue
+			}
+			expired = append(expired, models.Membership{Role: name, User: user, ChatID: m.chatID, ExpiresAt: m.expiresAt})
+			delete(r.members, user)
+			delete(r.muted, user)
+			s.record(models.Actor{Username: actor, ChatID: m.chatID}, models.AuditRemoveFromRole, name, user)
+		}
+	}
+	return expired, nil
+}
+
+func (s *MemoryStore) UpsertUser(ctx context.Context, user models.User) error {
+	user.Name = utils.SanitizeUsername(user.Name)
+	if user.Name == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user.Name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, known := range s.users {
+		if user.TelegramID != 0 && known.TelegramID == user.TelegramID && name != user.Name {
+			known.TelegramID = 0
+			s.users[name] = known
+		}
+	}
+	s.users[user.Name] = user
+	return nil
+}
+
+func (s *MemoryStore) GetUsers(ctx context.Context, names []string) ([]models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []models.User
+	for _, name := range names {
+		if user, ok := s.users[utils.SanitizeUsername(name)]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetUsersInRole(ctx context.Context, name string) ([]string, error) {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return nil, models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return nil, nil
+	}
+	return r.activeMembers(time.Now()), nil
+}
+
+// activeMembers returns the members whose membership hasn't expired, in name
+// order
+func (r *role) activeMembers(now time.Time) []string {
+	var users []string
+	for user, m := range r.members {
+		if m.active(now) {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+func (s *MemoryStore) NextOncall(ctx context.Context, name string) (string, error) {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return "", models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return "", models.ErrRoleNotFound{Role: name}
+	}
+	users := r.activeMembers(time.Now())
+	if len(users) == 0 {
+		return "", nil
+	}
+	next := users[r.oncall%len(users)]
+	r.oncall = (r.oncall + 1) % len(users)
+	return next, nil
+}
+
+func (s *MemoryStore) MuteRole(ctx context.Context, name, user string) error {
+	name = utils.SanitizeRoleName(name)
+	user = utils.SanitizeUsername(user)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return models.ErrUserNotFound{User: user, Role: name}
+	}
+	if _, ok := r.members[user]; !ok {
+		return models.ErrUserNotFound{User: user, Role: name}
+	}
+	r.muted[user] = true
+	return nil
+}
+
+func (s *MemoryStore) UnmuteRole(ctx context.Context, name, user string) error {
+	name = utils.SanitizeRoleName(name)
+	user = utils.SanitizeUsername(user)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.roles[name]; ok {
+		delete(r.muted, user)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetMutedUsersInRole(ctx context.Context, name string) ([]string, error) {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return nil, models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return nil, nil
+	}
+	var muted []string
+	for user := range r.muted {
+		muted = append(muted, user)
+	}
+	sort.Strings(muted)
+	return muted, nil
+}
+
+func (s *MemoryStore) SetDND(ctx context.Context, user string, dnd *models.DND) error {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user]; !ok {
+		s.users[user] = models.User{Name: user}
+	}
+	if dnd == nil {
+		delete(s.dnd, user)
+	} else {
+		s.dnd[user] = *dnd
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDND(ctx context.Context, users []string) (map[string]models.DND, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	windows := make(map[string]models.DND)
+	for _, user := range users {
+		user = utils.SanitizeUsername(user)
+		if dnd, ok := s.dnd[user]; ok {
+			windows[user] = dnd
+		}
+	}
+	return windows, nil
+}
+
+func (s *MemoryStore) SetPingTemplate(ctx context.Context, actor models.Actor, template string) error {
+	template = utils.SanitizeMessage(template)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if template == "" {
+		delete(s.templates, actor.ChatID)
+		return nil
+	}
+	if err := models.ValidatePingTemplate(template); err != nil {
+		return err
+	}
+	s.templates[actor.ChatID] = template
+	return nil
+}
+
+func (s *MemoryStore) GetPingTemplate(ctx context.Context, chatID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.templates[chatID], nil
+}
+
+func (s *MemoryStore) SetCommandAlias(ctx context.Context, actor models.Actor, alias, command string) error {
+	alias = normalizeCommandName(alias)
+	command = normalizeCommandName(command)
+	if err := models.ValidateCommandAlias(alias, command); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases[alias] = command
+	return nil
+}
+
+func (s *MemoryStore) RemoveCommandAlias(ctx context.Context, alias string) (bool, error) {
+	alias = normalizeCommandName(alias)
+	if alias == "" {
+		return false, models.ErrInvalidInput{Field: "alias", Value: alias, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.aliases[alias]
+	delete(s.aliases, alias)
+	return ok, nil
+}
+
+func (s *MemoryStore) GetCommandAliases(ctx context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	aliases := make(map[string]string, len(s.aliases))
+	for alias, command := range s.aliases {
+		aliases[alias] = command
+	}
+	return aliases, nil
+}
+
+// normalizeCommandName lowercases a command name and drops its leading slash
+func normalizeCommandName(name string) string {
+	return strings.TrimPrefix(strings.ToLower(utils.SanitizeInput(name)), "/")
+}
+
+func (s *MemoryStore) AddAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.admins[user] {
+		return false, nil
+	}
+	s.admins[user] = true
+	s.record(actor, models.AuditPromoteAdmin, "", user)
+	return true, nil
+}
+
+func (s *MemoryStore) RemoveAdmin(ctx context.Context, actor models.Actor, user string) (bool, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return false, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.admins[user] {
+		return false, nil
+	}
+	delete(s.admins, user)
+	s.record(actor, models.AuditDemoteAdmin, "", user)
+	return true, nil
+}
+
+func (s *MemoryStore) ListAdmins(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var admins []string
+	for admin := range s.admins {
+		admins = append(admins, admin)
+	}
+	sort.Strings(admins)
+	return admins, nil
+}
+
+func (s *MemoryStore) GetAllRoles(ctx context.Context, includeArchived bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var roles []string
+	for name, r := range s.roles {
+		if includeArchived || !r.archived {
+			roles = append(roles, name)
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (s *MemoryStore) SetRoleCategory(ctx context.Context, actor models.Actor, name, category string) error {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return models.ErrRoleNotFound{Role: name}
+	}
+	r.category = utils.SanitizeRoleName(category)
+	return nil
+}
+
+func (s *MemoryStore) GetRolesByCategory(ctx context.Context) (map[string][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	categories := make(map[string][]string)
+	for name, r := range s.roles {
+		if r.archived {
+			continue
+		}
+		category := r.category
+		if category == "" {
+			category = models.UncategorizedCategory
+		}
+		categories[category] = append(categories[category], name)
+	}
+	for _, roles := range categories {
+		sort.Strings(roles)
+	}
+	return categories, nil
+}
+
+func (s *MemoryStore) SetRoleArchived(ctx context.Context, actor models.Actor, name string, archived bool) error {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[name]
+	if !ok {
+		return models.ErrRoleNotFound{Role: name}
+	}
+	r.archived = archived
+	return nil
+}
+
+func (s *MemoryStore) IsRoleArchived(ctx context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[utils.SanitizeRoleName(name)]
+	return ok && r.archived, nil
+}
+
+func (s *MemoryStore) SetRoleOwner(ctx context.Context, actor models.Actor, name, owner string) error {
+	name = utils.SanitizeRoleName(name)
+	owner = utils.SanitizeUsername(owner)
+	if name == "" {
+		return models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+	if owner == "" {
+		return models.ErrInvalidInput{Field: "username", Value: owner, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[owner]; !ok {
+		return models.ErrUnknownUser{User: owner}
+	}
+	r, ok := s.roles[name]
+	if !ok {
+		return models.ErrRoleNotFound{Role: name}
+	}
+	r.owner = owner
+	return nil
+}
+
+func (s *MemoryStore) IsRoleOwner(ctx context.Context, name, user string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[utils.SanitizeRoleName(name)]
+	user = utils.SanitizeUsername(user)
+	return ok && user != "" && r.owner == user, nil
+}
+
+func (s *MemoryStore) GetRolesForUser(ctx context.Context, user string) ([]string, error) {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return nil, models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var roles []string
+	for name, r := range s.roles {
+		if m, ok := r.members[user]; ok && m.active(now) {
+			roles = append(roles, name)
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (s *MemoryStore) GetAllUsersInChat(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var users []string
+	for _, r := range s.roles {
+		for _, user := range r.activeMembers(now) {
+			if !slices.Contains(users, user) {
+				users = append(users, user)
+			}
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (s *MemoryStore) LogCommand(ctx context.Context, command string, chatID int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = append(s.usage, usageEntry{command: command, at: at})
+	return nil
+}
+
+func (s *MemoryStore) GetUsageStats(ctx context.Context, since time.Time) ([]models.CommandCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for _, entry := range s.usage {
+		if !entry.at.Before(since) {
+			counts[entry.command]++
+		}
+	}
+	var stats []models.CommandCount
+	for command, count := range counts {
+		stats = append(stats, models.CommandCount{Command: command, Count: count})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Command < stats[j].Command
+	})
+	return stats, nil
+}
+
+func (s *MemoryStore) GetAuditLog(ctx context.Context, name string, limit int) ([]models.AuditEntry, error) {
+	name = utils.SanitizeRoleName(name)
+	if name == "" {
+		return nil, models.ErrInvalidInput{Field: "role name", Value: name, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []models.AuditEntry
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.audit[i].Role == name {
+			entries = append(entries, s.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) SetLastSeen(ctx context.Context, user string, at time.Time) error {
+	user = utils.SanitizeUsername(user)
+	if user == "" {
+		return models.ErrInvalidInput{Field: "username", Value: user, Reason: "cannot be empty"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user]; ok {
+		s.lastSeen[user] = at
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetLastUpdateID(ctx context.Context, shard int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateIDs[shard], nil
+}
+
+func (s *MemoryStore) SetLastUpdateID(ctx context.Context, shard, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateIDs[shard] = id
+	return nil
+}
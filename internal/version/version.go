@@ -0,0 +1,17 @@
+// Package version holds build information injected at link time.
+package version
+
+import "fmt"
+
+// Build information, set with -ldflags at build time, e.g.
+//
+//	go build -ldflags "-X didactic-spork/internal/version.Version=v1.2.0 -X didactic-spork/internal/version.Commit=abc1234" ./cmd/bot
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// String returns the version and commit in a single line
+func String() string {
+	return fmt.Sprintf("%s (%s)", Version, Commit)
+}
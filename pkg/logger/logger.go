@@ -36,3 +36,15 @@ func New(level string, production bool) *Logger {
 
 	return &Logger{Logger: log}
 }
+
+// NewAccess creates a logger for the access log. It writes one JSON object
+// per line at info level, whatever the configured level and environment, so
+// the entries can be ingested by log tooling.
+func NewAccess() *Logger {
+	log := logrus.New()
+	log.SetLevel(logrus.InfoLevel)
+	log.SetFormatter(&logrus.JSONFormatter{})
+	log.SetOutput(os.Stdout)
+
+	return &Logger{Logger: log}
+}
@@ -1,7 +1,67 @@
 // Package utils provides utility functions.
 package utils
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// timeLocation is the zone FormatTime shows timestamps in
+var timeLocation = time.UTC
+
+// SetTimeLocation sets the zone used by FormatTime. It is meant to be called
+// once at startup.
+func SetTimeLocation(loc *time.Location) {
+	timeLocation = loc
+}
+
+// EscapeLike escapes the LIKE wildcards % and _ in s, and the escape
+// character itself, so they match literally. Queries must declare the escape
+// character with ESCAPE '\'. SQLite's LIKE has no bracket classes, so [ needs
+// no escaping.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// TimeLocation returns the zone set with SetTimeLocation
+func TimeLocation() *time.Location {
+	return timeLocation
+}
+
+// FormatTime formats a timestamp shown to users, in the configured zone
+func FormatTime(t time.Time) string {
+	return t.In(timeLocation).Format("2006-01-02 15:04 MST")
+}
+
+// ParseDuration parses a positive whole number of days, hours, or minutes
+// with a d, h, or m suffix, e.g. "7d" or "12h"
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("duration %q must end in d, h, or m", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("duration %q must start with a positive number", s)
+	}
+	if time.Duration(n) > math.MaxInt64/unit {
+		return 0, fmt.Errorf("duration %q is too long", s)
+	}
+	return time.Duration(n) * unit, nil
+}
 
 // SanitizeInput sanitizes user input to prevent injection attacks
 func SanitizeInput(input string) string {
@@ -10,15 +70,52 @@ func SanitizeInput(input string) string {
 	input = strings.ReplaceAll(input, "\n", " ")
 	input = strings.ReplaceAll(input, "\r", " ")
 
-	// Limit length to prevent abuse
+	// Limit length to prevent abuse, counting characters rather than bytes
+	// so names in other scripts or with emoji aren't cut mid-character
 	const maxInputLength = 100
-	if len(input) > maxInputLength {
-		input = input[:maxInputLength]
+	if runes := []rune(input); len(runes) > maxInputLength {
+		input = strings.TrimSpace(string(runes[:maxInputLength]))
 	}
 
 	return input
 }
 
+// SanitizeMessage sanitizes free-form message text such as custom ping messages.
+// Unlike SanitizeInput it keeps line breaks and allows much longer text, but it
+// still strips control and bidirectional override characters.
+func SanitizeMessage(message string) string {
+	message = strings.ReplaceAll(message, "\r\n", "\n")
+	message = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r), isBidiControl(r):
+			return -1
+		}
+		return r
+	}, message)
+	message = strings.TrimSpace(message)
+
+	// Collapse long runs of blank lines
+	for strings.Contains(message, "\n\n\n") {
+		message = strings.ReplaceAll(message, "\n\n\n", "\n\n")
+	}
+
+	// Stay well under Telegram's 4096 character message limit
+	const maxMessageLength = 3500
+	if runes := []rune(message); len(runes) > maxMessageLength {
+		message = string(runes[:maxMessageLength])
+	}
+
+	return message
+}
+
+// isBidiControl reports whether r is a Unicode bidirectional formatting
+// character, which can be used to visually spoof message content
+func isBidiControl(r rune) bool {
+	return (r >= '\u202A' && r <= '\u202E') || (r >= '\u2066' && r <= '\u2069')
+}
+
 // SanitizeUsername sanitizes and normalizes usernames
 func SanitizeUsername(username string) string {
 	// Sanitize input first
@@ -33,6 +130,12 @@ func SanitizeUsername(username string) string {
 	return username
 }
 
+// LooksLikeBot reports whether a username is shaped like a bot's. Telegram
+// requires bot usernames to end in "bot", in any case.
+func LooksLikeBot(username string) bool {
+	return strings.HasSuffix(SanitizeUsername(username), "bot")
+}
+
 // SanitizeRoleName sanitizes and normalizes role names
 func SanitizeRoleName(roleName string) string {
 	// Sanitize input first
@@ -44,6 +147,89 @@ func SanitizeRoleName(roleName string) string {
 	return roleName
 }
 
+// EntityText returns the part of text covered by a Telegram message entity.
+// Entity offsets and lengths are measured in UTF-16 code units, so they can't
+// be used to slice the Go string directly. Out-of-range entities yield "".
+func EntityText(text string, offset, length int) string {
+	units := utf16.Encode([]rune(text))
+	if offset < 0 || length < 0 || offset+length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[offset : offset+length]))
+}
+
+// markdownV2Special lists the characters that must be escaped in MarkdownV2 text
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// EscapeMarkdownV2 escapes text so Telegram shows it literally in a message
+// sent with the MarkdownV2 parse mode
+func EscapeMarkdownV2(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(markdownV2Special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// SplitMessage splits text into chunks of at most limit UTF-16 code units
+// (the unit Telegram measures message length in), preferring to break at line
+// breaks, then spaces
+func SplitMessage(text string, limit int) []string {
+	var chunks []string
+	runes := []rune(text)
+	for {
+		size, cut := 0, len(runes)
+		for i, r := range runes {
+			size++
+			if r >= 0x10000 {
+				size++ // encoded as a surrogate pair
+			}
+			if size > limit {
+				cut = i
+				break
+			}
+		}
+		if cut == len(runes) {
+			break
+		}
+
+		if i := lastIndexRune(runes[:cut], '\n'); i > 0 {
+			cut = i
+		} else if i := lastIndexRune(runes[:cut], ' '); i > 0 {
+			cut = i
+		} else if trailingBackslashes(runes[:cut])%2 == 1 {
+			cut-- // Keep a MarkdownV2 escape together with the escaped character
+		}
+		chunks = append(chunks, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
+
+func trailingBackslashes(runes []rune) int {
+	n := 0
+	for i := len(runes) - 1; i >= 0 && runes[i] == '\\'; i-- {
+		n++
+	}
+	return n
+}
+
+func lastIndexRune(runes []rune, target rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
 // Contains checks if a slice contains a specific string
 func Contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -54,6 +240,22 @@ func Contains(slice []string, item string) bool {
 	return false
 }
 
+// FindBanned returns the first of the banned substrings that text contains,
+// ignoring case, and whether there was one. Banned substrings must already
+// be lowercase.
+func FindBanned(text string, banned []string) (string, bool) {
+	if len(banned) == 0 {
+		return "", false
+	}
+	text = strings.ToLower(text)
+	for _, word := range banned {
+		if strings.Contains(text, word) {
+			return word, true
+		}
+	}
+	return "", false
+}
+
 // Unique removes duplicate strings from a slice
 func Unique(slice []string) []string {
 	keys := make(map[string]bool)
@@ -68,3 +270,51 @@ func Unique(slice []string) []string {
 
 	return result
 }
+
+// ErrUnbalancedQuotes is returned for an argument whose opening quote is
+// never closed
+var ErrUnbalancedQuotes = errors.New("unbalanced quotes")
+
+// isQuote reports whether r delimits a quoted argument. Phone keyboards often
+// turn " into typographic quotes, so those are accepted as well.
+func isQuote(r rune) bool {
+	return r == '"' || r == '“' || r == '”'
+}
+
+// NextArg splits the first argument off s. An argument is either a run of
+// non-space characters or text in double quotes, which may contain spaces.
+// The rest is returned without its leading space but otherwise untouched. If
+// the quote is never closed, the first run of non-space characters is
+// returned as is, together with ErrUnbalancedQuotes.
+func NextArg(s string) (arg, rest string, err error) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if first, size := utf8.DecodeRuneInString(s); isQuote(first) {
+		if end := strings.IndexFunc(s[size:], isQuote); end >= 0 {
+			end += size
+			_, closeSize := utf8.DecodeRuneInString(s[end:])
+			return s[size:end], strings.TrimLeftFunc(s[end+closeSize:], unicode.IsSpace), nil
+		}
+		err = ErrUnbalancedQuotes
+	}
+
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		return s, "", err
+	}
+	return s[:end], strings.TrimLeftFunc(s[end:], unicode.IsSpace), err
+}
+
+// SplitArgs splits command arguments on whitespace, keeping text in double
+// quotes together, so `"qa team" alice` yields "qa team" and "alice"
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	for rest := strings.TrimSpace(s); rest != ""; {
+		arg, next, err := NextArg(rest)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		rest = next
+	}
+	return args, nil
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"devs":      "devs",
+		"100%":      `100\%`,
+		"on_call":   `on\_call`,
+		`back\end`:  `back\\end`,
+		"[a-z]%_\\": `[a-z]\%\_\\`,
+	}
+	for in, want := range tests {
+		if got := EscapeLike(in); got != want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNextArg(t *testing.T) {
+	tests := []struct {
+		in, arg, rest string
+		err           error
+	}{
+		{`alice bob`, "alice", "bob", nil},
+		{`  alice  `, "alice", "", nil},
+		{`"qa team" alice`, "qa team", "alice", nil},
+		{`“qa team” alice`, "qa team", "alice", nil},
+		{`"" alice`, "", "alice", nil},
+		{`"qa team alice`, `"qa`, "team alice", ErrUnbalancedQuotes},
+		{``, "", "", nil},
+	}
+	for _, tt := range tests {
+		arg, rest, err := NextArg(tt.in)
+		if arg != tt.arg || rest != tt.rest || !errors.Is(err, tt.err) {
+			t.Errorf("NextArg(%q) = %q, %q, %v; want %q, %q, %v", tt.in, arg, rest, err, tt.arg, tt.rest, tt.err)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{`devs alice`, []string{"devs", "alice"}, nil},
+		{"\t devs   alice \n", []string{"devs", "alice"}, nil},
+		{`"qa team" alice`, []string{"qa team", "alice"}, nil},
+		{`“qa team” "on call"`, []string{"qa team", "on call"}, nil},
+		{`devs "alice`, nil, ErrUnbalancedQuotes},
+		{"   ", nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if !slices.Equal(got, tt.want) || !errors.Is(err, tt.err) {
+			t.Errorf("SplitArgs(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLooksLikeBot(t *testing.T) {
+	tests := map[string]bool{
+		"somebot":    true,
+		"@SomeBot":   true,
+		"deploy_bot": true,
+		"robert":     false,
+		"botanist":   false,
+	}
+	for username, want := range tests {
+		if got := LooksLikeBot(username); got != want {
+			t.Errorf("LooksLikeBot(%q) = %v, want %v", username, got, want)
+		}
+	}
+}
+
+func TestFindBanned(t *testing.T) {
+	banned := []string{"spam", "scam"}
+	tests := []struct {
+		text   string
+		banned []string
+		word   string
+		found  bool
+	}{
+		{"free spam here", banned, "spam", true},
+		{"SCAMMERS", banned, "scam", true},
+		{"deploy is done", banned, "", false},
+		{"free spam here", nil, "", false},
+	}
+	for _, tt := range tests {
+		word, found := FindBanned(tt.text, tt.banned)
+		if word != tt.word || found != tt.found {
+			t.Errorf("FindBanned(%q, %v) = %q, %v, want %q, %v", tt.text, tt.banned, word, found, tt.word, tt.found)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"7d":   7 * 24 * time.Hour,
+		"12h":  12 * time.Hour,
+		"30m":  30 * time.Minute,
+		" 2H ": 2 * time.Hour,
+	}
+	for in, want := range valid {
+		if got, err := ParseDuration(in); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "7", "d", "0d", "-1h", "1.5h", "2w", "99999999999999d"} {
+		if got, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want an error", in, got)
+		}
+	}
+}